@@ -0,0 +1,628 @@
+package httpd
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field level binding failure
+type BindingFieldError struct {
+	Field   string      `json:"field"`
+	Value   interface{} `json:"value,omitempty"`
+	Message string      `json:"message"`
+}
+
+// Request parameters that could not be bound to the handler arguments (rendered as 400)
+type BindingError struct {
+	Fields []BindingFieldError `json:"fields"`
+}
+
+func (this *BindingError) Error() string {
+	messages := make([]string, len(this.Fields))
+	for i, fieldError := range this.Fields {
+		if fieldError.Field == "" {
+			messages[i] = fieldError.Message
+		} else {
+			messages[i] = fieldError.Field + ": " + fieldError.Message
+		}
+	}
+	return "binding failed: " + strings.Join(messages, "; ")
+}
+
+func (this *BindingError) add(field string, value interface{}, err error) {
+	this.Fields = append(this.Fields, BindingFieldError{field, value, err.Error()})
+}
+
+// Panic with a 400 exception if any field failed
+func (this *BindingError) check() {
+	if len(this.Fields) > 0 {
+		panic(NewInterceptorException(this, http.StatusBadRequest, this.Fields))
+	}
+}
+
+// Converts request text to a type
+type Converter func(text string) (interface{}, error)
+
+var (
+	converters     = map[reflect.Type]Converter{}
+	convertersLock sync.RWMutex
+
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	// Accepted layouts of time.Time values
+	TimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+)
+
+// Register a converter for a type, it takes precedence over the built-in conversions
+func RegisterConverter(t reflect.Type, converter Converter) {
+	convertersLock.Lock()
+	defer convertersLock.Unlock()
+	converters[t] = converter
+}
+
+func lookupConverter(t reflect.Type) (Converter, bool) {
+	convertersLock.RLock()
+	defer convertersLock.RUnlock()
+	converter, found := converters[t]
+	return converter, found
+}
+
+// Convert request text to a value of type t
+func ConvertString(text string, t reflect.Type) (reflect.Value, error) {
+	if converter, found := lookupConverter(t); found {
+		converted, err := converter(text)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value := reflect.ValueOf(converted)
+		if !value.IsValid() || !value.Type().ConvertibleTo(t) {
+			return reflect.Value{}, fmt.Errorf("converter returned %T for %v", converted, t)
+		}
+		return value.Convert(t), nil
+	}
+
+	switch t {
+	case timeType:
+		for _, layout := range TimeLayouts {
+			if parsed, err := time.Parse(layout, text); err == nil {
+				return reflect.ValueOf(parsed), nil
+			}
+		}
+		return reflect.Value{}, fmt.Errorf("invalid time %q", text)
+	case durationType:
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid duration %q", text)
+		}
+		return reflect.ValueOf(duration), nil
+	}
+
+	if t.Kind() == reflect.Ptr {
+		elem, err := ConvertString(text, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		ptr := reflect.New(t)
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return reflect.Value{}, err
+		}
+		return ptr.Elem(), nil
+	}
+
+	value := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		value.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid bool %q", text)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(text), 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, numberError(text, t, err)
+		}
+		value.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(strings.TrimSpace(text), 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, numberError(text, t, err)
+		}
+		value.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), t.Bits())
+		if err != nil {
+			return reflect.Value{}, numberError(text, t, err)
+		}
+		value.SetFloat(f)
+	case reflect.Interface:
+		if !reflect.TypeOf(text).Implements(t) {
+			return reflect.Value{}, fmt.Errorf("cannot convert %q to %v", text, t)
+		}
+		value.Set(reflect.ValueOf(text))
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot convert %q to %v", text, t)
+	}
+	return value, nil
+}
+
+func numberError(text string, t reflect.Type, err error) error {
+	if numError, ok := err.(*strconv.NumError); ok && numError.Err == strconv.ErrRange {
+		return fmt.Errorf("%q is out of range for %v", text, t)
+	}
+	return fmt.Errorf("invalid %v %q", t, text)
+}
+
+// Convert a decoded value (e.g. an element of a JSON array) to type t
+func ConvertValue(value reflect.Value, t reflect.Type) (reflect.Value, error) {
+	for value.IsValid() && value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return reflect.Zero(t), nil
+	}
+	if value.Type() == t {
+		return value, nil
+	}
+	if value.Kind() == reflect.String {
+		return ConvertString(value.String(), t)
+	}
+	if value.Kind() == reflect.Float64 {
+		return convertNumber(value.Float(), t)
+	}
+	// Integers of other codecs (e.g. msgpack)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t.Kind() != reflect.Interface {
+			return ConvertString(strconv.FormatInt(value.Int(), 10), t)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t.Kind() != reflect.Interface {
+			return ConvertString(strconv.FormatUint(value.Uint(), 10), t)
+		}
+	}
+	if value.Type().ConvertibleTo(t) && value.Kind() == t.Kind() {
+		return value.Convert(t), nil
+	}
+
+	// Structured values go through JSON
+	buffer, err := json.Marshal(value.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(buffer, ptr.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("cannot convert %s to %v", buffer, t)
+	}
+	return ptr.Elem(), nil
+}
+
+// Convert a JSON number checking for fractions and overflow
+func convertNumber(f float64, t reflect.Type) (reflect.Value, error) {
+	value := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f != math.Trunc(f) || f < -1<<63 || f >= 1<<63 || value.OverflowInt(int64(f)) {
+			return reflect.Value{}, fmt.Errorf("%v is not a valid %v", f, t)
+		}
+		value.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f != math.Trunc(f) || f < 0 || f >= 1<<64 || value.OverflowUint(uint64(f)) {
+			return reflect.Value{}, fmt.Errorf("%v is not a valid %v", f, t)
+		}
+		value.SetUint(uint64(f))
+	case reflect.Float32, reflect.Float64:
+		if value.OverflowFloat(f) {
+			return reflect.Value{}, fmt.Errorf("%v is out of range for %v", f, t)
+		}
+		value.SetFloat(f)
+	case reflect.Interface:
+		if !reflect.TypeOf(f).Implements(t) {
+			return reflect.Value{}, fmt.Errorf("cannot convert %v to %v", f, t)
+		}
+		value.Set(reflect.ValueOf(f))
+	case reflect.Ptr:
+		elem, err := convertNumber(f, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value = reflect.New(t.Elem())
+		value.Elem().Set(elem)
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot convert %v to %v", f, t)
+	}
+	return value, nil
+}
+
+// Whether a struct type is bound field by field (not as a single value)
+func isBindableStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	if _, found := lookupConverter(t); found {
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// Binding sources, usable as struct tags on handler input fields:
+//
+//	Year   int      `path:"year"`
+//	Query  string   `query:"q"`
+//	Tenant string   `header:"X-Tenant"`
+//	Sid    string   `cookie:"sid"`
+//	Name   string   `form:"name"`
+//	Title  string   `json:"title"`
+//	Size   int      `query:"size" default:"20"`
+//
+// Tagged fields are bound from their tagged sources only, names are case-sensitive
+// (headers are canonicalized). The json tag names fields of the request body whatever
+// its codec (see RegisterCodec). Untagged fields are bound from path, body, form and
+// query by case-insensitive field name. When several sources provide a value the first
+// in the order path, json, form, query, header, cookie wins; 'default' applies when
+// none does. File parts of multipart requests are bound like form values to fields of
+// type *multipart.FileHeader, []*multipart.FileHeader, []byte or io.Reader.
+const (
+	SourcePath   = "path"
+	SourceJson   = "json"
+	SourceForm   = "form"
+	SourceQuery  = "query"
+	SourceHeader = "header"
+	SourceCookie = "cookie"
+)
+
+var bindingSourceOrder = []string{SourcePath, SourceJson, SourceForm, SourceQuery, SourceHeader, SourceCookie}
+
+type bindingSource func(name string) (interface{}, bool)
+
+// Binds request params to a struct; nested struct fields use dotted keys (e.g. ADDRESS.CITY)
+type binder struct {
+	// Lookup of tagged fields by source
+	sources map[string]bindingSource
+	// Params of untagged fields in precedence order, keys in upper case
+	params []combinedParamsType
+	// File parts of multipart requests, and files opened for them
+	files   map[string][]*multipart.FileHeader
+	uploads *requestUploads
+	err     BindingError
+}
+
+func (this *binder) bindStruct(target reflect.Value, keyPrefix string, fieldPrefix string) {
+	t := target.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fieldInfo := t.Field(i)
+		field := target.Field(i)
+		if !field.CanSet() && !fieldInfo.Anonymous {
+			continue
+		}
+		fieldType := fieldInfo.Type
+		isPtr := fieldType.Kind() == reflect.Ptr
+		if isPtr {
+			fieldType = fieldType.Elem()
+		}
+
+		// Embedded struct fields are promoted
+		if fieldInfo.Anonymous && isBindableStruct(fieldType) {
+			if isPtr {
+				if !field.CanSet() {
+					continue
+				}
+				if field.IsNil() {
+					field.Set(reflect.New(fieldType))
+				}
+				field = field.Elem()
+			}
+			this.bindStruct(field, keyPrefix, fieldPrefix)
+			continue
+		}
+		if !field.CanSet() {
+			continue
+		}
+
+		key := keyPrefix + strings.ToUpper(fieldInfo.Name)
+		name := fieldPrefix + fieldInfo.Name
+		if headers := this.lookupFiles(fieldInfo, key); headers != nil {
+			this.bindFiles(name, headers, field)
+			continue
+		}
+		param, found, tagged := this.lookup(fieldInfo, key, keyPrefix == "")
+		if found {
+			this.bindValue(name, param, field)
+		} else if !tagged && isBindableStruct(fieldType) && this.hasPrefix(key+".") {
+			if isPtr {
+				if field.IsNil() {
+					field.Set(reflect.New(fieldType))
+				}
+				field = field.Elem()
+			}
+			this.bindStruct(field, key+".", name+".")
+		} else if defaultValue, ok := fieldInfo.Tag.Lookup("default"); ok {
+			var param interface{} = defaultValue
+			if isSliceTarget(field.Type()) {
+				param = strings.Split(defaultValue, ",")
+			}
+			this.bindValue(name+" (default)", param, field)
+		}
+	}
+}
+
+// Find the param for a field, and whether the field has source tags
+func (this *binder) lookup(fieldInfo reflect.StructField, key string, topLevel bool) (interface{}, bool, bool) {
+	tagged := false
+	for _, source := range bindingSourceOrder {
+		tag, ok := fieldInfo.Tag.Lookup(source)
+		if !ok {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = fieldInfo.Name
+		}
+		tagged = true
+		// Body fields exist only at the top level, nested ones come with their parent
+		if lookup, found := this.sources[source]; found && (topLevel || source != SourceJson) {
+			if param, found := lookup(name); found {
+				return param, true, true
+			}
+		}
+	}
+	if tagged {
+		return nil, false, true
+	}
+	for _, params := range this.params {
+		if param, found := params[key]; found {
+			return param, true, false
+		}
+	}
+	return nil, false, false
+}
+
+func (this *binder) hasPrefix(prefix string) bool {
+	for _, params := range this.params {
+		for key := range params {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (this *binder) bindValue(name string, param interface{}, field reflect.Value) {
+	switch values := param.(type) {
+	case nil:
+		return
+	case json.RawMessage:
+		ptr := reflect.New(field.Type())
+		if err := json.Unmarshal(values, ptr.Interface()); err != nil {
+			if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+				err = fmt.Errorf("cannot convert %s to %v", typeErr.Value, typeErr.Type)
+			}
+			this.err.add(name, string(values), err)
+		} else {
+			field.Set(ptr.Elem())
+		}
+		return
+	case []string:
+		if isSliceTarget(field.Type()) {
+			slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+			for i, text := range values {
+				if value, err := ConvertString(text, field.Type().Elem()); err != nil {
+					this.err.add(fmt.Sprintf("%s[%d]", name, i), text, err)
+				} else {
+					slice.Index(i).Set(value)
+				}
+			}
+			field.Set(slice)
+			return
+		}
+		// Last one wins for single values
+		param = values[len(values)-1]
+	case string:
+		if isSliceTarget(field.Type()) {
+			param = []string{values}
+			this.bindValue(name, param, field)
+			return
+		}
+	}
+	if value, err := ConvertValue(reflect.ValueOf(param), field.Type()); err != nil {
+		this.err.add(name, param, err)
+	} else {
+		field.Set(value)
+	}
+}
+
+// Slices bound from repeated keys ([]byte is bound from text)
+func isSliceTarget(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice || t.Elem().Kind() == reflect.Uint8 {
+		return false
+	}
+	_, found := lookupConverter(t)
+	return !found && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// Single text value, or all of them if repeated
+func textParam(values []string) (interface{}, bool) {
+	switch len(values) {
+	case 0:
+		return nil, false
+	case 1:
+		return values[0], true
+	}
+	return values, true
+}
+
+func valuesSource(values url.Values) bindingSource {
+	return func(name string) (interface{}, bool) {
+		return textParam(values[name])
+	}
+}
+
+func upperKeys(values url.Values) combinedParamsType {
+	params := combinedParamsType{}
+	for key, value := range values {
+		if param, found := textParam(value); found {
+			params[strings.ToUpper(key)] = param
+		}
+	}
+	return params
+}
+
+// Bind params to target (a struct value), returns nil if all fields were converted
+func BindParams(params combinedParamsType, target reflect.Value) *BindingError {
+	binding := binder{params: []combinedParamsType{params}}
+	binding.bindStruct(target, "", "")
+	if len(binding.err.Fields) == 0 {
+		return nil
+	}
+	return &binding.err
+}
+
+// Bind decoded body values (e.g. a form or a CSV row) to target (a struct value),
+// returns nil if all fields were converted
+func bindBodyValues(values url.Values, target reflect.Value) *BindingError {
+	binding := binder{
+		sources: map[string]bindingSource{SourceJson: valuesSource(values)},
+		params:  []combinedParamsType{upperKeys(values)},
+	}
+	binding.bindStruct(target, "", "")
+	if len(binding.err.Fields) == 0 {
+		return nil
+	}
+	return &binding.err
+}
+
+// Bind the request (path params, query, parsed form and file parts, headers, cookies and an
+// object body) to target (a struct value), returns nil if all fields were converted
+func BindRequest(request *http.Request, body []byte, target reflect.Value) *BindingError {
+	binding := binder{sources: map[string]bindingSource{}}
+	if request.MultipartForm != nil {
+		binding.files = request.MultipartForm.File
+		binding.uploads, _ = request.Context().Value(requestUploadsKey{}).(*requestUploads)
+	}
+
+	pathValues := url.Values{}
+	for key, value := range requestPathParams(request) {
+		pathValues.Set(key, value)
+	}
+	query := request.URL.Query()
+	binding.sources[SourcePath] = valuesSource(pathValues)
+	binding.sources[SourceQuery] = valuesSource(query)
+	binding.sources[SourceForm] = valuesSource(request.PostForm)
+	binding.sources[SourceHeader] = func(name string) (interface{}, bool) {
+		return textParam(request.Header[http.CanonicalHeaderKey(name)])
+	}
+	binding.sources[SourceCookie] = func(name string) (interface{}, bool) {
+		var values []string
+		for _, cookie := range request.Cookies() {
+			if cookie.Name == name {
+				values = append(values, cookie.Value)
+			}
+		}
+		return textParam(values)
+	}
+
+	// Untagged fields: path, body, form, query
+	binding.params = append(binding.params, upperKeys(pathValues))
+	if fields := binding.decodeBodyObject(request, body); fields != nil {
+		binding.sources[SourceJson] = func(name string) (interface{}, bool) {
+			if field, found := fields[name]; found {
+				return field, true
+			}
+			// Case-insensitive like encoding/json
+			for key, field := range fields {
+				if strings.EqualFold(key, name) {
+					return field, true
+				}
+			}
+			return nil, false
+		}
+		bodyParams := combinedParamsType{}
+		for key, field := range fields {
+			bodyParams[strings.ToUpper(key)] = field
+		}
+		binding.params = append(binding.params, bodyParams)
+	} else if len(request.PostForm) > 0 && len(binding.err.Fields) == 0 {
+		// Body fields of form bodies
+		binding.sources[SourceJson] = valuesSource(request.PostForm)
+	}
+	binding.params = append(binding.params, upperKeys(request.PostForm), upperKeys(query))
+
+	if len(binding.err.Fields) == 0 {
+		binding.bindStruct(target, "", "")
+	}
+	if len(binding.err.Fields) == 0 {
+		return nil
+	}
+	return &binding.err
+}
+
+// Fields of an object body, nil if there is no body
+func (this *binder) decodeBodyObject(request *http.Request, body []byte) map[string]interface{} {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	codec, err := RequestCodec(request)
+	if err != nil {
+		panic(err)
+	}
+	fields := map[string]interface{}{}
+	if _, ok := codec.(*jsonCodec); ok {
+		// Raw JSON fields are decoded straight into the field types
+		var rawFields map[string]json.RawMessage
+		if _, err := decodeRequestBody(request, body, &rawFields); err != nil {
+			this.err.add("", nil, err)
+			return nil
+		}
+		for key, field := range rawFields {
+			fields[key] = field
+		}
+		return fields
+	}
+	if _, err := decodeRequestBody(request, body, &fields); err != nil {
+		this.err.add("", nil, err)
+		return nil
+	}
+	return fields
+}
+
+// Decode a request body into target (a pointer) with the codec of its Content-Type,
+// adding failures to err
+func bindBody(request *http.Request, body []byte, target interface{}, err *BindingError) {
+	_, decodeErr := decodeRequestBody(request, body, target)
+	if decodeErr == nil {
+		return
+	}
+	switch e := errors.Unwrap(decodeErr).(type) {
+	case *json.UnmarshalTypeError:
+		err.add(e.Field, e.Value, fmt.Errorf("cannot convert %s to %v", e.Value, e.Type))
+	case *BindingError:
+		err.Fields = append(err.Fields, e.Fields...)
+	default:
+		err.add("", nil, decodeErr)
+	}
+}
@@ -0,0 +1,741 @@
+package httpd
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrorNotAcceptable        = errors.New("not acceptable")
+	ErrorUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// Encodes results and decodes request bodies of one media type
+type Codec interface {
+	// Media type without parameters, e.g. application/json
+	MediaType() string
+	// Content-Type header of encoded values, e.g. application/json; charset=utf-8
+	ContentType() string
+	Marshal(value interface{}) ([]byte, error)
+	// Decode data into target (a pointer)
+	Unmarshal(data []byte, target interface{}) error
+}
+
+var (
+	codecs     []Codec
+	codecsLock sync.RWMutex
+)
+
+func init() {
+	RegisterCodec(&jsonCodec{})
+	RegisterCodec(&xmlCodec{mediaType: "application/xml"})
+	RegisterCodec(&xmlCodec{mediaType: "text/xml"})
+	RegisterCodec(&formCodec{})
+	RegisterCodec(&csvCodec{})
+	RegisterCodec(&msgpackCodec{mediaType: "application/msgpack"})
+	RegisterCodec(&msgpackCodec{mediaType: "application/x-msgpack"})
+	RegisterErrorStatus(ErrorNotAcceptable, http.StatusNotAcceptable)
+	RegisterErrorStatus(ErrorUnsupportedMediaType, http.StatusUnsupportedMediaType)
+}
+
+// Add a codec, or replace the one of the same media type. Without an Accept header
+// results are encoded with the first codec registered that can encode them (JSON)
+func RegisterCodec(codec Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	for i, registered := range codecs {
+		if strings.EqualFold(registered.MediaType(), codec.MediaType()) {
+			codecs[i] = codec
+			return
+		}
+	}
+	codecs = append(codecs, codec)
+}
+
+// Codec of a media type, types with a +json suffix use the JSON codec
+func LookupCodec(mediaType string) (Codec, bool) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	for _, codec := range codecs {
+		if strings.EqualFold(codec.MediaType(), mediaType) {
+			return codec, true
+		}
+	}
+	if strings.HasSuffix(strings.ToLower(mediaType), "+json") {
+		for _, codec := range codecs {
+			if codec.MediaType() == "application/json" {
+				return codec, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Registered media types in registration order
+func SupportedMediaTypes() []string {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	mediaTypes := make([]string, len(codecs))
+	for i, codec := range codecs {
+		mediaTypes[i] = codec.MediaType()
+	}
+	return mediaTypes
+}
+
+type acceptedCodec struct {
+	codec       Codec
+	q           float64
+	specificity int
+	index       int
+}
+
+// Codecs acceptable for an Accept header, most preferred first (all of them if not set)
+func AcceptableCodecs(accept string) []Codec {
+	codecsLock.RLock()
+	registered := append([]Codec(nil), codecs...)
+	codecsLock.RUnlock()
+	if strings.TrimSpace(accept) == "" {
+		return registered
+	}
+
+	var accepted []acceptedCodec
+	for _, codec := range registered {
+		candidate := acceptedCodec{codec: codec, specificity: -1}
+		codecType := strings.ToLower(codec.MediaType())
+		for index, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+			specificity := -1
+			switch {
+			case mediaType == codecType:
+				specificity = 2
+			case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(codecType, strings.TrimSuffix(mediaType, "*")):
+				specificity = 1
+			case mediaType == "*/*" || mediaType == "*":
+				specificity = 0
+			}
+			// The most specific range decides the quality
+			if specificity > candidate.specificity {
+				q := 1.0
+				if text, ok := params["q"]; ok {
+					if q, err = strconv.ParseFloat(text, 64); err != nil {
+						q = 0
+					}
+				}
+				candidate.q, candidate.specificity, candidate.index = q, specificity, index
+			}
+		}
+		if candidate.specificity >= 0 && candidate.q > 0 {
+			accepted = append(accepted, candidate)
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		if accepted[i].q != accepted[j].q {
+			return accepted[i].q > accepted[j].q
+		}
+		if accepted[i].specificity != accepted[j].specificity {
+			return accepted[i].specificity > accepted[j].specificity
+		}
+		return accepted[i].index < accepted[j].index
+	})
+	ret := make([]Codec, len(accepted))
+	for i, candidate := range accepted {
+		ret[i] = candidate.codec
+	}
+	return ret
+}
+
+// Encode value with the most preferred codec able to encode it, fails with ErrorNotAcceptable
+func NegotiateEncoding(accept string, value interface{}) (Codec, []byte, error) {
+	var errs []string
+	for _, codec := range AcceptableCodecs(accept) {
+		data, err := codec.Marshal(value)
+		if err == nil {
+			return codec, data, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", codec.MediaType(), err))
+	}
+	if len(errs) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s (supported: %s)", ErrorNotAcceptable, accept,
+			strings.Join(SupportedMediaTypes(), ", "))
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrorNotAcceptable, strings.Join(errs, "; "))
+}
+
+// Codec of the request body from its Content-Type (JSON if not set), fails with ErrorUnsupportedMediaType
+func RequestCodec(request *http.Request) (Codec, error) {
+	contentType := request.Header.Get("Content-Type")
+	if contentType == "" {
+		codec, _ := LookupCodec("application/json")
+		return codec, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrorUnsupportedMediaType, contentType)
+	}
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") && !strings.EqualFold(charset, "us-ascii") {
+		return nil, fmt.Errorf("%w: charset %s", ErrorUnsupportedMediaType, charset)
+	}
+	codec, found := LookupCodec(mediaType)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrorUnsupportedMediaType, mediaType)
+	}
+	return codec, nil
+}
+
+// Decode a request body into target, nil codec if the body is empty
+func decodeRequestBody(request *http.Request, body []byte, target interface{}) (Codec, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	codec, err := RequestCodec(request)
+	if err != nil {
+		panic(err)
+	}
+	if err := codec.Unmarshal(body, target); err != nil {
+		return codec, fmt.Errorf("invalid %s body: %w", codec.MediaType(), err)
+	}
+	return codec, nil
+}
+
+// Whether target is *interface{} or *map[string]interface{}, set to value if so
+func setGeneric(target interface{}, value interface{}) (bool, error) {
+	switch ptr := target.(type) {
+	case *interface{}:
+		*ptr = value
+	case *map[string]interface{}:
+		object, ok := value.(map[string]interface{})
+		if !ok && value != nil {
+			return true, fmt.Errorf("cannot decode %T into an object", value)
+		}
+		*ptr = object
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// Element name of struct fields: tag name, or field name
+func fieldName(field reflect.StructField, tags ...string) (string, bool) {
+	for _, tag := range tags {
+		if value, ok := field.Tag.Lookup(tag); ok {
+			name := strings.Split(value, ",")[0]
+			if name == "-" {
+				return "", false
+			}
+			if name != "" {
+				return name, true
+			}
+		}
+	}
+	return field.Name, true
+}
+
+// Text form of a scalar value, false if value is structured
+func scalarText(value reflect.Value) (string, bool) {
+	if !value.IsValid() {
+		return "", true
+	}
+	if marshaler, ok := value.Interface().(encoding.TextMarshaler); ok {
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			return "", true
+		}
+		text, err := marshaler.MarshalText()
+		return string(text), err == nil
+	}
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return "", true
+		}
+		return scalarText(value.Elem())
+	case reflect.String:
+		return value.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'g', -1, value.Type().Bits()), true
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return string(value.Bytes()), true
+		}
+	}
+	return "", false
+}
+
+//------------------------------
+// JSON
+
+type jsonCodec struct {
+}
+
+func (this *jsonCodec) MediaType() string {
+	return "application/json"
+}
+
+func (this *jsonCodec) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+func (this *jsonCodec) Marshal(value interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := json.NewEncoder(buffer).Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (this *jsonCodec) Unmarshal(data []byte, target interface{}) error {
+	return json.Unmarshal(data, target)
+}
+
+//------------------------------
+// XML, other than structs values are encoded as elements of <result>
+// (maps by key, slices as <item>), and decoded to maps of text
+
+type xmlCodec struct {
+	mediaType string
+}
+
+// Nesting limit of elements decoded to maps (typed targets are limited by encoding/xml)
+const xmlMaxDepth = 10000
+
+var errorXmlTooDeep = fmt.Errorf("xml data nested deeper than %d levels", xmlMaxDepth)
+
+func (this *xmlCodec) MediaType() string {
+	return this.mediaType
+}
+
+func (this *xmlCodec) ContentType() string {
+	return this.mediaType + "; charset=utf-8"
+}
+
+func (this *xmlCodec) Marshal(value interface{}) ([]byte, error) {
+	buffer := bytes.NewBufferString(xml.Header)
+	encoder := xml.NewEncoder(buffer)
+	if err := this.encode(encoder, "result", reflect.ValueOf(value)); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (this *xmlCodec) encode(encoder *xml.Encoder, name string, value reflect.Value) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	for value.IsValid() && (value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr) {
+		if value.IsNil() {
+			return encoder.EncodeElement("", start)
+		}
+		if _, ok := value.Interface().(xml.Marshaler); ok {
+			break
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return encoder.EncodeElement("", start)
+	}
+	switch value.Kind() {
+	case reflect.Map:
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			if err := this.encode(encoder, fmt.Sprint(key.Interface()), value.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := this.encode(encoder, "item", value.Index(i)); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	}
+	// Structs honor their xml tags
+	return encoder.EncodeElement(value.Interface(), start)
+}
+
+func (this *xmlCodec) Unmarshal(data []byte, target interface{}) error {
+	switch target.(type) {
+	case *interface{}, *map[string]interface{}:
+	default:
+		return xml.Unmarshal(data, target)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			value, err := this.decodeElement(decoder, 0)
+			if err != nil {
+				return err
+			}
+			if text, ok := value.(string); ok && strings.TrimSpace(text) == "" {
+				value = map[string]interface{}{}
+			}
+			_, err = setGeneric(target, value)
+			return err
+		}
+	}
+}
+
+// Text of an element without children, or map of its children (repeated ones as slices),
+// depth is the number of enclosing elements
+func (this *xmlCodec) decodeElement(decoder *xml.Decoder, depth int) (interface{}, error) {
+	if depth >= xmlMaxDepth {
+		return nil, errorXmlTooDeep
+	}
+	var text strings.Builder
+	var children map[string]interface{}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch element := token.(type) {
+		case xml.CharData:
+			text.Write(element)
+		case xml.StartElement:
+			child, err := this.decodeElement(decoder, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if children == nil {
+				children = map[string]interface{}{}
+			}
+			name := element.Name.Local
+			if existing, found := children[name]; !found {
+				children[name] = child
+			} else if list, ok := existing.([]interface{}); ok {
+				children[name] = append(list, child)
+			} else {
+				children[name] = []interface{}{existing, child}
+			}
+		case xml.EndElement:
+			if children != nil {
+				return children, nil
+			}
+			return text.String(), nil
+		}
+	}
+}
+
+//------------------------------
+// Form, structs and maps are encoded with dotted keys for nested values (as bound by the binder)
+
+type formCodec struct {
+}
+
+func (this *formCodec) MediaType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+func (this *formCodec) ContentType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+func (this *formCodec) Marshal(value interface{}) ([]byte, error) {
+	target := reflect.ValueOf(value)
+	for target.IsValid() && (target.Kind() == reflect.Interface || target.Kind() == reflect.Ptr) && !target.IsNil() {
+		target = target.Elem()
+	}
+	if !target.IsValid() || (target.Kind() != reflect.Struct && target.Kind() != reflect.Map) {
+		return nil, fmt.Errorf("cannot encode %T as form", value)
+	}
+	if _, ok := scalarText(target); ok {
+		return nil, fmt.Errorf("cannot encode %T as form", value)
+	}
+	values := url.Values{}
+	if err := this.flatten(values, "", target); err != nil {
+		return nil, err
+	}
+	return []byte(values.Encode()), nil
+}
+
+func (this *formCodec) flatten(values url.Values, key string, value reflect.Value) error {
+	if text, ok := scalarText(value); ok {
+		values.Add(key, text)
+		return nil
+	}
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	prefix := key
+	if prefix != "" {
+		prefix += "."
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.PkgPath == "" && field.Type.Kind() == reflect.Struct {
+				if err := this.flatten(values, key, value.Field(i)); err != nil {
+					return err
+				}
+				continue
+			}
+			if field.PkgPath != "" {
+				continue
+			}
+			if name, ok := fieldName(field, SourceForm, "json"); ok {
+				if err := this.flatten(values, prefix+name, value.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Map:
+		for _, mapKey := range value.MapKeys() {
+			if err := this.flatten(values, prefix+fmt.Sprint(mapKey.Interface()), value.MapIndex(mapKey)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		// Repeated keys
+		for i := 0; i < value.Len(); i++ {
+			text, ok := scalarText(value.Index(i))
+			if !ok {
+				return fmt.Errorf("cannot encode %v in %s as form", value.Type(), key)
+			}
+			values.Add(key, text)
+		}
+	default:
+		return fmt.Errorf("cannot encode %v in %s as form", value.Type(), key)
+	}
+	return nil
+}
+
+func (this *formCodec) Unmarshal(data []byte, target interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	object := map[string]interface{}{}
+	for key, value := range values {
+		object[key], _ = textParam(value)
+	}
+	if ok, err := setGeneric(target, object); ok {
+		return err
+	}
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || !isBindableStruct(value.Elem().Type()) {
+		return fmt.Errorf("cannot decode form into %T", target)
+	}
+	if bindingErr := bindBodyValues(values, value.Elem()); bindingErr != nil {
+		return bindingErr
+	}
+	return nil
+}
+
+//------------------------------
+// CSV of slices, with a header row of field names (struct elements) or keys (map elements)
+
+type csvCodec struct {
+}
+
+func (this *csvCodec) MediaType() string {
+	return "text/csv"
+}
+
+func (this *csvCodec) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (this *csvCodec) Marshal(value interface{}) ([]byte, error) {
+	rows := reflect.ValueOf(value)
+	for rows.IsValid() && (rows.Kind() == reflect.Interface || rows.Kind() == reflect.Ptr) && !rows.IsNil() {
+		rows = rows.Elem()
+	}
+	if !rows.IsValid() || (rows.Kind() != reflect.Slice && rows.Kind() != reflect.Array) || rows.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, fmt.Errorf("cannot encode %T as csv, only slices are supported", value)
+	}
+
+	// Columns of all rows in order of appearance
+	var columns []string
+	cells := make([]map[string]string, rows.Len())
+	for i := range cells {
+		var err error
+		if cells[i], columns, err = this.cells(rows.Index(i), columns); err != nil {
+			return nil, err
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	writer := csv.NewWriter(buffer)
+	writer.Write(columns)
+	for _, row := range cells {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+func (this *csvCodec) cells(row reflect.Value, columns []string) (map[string]string, []string, error) {
+	cells := map[string]string{}
+	add := func(column string, value reflect.Value) error {
+		text, ok := scalarText(value)
+		if !ok {
+			// Structured cells as JSON
+			buffer, err := json.Marshal(value.Interface())
+			if err != nil {
+				return err
+			}
+			text = string(buffer)
+		}
+		if _, found := cells[column]; !found {
+			found := false
+			for _, existing := range columns {
+				if existing == column {
+					found = true
+					break
+				}
+			}
+			if !found {
+				columns = append(columns, column)
+			}
+		}
+		cells[column] = text
+		return nil
+	}
+
+	if _, ok := scalarText(row); ok {
+		return cells, columns, add("value", row)
+	}
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+	switch row.Kind() {
+	case reflect.Struct:
+		var fields func(value reflect.Value) error
+		fields = func(value reflect.Value) error {
+			t := value.Type()
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				if field.Anonymous && field.PkgPath == "" && field.Type.Kind() == reflect.Struct {
+					if err := fields(value.Field(i)); err != nil {
+						return err
+					}
+					continue
+				}
+				if field.PkgPath != "" {
+					continue
+				}
+				if name, ok := fieldName(field, "csv", "json"); ok {
+					if err := add(name, value.Field(i)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		return cells, columns, fields(row)
+	case reflect.Map:
+		keys := row.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			if err := add(fmt.Sprint(key.Interface()), row.MapIndex(key)); err != nil {
+				return nil, nil, err
+			}
+		}
+		return cells, columns, nil
+	}
+	return nil, nil, fmt.Errorf("cannot encode %v as a csv row", row.Type())
+}
+
+// Rows are decoded to maps of text by header, or bound to struct elements
+func (this *csvCodec) Unmarshal(data []byte, target interface{}) error {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	header := records[0]
+	rows := make([]url.Values, len(records)-1)
+	list := make([]interface{}, len(rows))
+	for i, record := range records[1:] {
+		rows[i] = url.Values{}
+		object := map[string]interface{}{}
+		for j, column := range header {
+			if j < len(record) {
+				rows[i].Set(column, record[j])
+				object[column] = record[j]
+			}
+		}
+		list[i] = object
+	}
+	if ok, err := setGeneric(target, list); ok {
+		return err
+	}
+
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("cannot decode csv into %T", target)
+	}
+	sliceType := value.Elem().Type()
+	slice := reflect.MakeSlice(sliceType, len(rows), len(rows))
+	bindingErr := &BindingError{}
+	for i, row := range rows {
+		element := slice.Index(i)
+		if isBindableStruct(sliceType.Elem()) {
+			if err := bindBodyValues(row, element); err != nil {
+				for _, field := range err.Fields {
+					field.Field = fmt.Sprintf("[%d].%s", i, field.Field)
+					bindingErr.Fields = append(bindingErr.Fields, field)
+				}
+			}
+		} else if converted, err := ConvertValue(reflect.ValueOf(list[i]), sliceType.Elem()); err != nil {
+			bindingErr.add(fmt.Sprintf("[%d]", i), list[i], err)
+		} else {
+			element.Set(converted)
+		}
+	}
+	if len(bindingErr.Fields) > 0 {
+		return bindingErr
+	}
+	value.Elem().Set(slice)
+	return nil
+}
@@ -2,22 +2,126 @@ package httpd
 
 import (
 	"net/http"
+	"sync"
+	"sync/atomic"
 )
 
+// Serves requests through an interceptor chain. Interceptors given as instances are
+// initialized once (NewSimpleHttpHandler) and destroyed with the handler (Destroy, after
+// http.Server.Shutdown returns); Destroy waits for the requests being served, later ones
+// get 503. Interceptors given as factories (CreateInterceptorMethod or CreateInterceptorFunc)
+// are request-scoped: created, initialized and destroyed per request. Create handlers with
+// NewSimpleHttpHandler or NewHttpHandler, the zero value is not usable.
 type SimpleHttpHandler struct {
 	interceptors []interface{}
 	exceptionHandler interface{}
 	propertyBag PropertyBag
+
+	// Resolved by Initialize, nil at the positions of request-scoped interceptors
+	singletons []HttpInterceptor
+	// Factories of request-scoped interceptors by position, nil if there are none
+	factories []CreateInterceptorMethod
+	// Chains reused across requests
+	chains sync.Pool
+	lock sync.Mutex
+	initialized bool
+	destroyed int32
+	// Requests being served, awaited by Destroy
+	serving sync.WaitGroup
 }
 
 func (this *SimpleHttpHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
-	if chain := this.CreateHttpHandler(); chain != nil {
-		chain.Initialize(this.propertyBag)
-		defer chain.Destroy()
-		chain.ServeHTTP(response, request)
+	// Counted before the check, so Destroy either waits for the request or the request sees it
+	this.serving.Add(1)
+	defer this.serving.Done()
+	if atomic.LoadInt32(&this.destroyed) != 0 {
+		http.Error(response, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	chain := this.chains.Get().(*HttpInterceptorChainBase)
+	defer this.releaseChain(chain)
+	if this.factories != nil {
+		for i, fnCreate := range this.factories {
+			if fnCreate != nil {
+				if interceptor := fnCreate(); interceptor != nil {
+					interceptor.Initialize(this.propertyBag)
+					chain.interceptors[i] = interceptor
+				}
+			}
+		}
+	}
+	if _, ok := this.exceptionHandler.(HttpInterceptorExceptionHandler); !ok {
+		chain.exceptionHandler = this.CreateExceptionHandler()
+	}
+	chain.ServeHTTP(response, request)
+}
+
+func (this *SimpleHttpHandler) releaseChain(chain *HttpInterceptorChainBase) {
+	if this.factories != nil {
+		for i, fnCreate := range this.factories {
+			if fnCreate != nil && chain.interceptors[i] != nil {
+				chain.interceptors[i].Destroy()
+				chain.interceptors[i] = nil
+			}
+		}
 	}
+	this.chains.Put(chain)
 }
 
+func (this *SimpleHttpHandler) newChain() interface{} {
+	interceptors := this.singletons
+	if this.factories != nil {
+		// Own slots for the request-scoped interceptors
+		interceptors = append([]HttpInterceptor(nil), this.singletons...)
+	}
+	exceptionHandler, _ := this.exceptionHandler.(HttpInterceptorExceptionHandler)
+	return &HttpInterceptorChainBase{
+		interceptors: interceptors,
+		exceptionHandler: exceptionHandler,
+	}
+}
+
+// Initialize the interceptors given as instances, once
+func (this *SimpleHttpHandler) Initialize(propertyBag PropertyBag) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.initialized {
+		return
+	}
+	this.propertyBag = propertyBag
+	this.singletons = make([]HttpInterceptor, len(this.interceptors))
+	for i, object := range this.interceptors {
+		if interceptor, ok := object.(HttpInterceptor); ok {
+			interceptor.Initialize(propertyBag)
+			this.singletons[i] = interceptor
+		} else if fnCreate := this.interceptorFactory(object); fnCreate != nil {
+			if this.factories == nil {
+				this.factories = make([]CreateInterceptorMethod, len(this.interceptors))
+			}
+			this.factories[i] = fnCreate
+		}
+	}
+	this.chains.New = this.newChain
+	this.initialized = true
+}
+
+// Destroy the interceptors given as instances once the requests being served complete;
+// the handler does not serve afterwards
+func (this *SimpleHttpHandler) Destroy() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if !this.initialized || !atomic.CompareAndSwapInt32(&this.destroyed, 0, 1) {
+		return
+	}
+	this.serving.Wait()
+	for _, interceptor := range this.singletons {
+		if interceptor != nil {
+			interceptor.Destroy()
+		}
+	}
+}
+
+// Chain with new instances of all interceptors (request-scoped or not)
 func (this *SimpleHttpHandler) CreateHttpHandler() HttpInterceptorChain {
 	realInterceptors := make([]HttpInterceptor, 0)
 	for _, interceptor := range this.interceptors {
@@ -31,34 +135,53 @@ func (this *SimpleHttpHandler) CreateHttpHandler() HttpInterceptorChain {
 }
 
 func (this *SimpleHttpHandler) CreateHttpInterceptor(object interface{}) HttpInterceptor {
-	var interceptor HttpInterceptor = nil
-	var ok = false
-	if interceptor, ok = object.(HttpInterceptor); !ok {
-		var fnCreate CreateInterceptorMethod = nil
-		if fnCreate, ok = this.exceptionHandler.(CreateInterceptorMethod); ok {
-			interceptor = fnCreate()
-		}
+	if interceptor, ok := object.(HttpInterceptor); ok {
+		return interceptor
 	}
-	return interceptor
+	if fnCreate := this.interceptorFactory(object); fnCreate != nil {
+		return fnCreate()
+	}
+	return nil
+}
+
+func (this *SimpleHttpHandler) interceptorFactory(object interface{}) CreateInterceptorMethod {
+	switch fnCreate := object.(type) {
+	case CreateInterceptorMethod:
+		return fnCreate
+	case CreateInterceptorFunc:
+		return CreateInterceptorMethod(fnCreate)
+	case func() HttpInterceptor:
+		return fnCreate
+	}
+	return nil
 }
 
 func (this *SimpleHttpHandler) CreateExceptionHandler() HttpInterceptorExceptionHandler {
 	var handler HttpInterceptorExceptionHandler = nil
 	var ok = false
 	if handler, ok = this.exceptionHandler.(HttpInterceptorExceptionHandler); !ok {
-		var fnCreate CreateInterceptorExceptionHandlerMethod = nil
-		if fnCreate, ok = this.exceptionHandler.(CreateInterceptorExceptionHandlerMethod); ok {
+		switch fnCreate := this.exceptionHandler.(type) {
+		case CreateInterceptorExceptionHandlerMethod:
+			handler = fnCreate()
+		case func() HttpInterceptorExceptionHandler:
 			handler = fnCreate()
 		}
 	}
 	return handler
 }
 
+// Handler with its interceptors initialized, see NewSimpleHttpHandler to destroy them on shutdown
 func NewHttpHandler(interceptors []interface{}, exceptionHandler interface{}, propertyBag PropertyBag) http.Handler {
+	return NewSimpleHttpHandler(interceptors, exceptionHandler, propertyBag)
+}
+
+// Handler with its interceptors initialized, call Destroy on shutdown
+// (after http.Server.Shutdown returns)
+func NewSimpleHttpHandler(interceptors []interface{}, exceptionHandler interface{}, propertyBag PropertyBag) *SimpleHttpHandler {
 	handler := SimpleHttpHandler{
-		interceptors,
-		exceptionHandler,
-		propertyBag,
+		interceptors: interceptors,
+		exceptionHandler: exceptionHandler,
 	}
+	handler.Initialize(propertyBag)
 	return &handler
 }
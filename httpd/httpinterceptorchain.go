@@ -13,14 +13,17 @@ var (
 	ErrorInterceptorNameNotFound = errors.New("interceptor name not found")
 )
 
+// Chain of one request, advancing by index (interceptors calling DoChain run the next one)
 type HttpInterceptorChainBase struct {
 	interceptors []HttpInterceptor
 	exceptionHandler HttpInterceptorExceptionHandler
+	index int
 }
 
 func (this *HttpInterceptorChainBase) ServeHTTP(response http.ResponseWriter, request *http.Request) {
 	// Create request context
 	context := NewHttpRequestContext()
+	this.index = 0
 
 	defer func() {
 		if exception := recover(); exception != nil {
@@ -45,10 +48,13 @@ func (this *HttpInterceptorChainBase) Destroy() {
 }
 
 func (this *HttpInterceptorChainBase) DoChain(request *http.Request, response http.ResponseWriter, context HttpRequestContext) {
-	if len(this.interceptors) > 0 {
-		interceptor := this.interceptors[0]
-		chain := this.CloneNext()
-		interceptor.Intercept(chain, request, response, context)
+	for this.index < len(this.interceptors) {
+		interceptor := this.interceptors[this.index]
+		this.index++
+		if interceptor != nil {
+			interceptor.Intercept(this, request, response, context)
+			return
+		}
 	}
 }
 
@@ -58,21 +64,10 @@ func (this *HttpInterceptorChainBase) HandleException(request *http.Request, res
 	}
 }
 
-func (this *HttpInterceptorChainBase) CloneNext() HttpInterceptorChain {
-	var interceptors []HttpInterceptor
-	if len(this.interceptors) > 1 {
-		interceptors = this.interceptors[1:]
-	}
-	chain := HttpInterceptorChainBase{
-		interceptors: interceptors,
-	}
-	return &chain
-}
-
 func NewHttpInterceptorChain(interceptors []HttpInterceptor, exceptionHandler HttpInterceptorExceptionHandler) HttpInterceptorChain {
 	chain := HttpInterceptorChainBase{
-		interceptors,
-		exceptionHandler,
+		interceptors: interceptors,
+		exceptionHandler: exceptionHandler,
 	}
 	return &chain
 }
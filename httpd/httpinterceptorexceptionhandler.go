@@ -16,6 +16,10 @@ type HttpInterceptorExceptionHandlerBase struct {
 func (this *HttpInterceptorExceptionHandlerBase) HandleException(request *http.Request, response http.ResponseWriter,
 	context HttpRequestContext, exception interface{}) {
 	this.PrintStackTrace(request, response, context, exception)
+	// Errors are mapped to their status (see RegisterErrorStatus)
+	if err, ok := exception.(error); ok {
+		exception = ErrorToException(err)
+	}
 	if err, ok := exception.(HttpInterceptorException); ok {
 		this.HandleInterceptorException(request, response, context, err)
 	} else {
@@ -43,7 +47,9 @@ func (this *HttpInterceptorExceptionHandlerBase) HandleInterceptorException(requ
 	context HttpRequestContext, exception HttpInterceptorException) {
 	outputMap := make(map[string]interface{})
 
-	if statusCode, ok := exception.Status(); ok {
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	statusCode, ok := exception.Status()
+	if ok {
 		response.WriteHeader(statusCode)
 		outputMap["statusCode"] = statusCode
 	}
@@ -52,13 +58,17 @@ func (this *HttpInterceptorExceptionHandlerBase) HandleInterceptorException(requ
 		outputMap["content"] = content
 	}
 
-	if cause := exception.Cause(); cause != nil {
-		outputMap["cause"] = cause
-	}
+	// Server errors may expose internals (driver errors, paths), their cause and stack
+	// are logged only (see PrintStackTrace)
+	if ok && statusCode < http.StatusInternalServerError {
+		if cause := exception.Cause(); cause != nil {
+			outputMap["cause"] = cause
+		}
 
-	stackBytes := debug.Stack()
-	stackText := string(stackBytes)
-	outputMap["stack"] = strings.Split(stackText, "\n")
+		stackBytes := debug.Stack()
+		stackText := string(stackBytes)
+		outputMap["stack"] = strings.Split(stackText, "\n")
+	}
 
 	encoder := json.NewEncoder(response)
 	encoder.Encode(outputMap)
@@ -68,11 +78,11 @@ func (this *HttpInterceptorExceptionHandlerBase) HandleOtherException(request *h
 	context HttpRequestContext, exception interface{}) {
 	outputMap := make(map[string]interface{})
 
-	outputMap["exception"] = exception
-
-	stackBytes := debug.Stack()
-	stackText := string(stackBytes)
-	outputMap["stack"] = strings.Split(stackText, "\n")
+	// The exception and stack are logged only (see PrintStackTrace)
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response.WriteHeader(http.StatusInternalServerError)
+	outputMap["statusCode"] = http.StatusInternalServerError
+	outputMap["content"] = http.StatusText(http.StatusInternalServerError)
 
 	encoder := json.NewEncoder(response)
 	encoder.Encode(outputMap)
@@ -0,0 +1,130 @@
+package httpd
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/umeframework/gear/orm"
+)
+
+// Explicit response returned by handlers, for statuses other than 200, headers and redirects
+type HttpResponse struct {
+	Status int
+	Header http.Header
+	// Rendered as the result if not nil
+	Body interface{}
+}
+
+func NewHttpResponse(status int, body interface{}) *HttpResponse {
+	return &HttpResponse{Status: status, Header: http.Header{}, Body: body}
+}
+
+// 201 with the location of the created resource
+func Created(location string, body interface{}) *HttpResponse {
+	return NewHttpResponse(http.StatusCreated, body).SetHeader("Location", location)
+}
+
+// 204 without body
+func NoContent() *HttpResponse {
+	return NewHttpResponse(http.StatusNoContent, nil)
+}
+
+// Redirect to location, status is one of the 3xx codes (302 if 0)
+func Redirect(location string, status int) *HttpResponse {
+	if status == 0 {
+		status = http.StatusFound
+	}
+	return NewHttpResponse(status, nil).SetHeader("Location", location)
+}
+
+func (this *HttpResponse) SetHeader(key string, value string) *HttpResponse {
+	if this.Header == nil {
+		this.Header = http.Header{}
+	}
+	this.Header.Set(key, value)
+	return this
+}
+
+func (this *HttpResponse) status() int {
+	if this.Status == 0 {
+		return http.StatusOK
+	}
+	return this.Status
+}
+
+// Whether the body is rendered (not for HEAD, 204 and 304)
+func (this *HttpResponse) hasBody(request *http.Request) bool {
+	status := this.status()
+	return this.Body != nil && request.Method != http.MethodHead &&
+		status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func (this *HttpResponse) copyHeader(response http.ResponseWriter) {
+	for key, values := range this.Header {
+		response.Header()[key] = values
+	}
+}
+
+//------------------------------
+// Error to status mapping
+
+// Maps an error to a status, false if the error is not recognized
+type ErrorStatusMapper func(err error) (int, bool)
+
+var (
+	errorStatusMappers     []ErrorStatusMapper
+	errorStatusMappersLock sync.RWMutex
+)
+
+func init() {
+	RegisterErrorStatus(orm.ErrorRecordNotFound, http.StatusNotFound)
+	RegisterErrorStatus(sql.ErrNoRows, http.StatusNotFound)
+	RegisterErrorStatus(orm.ErrorTenantRequired, http.StatusBadRequest)
+	RegisterErrorStatus(orm.ErrorInvalidTenant, http.StatusBadRequest)
+}
+
+// Map errors matching target (errors.Is) to status
+func RegisterErrorStatus(target error, status int) {
+	RegisterErrorMapper(func(err error) (int, bool) {
+		return status, errors.Is(err, target)
+	})
+}
+
+// Add a mapper, mappers registered later take precedence
+func RegisterErrorMapper(mapper ErrorStatusMapper) {
+	errorStatusMappersLock.Lock()
+	defer errorStatusMappersLock.Unlock()
+	errorStatusMappers = append(errorStatusMappers, mapper)
+}
+
+// Convert an error to an exception carrying its status (500 with a generic message if not mapped)
+func ErrorToException(err error) HttpInterceptorException {
+	var exception HttpInterceptorException
+	if errors.As(err, &exception) {
+		return exception
+	}
+	var ormValidationErr *orm.ValidationError
+	if errors.As(err, &ormValidationErr) {
+		return NewInterceptorException(err, http.StatusBadRequest, ormValidationErr.Fields)
+	}
+	var bindingErr *BindingError
+	if errors.As(err, &bindingErr) {
+		return NewInterceptorException(err, http.StatusBadRequest, bindingErr.Fields)
+	}
+	var validationErr *RequestValidationError
+	if errors.As(err, &validationErr) {
+		return NewInterceptorException(err, http.StatusBadRequest, validationErr.Fields)
+	}
+
+	errorStatusMappersLock.RLock()
+	defer errorStatusMappersLock.RUnlock()
+	for i := len(errorStatusMappers) - 1; i >= 0; i-- {
+		if status, ok := errorStatusMappers[i](err); ok {
+			return NewInterceptorException(err, status, err.Error())
+		}
+	}
+	// Messages of unmapped errors may expose internals, they are logged only
+	return NewInterceptorException(err, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
@@ -62,6 +62,7 @@ type ServicePoint struct {
 	UrlPattern string
 	Methods []string
 	handler interface{}
+	plan *invocationPlan
 }
 
 type HttpRequestResult interface {
@@ -77,4 +78,5 @@ var (
 	HttpRequestContextType = reflect.TypeOf((*HttpRequestContext)(nil)).Elem()
 	ServicePointType = reflect.TypeOf((*ServicePoint)(nil)).Elem()
 	HttpRequestResultType = reflect.TypeOf((*HttpRequestResult)(nil)).Elem()
+	HttpRequestPathParamType = reflect.TypeOf(HttpRequestPathParam{})
 )
@@ -10,30 +10,42 @@ import (
 	"bytes"
 	"io"
 	"fmt"
-	"strconv"
 )
 
 var (
-	servicePoints []ServicePoint
+	servicePointRouter = NewRouter()
+	ErrorMethodNotAllowed = errors.New("method not allowed")
+
+	// Limit of request bodies other than multipart uploads (see MaxUploadSize), 0 for no limit
+	MaxRequestBodySize int64 = 10 << 20
 )
 
 type combinedParamsType map[string]interface{}
 
 func NewServicePoint(urlPattern string, methods []string, handler interface{}) {
 	servicePoint := ServicePoint{
-		urlPattern,
-		methods,
-		handler,
+		UrlPattern: urlPattern,
+		Methods: methods,
+		handler: handler,
 	}
-	servicePoints = append(servicePoints, servicePoint)
+	// Resolve handler arguments and validation rules up front
+	if plan := servicePoint.invocationPlan(); plan != nil {
+		visited := map[reflect.Type]bool{}
+		for i, kind := range plan.kinds {
+			if kind == argumentDto {
+				prepareValidations(plan.types[i], visited)
+			}
+		}
+	}
+	servicePointRouter.Add(&servicePoint)
 }
 
 type InvocationInterceptor struct {
-	
+	propertyBag PropertyBag
 }
 
-func (this *InvocationInterceptor) Initialize(PropertyBag) {
-	// foo
+func (this *InvocationInterceptor) Initialize(propertyBag PropertyBag) {
+	this.propertyBag = propertyBag
 }
 
 func (this InvocationInterceptor) Destroy() {
@@ -41,7 +53,19 @@ func (this InvocationInterceptor) Destroy() {
 }
 
 func (this *InvocationInterceptor) Intercept(chain HttpInterceptorChain, request *http.Request, response http.ResponseWriter, context HttpRequestContext) {
-	if servicePoint := this.FindServicePoint(request); servicePoint != nil {
+	servicePoint, pathParams, allow := this.RouteServicePoint(request)
+	if servicePoint == nil && allow != nil {
+		response.Header().Set("Allow", strings.Join(allow, ", "))
+		if request.Method != http.MethodOptions {
+			panic(NewInterceptorException(ErrorMethodNotAllowed, http.StatusMethodNotAllowed, allow))
+		}
+		response.WriteHeader(http.StatusNoContent)
+	}
+	if servicePoint != nil {
+		// Path params for binding (request) and for handlers (context)
+		request = requestWithPathParams(request, pathParams)
+		context.SetInterface(HttpRequestPathParamType, pathParams)
+
 		// Run services point handler
 		if result, ok := this.Invocate(request, response, context, servicePoint); ok {
 			// Save result to context (for succeeding interceptor)
@@ -53,28 +77,18 @@ func (this *InvocationInterceptor) Intercept(chain HttpInterceptorChain, request
 }
 
 func (this *InvocationInterceptor) FindServicePoint(request *http.Request) *ServicePoint {
-	var ret *ServicePoint = nil
-
-	for _, servicePoint := range servicePoints {
-		if this.MatchServicePoint(request, &servicePoint) {
-			ret = &servicePoint
-			break
-		}
-	}
+	servicePoint, _, _ := this.RouteServicePoint(request)
+	return servicePoint
+}
 
-	return ret
+// Service point and path params for the request, or the allowed methods if only the path matches
+func (this *InvocationInterceptor) RouteServicePoint(request *http.Request) (*ServicePoint, HttpRequestPathParam, []string) {
+	return servicePointRouter.Match(request.Method, request.URL.Path)
 }
 
 func (this *InvocationInterceptor) MatchServicePoint(request *http.Request, servicePoint *ServicePoint) bool {
-	// Match URL path only at present.
-	// TODO: Extend to a full match check
-	url := request.URL.Path
-	if strings.ToLower(url) != strings.ToLower(servicePoint.UrlPattern) {
-		return false
-	}
-
-	// Exit
-	return true
+	found, _, _ := this.RouteServicePoint(request)
+	return found == servicePoint
 }
 
 func (this *InvocationInterceptor) Invocate(request *http.Request, response http.ResponseWriter,
@@ -85,18 +99,22 @@ func (this *InvocationInterceptor) Invocate(request *http.Request, response http
 
 	if httpHandler, ok := handler.(http.Handler); ok {
 		httpHandler.ServeHTTP(response, request)
-	} else if httpHandlerFunc, ok := handler.(http.HandlerFunc); ok {
-		httpHandlerFunc(response, request)
 	} else {
+		plan := servicePoint.invocationPlan()
 		handlerWrapper := reflect.ValueOf(handler)
-		if handlerWrapper.Kind() != reflect.Func {
-			// TODO: throws some exception here
+		if isMultipartRequest(request) {
+			request = this.PrepareUploads(request, response)
+			defer this.CleanupUploads(request)
 		}
 
-		hasReturn = true
 		args := this.PrepareInvocationArgs(request, response, context, servicePoint, handlerWrapper)
-		if outputs := handlerWrapper.Call(args); outputs != nil && len(outputs) > 0 {
-			ret = outputs[0].Interface()
+		outputs := handlerWrapper.Call(args)
+		if plan.errorIndex >= 0 && !outputs[plan.errorIndex].IsNil() {
+			// Mapped to a status by the exception handler
+			panic(outputs[plan.errorIndex].Interface().(error))
+		}
+		if plan.resultIndex >= 0 {
+			ret, hasReturn = outputs[plan.resultIndex].Interface(), true
 		}
 
 	}
@@ -107,83 +125,106 @@ func (this *InvocationInterceptor) Invocate(request *http.Request, response http
 
 func (this *InvocationInterceptor) PrepareInvocationArgs(request *http.Request, response http.ResponseWriter,
 	context HttpRequestContext, servicePoint *ServicePoint, handler reflect.Value) []reflect.Value {
-	var args []reflect.Value = nil
+	plan := servicePoint.invocationPlan()
+	args := make([]reflect.Value, len(plan.kinds))
+
+	// Injected arguments
+	hasInputs := false
+	for i, kind := range plan.kinds {
+		switch kind {
+		case argumentContext:
+			args[i] = reflect.ValueOf(request.Context())
+		case argumentRequestContext:
+			args[i] = reflect.ValueOf(context)
+		case argumentRequest:
+			args[i] = reflect.ValueOf(request)
+		case argumentResponse:
+			args[i] = reflect.ValueOf(response)
+		case argumentPathParams:
+			args[i] = reflect.ValueOf(requestPathParams(request))
+		case argumentMultipart:
+			args[i] = reflect.ValueOf(this.MultipartReader(request))
+		case argumentOrmContext:
+			args[i] = this.ResolveOrmContext(context, request)
+		case argumentService:
+			args[i] = this.ResolveService(context, plan.types[i])
+		default:
+			hasInputs = true
+		}
+	}
+	if !hasInputs {
+		return args
+	}
 
+	// Input arguments
 	params := this.PrepareParams(request, servicePoint)
-	switch(request.Method) {
-	case http.MethodGet:
-		args = this.PrepareInvocationArgs_DTO(request, context, servicePoint, handler, params, nil, nil)
-	default:
-		requestBodyBuffer := this.BackupRequestBody(request)
-		requestBody := this.GetRequestBody(requestBodyBuffer)
-		requestBodyValue := reflect.ValueOf(requestBody)
-		if requestBodyValue.Kind() == reflect.Slice || requestBodyValue.Kind() == reflect.Array {
-			args = this.PrepareInvocationArgs_Array(request, context, servicePoint, handler, params, requestBody,
-				requestBodyBuffer)
-		} else {
-			args = this.PrepareInvocationArgs_DTO(request, context, servicePoint, handler, params, requestBody,
-				requestBodyBuffer)
-		}
+	var requestBody interface{}
+	var requestBodyBuffer *bytes.Buffer
+	if request.Method != http.MethodGet && !isMultipartRequest(request) {
+		requestBodyBuffer = this.BackupRequestBody(request, response)
+		requestBody = this.GetRequestBody(request, requestBodyBuffer)
+	}
+	if plan.ordered > 0 {
+		this.PrepareInvocationArgs_Array(request, plan, params, requestBody, requestBodyBuffer, args)
+	} else {
+		this.PrepareInvocationArgs_DTO(request, plan, params, requestBody, requestBodyBuffer, args)
 	}
 
 	// Exit
 	return args
 }
 
-func (this *InvocationInterceptor) PrepareInvocationArgs_DTO(request *http.Request,
-	context HttpRequestContext, servicePoint *ServicePoint, handler reflect.Value,
-	params combinedParamsType, requestBody interface{}, requestBodyBuffer *bytes.Buffer) []reflect.Value {
-	// Prepare for each argument
-	handlerType := handler.Type()
-	argCount := handlerType.NumIn()
-	args := make([]reflect.Value, argCount)
-
-	// Set context for the 1st argument
-	args[0] = reflect.ValueOf(context)
-
-	// Convert 2nd argument as DTO
-	if argCount != 2 {
-		panic(errors.New("only 2 arguments are supported"))
+func (this *InvocationInterceptor) PrepareInvocationArgs_DTO(request *http.Request, plan *invocationPlan,
+	params combinedParamsType, requestBody interface{}, requestBodyBuffer *bytes.Buffer, args []reflect.Value) {
+	var body []byte
+	if requestBodyBuffer != nil {
+		body = requestBodyBuffer.Bytes()
 	}
-	argType := handlerType.In(1)
-	if argType.Kind() == reflect.Map {
-		// Combine params
-		this.MergeRequestBody(params, requestBody)
-
-		// Convert combined params to target
-		args[1] = reflect.ValueOf(params)
-	} else if argType.Kind() == reflect.Struct {
-		// Create instance
-		arg := reflect.New(argType)
-
-		// Combine params (map) to arg
-		value := arg.Elem()
-		t := value.Type()
-		fieldCount := value.NumField()
-		for i := 0; i < fieldCount; i++ {
-			fieldInfo := t.Field(i)
-			fieldName := strings.ToUpper(fieldInfo.Name)
-			if fieldParam, ok := params[fieldName]; ok {
-				fieldValue := this.ConvertType(reflect.ValueOf(fieldParam), fieldInfo.Type)
-				fmt.Println("fieldValue: ", fieldValue.Interface())
-				value.Field(i).Set(fieldValue)
+	for i, kind := range plan.kinds {
+		argType := plan.types[i]
+		switch kind {
+		case argumentMap:
+			// Combine params
+			this.MergeRequestBody(params, requestBody)
+
+			// Convert combined params to target
+			args[i] = this.ConvertType(reflect.ValueOf(params), argType)
+		case argumentList:
+			// Whole array body
+			list := reflect.New(argType)
+			if argType.Elem() == interfaceType {
+				if requestBody != nil {
+					args[i] = this.ConvertType(reflect.ValueOf(requestBody), argType)
+					continue
+				}
+			} else {
+				bindingErr := &BindingError{}
+				bindBody(request, body, list.Interface(), bindingErr)
+				bindingErr.check()
+			}
+			args[i] = list.Elem()
+		case argumentDto:
+			// Bind path, query, form, headers, cookies and json body to arg
+			isPtr := argType.Kind() == reflect.Ptr
+			if isPtr {
+				argType = argType.Elem()
+			}
+			arg := reflect.New(argType)
+			if bindingErr := BindRequest(request, body, arg.Elem()); bindingErr != nil {
+				bindingErr.check()
 			}
-		}
 
-		// Combine from Json
-		if requestBodyBuffer != nil {
-			decoder := json.NewDecoder(bytes.NewReader(requestBodyBuffer.Bytes()))
-			decoder.Decode(arg.Interface())
+			// Validate before calling the handler
+			if validationErr := ValidateStruct(arg.Elem()); validationErr != nil {
+				validationErr.check()
+			}
+			if isPtr {
+				args[i] = arg
+			} else {
+				args[i] = arg.Elem()
+			}
 		}
-
-		// Add to args array
-		args[1] = arg.Elem()
-	} else {
-		panic(errors.New("unspported type for 2nd argument: " + argType.Name()))
 	}
-
-	// Exit
-	return args
 }
 
 func (this *InvocationInterceptor) MergeRequestBody(params combinedParamsType, requestBody interface{}) {
@@ -202,88 +243,48 @@ var (
 	interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
 )
 
-func (this *InvocationInterceptor) PrepareInvocationArgs_Array(request *http.Request,
-	context HttpRequestContext, servicePoint *ServicePoint, handler reflect.Value,
-	params combinedParamsType, requestBody interface{}, requestBodyBuffer *bytes.Buffer) []reflect.Value {
-	// Prepare for each argument
-	handlerType := handler.Type()
-	argCount := handlerType.NumIn()
-	args := make([]reflect.Value, argCount)
-
-	// Set context for the 1st argument
-	args[0] = reflect.ValueOf(context)
-
-	// Set 2nd argument for slice/array types
-	if argCount == 2 {
-		// Only one argument left, check what it is
-		argType := handlerType.In(1)
-		if argType.Kind() == reflect.Slice || argType.Kind() == reflect.Array {
-			// Distinct []interface{} with []type
-			elemType := argType.Elem()
-			if elemType == interfaceType {
-				// Use request body direct
-				args[1] = reflect.ValueOf(requestBody)
-			} else {
-				// Re-parse from request body buffer
-				decoder := json.NewDecoder(bytes.NewReader(requestBodyBuffer.Bytes()))
-				list := reflect.New(argType)
-				decoder.Decode(list.Interface())
-				args[1] = list.Elem()
-			}
-			return args
-		}
-	}
-
-	// Set other arguments as ordered ones
+// Set ordered arguments from the elements of a json array body
+func (this *InvocationInterceptor) PrepareInvocationArgs_Array(request *http.Request, plan *invocationPlan,
+	params combinedParamsType, requestBody interface{}, requestBodyBuffer *bytes.Buffer, args []reflect.Value) {
 	requestBodyValue := reflect.ValueOf(requestBody)
-	for i := 1; i < argCount; i++ {
-		argType := handlerType.In(i)
-		requestBodyItemValue := requestBodyValue.Index(i - 1).Elem()
-		arg := this.ConvertType(requestBodyItemValue, argType)
-		args[i] = arg
+	bindingErr := &BindingError{}
+	if requestBodyValue.Kind() != reflect.Slice {
+		bindingErr.add("", nil, errors.New("request body must be a json array"))
+		bindingErr.check()
 	}
-
-	// Exit
-	return args
+	if requestBodyValue.Len() != plan.ordered {
+		bindingErr.add("", requestBody, fmt.Errorf("expected %d arguments, got %d", plan.ordered, requestBodyValue.Len()))
+		bindingErr.check()
+	}
+	index := 0
+	for i, kind := range plan.kinds {
+		if kind != argumentOrdered {
+			continue
+		}
+		requestBodyItemValue := requestBodyValue.Index(index)
+		if arg, err := ConvertValue(requestBodyItemValue, plan.types[i]); err != nil {
+			bindingErr.add(fmt.Sprintf("[%d]", index), requestBodyItemValue.Interface(), err)
+		} else {
+			args[i] = arg
+		}
+		index++
+	}
+	bindingErr.check()
 }
 
-func (this *InvocationInterceptor) ConvertType(value reflect.Value, t reflect.Type) (ret reflect.Value) {
-	defer func() {
-		if err := recover(); err != nil {
-			ret = this.ConvertAsJson(value, t)
-		}
-	}()
-
-	fmt.Println("value.type = ", value.Type())
-	fmt.Println("t (target type) = ", t)
-
-	// TODO: implement a conversion system
-	if value.Type() == t {
-		ret = value
-	} else if value.Kind() == reflect.String {
-		// Special handling for string conversion
-		str := value.Interface().(string)
-		ret = this.ConvertStringType(str, t)
-	} else {
-		ret = value.Convert(t)
+// Convert value to type t, panics with a 400 exception if not convertible
+func (this *InvocationInterceptor) ConvertType(value reflect.Value, t reflect.Type) reflect.Value {
+	ret, err := ConvertValue(value, t)
+	if err != nil {
+		bindingErr := &BindingError{}
+		bindingErr.add("", value.Interface(), err)
+		bindingErr.check()
 	}
 	return ret
 }
 
 func (this *InvocationInterceptor) ConvertStringType(str string, t reflect.Type) reflect.Value {
-	var ret reflect.Value
-	var value interface{} = nil
-	var useValue = true
-	switch(t.Kind()) {
-	case reflect.Int:
-		value, _ = strconv.Atoi(str)
-	case reflect.Uint:
-		value, _ = strconv.ParseUint(str, 10, 0)
-	}
-	if useValue {
-		ret = reflect.ValueOf(value)
-	}
-	return ret
+	return this.ConvertType(reflect.ValueOf(str), t)
 }
 
 func (this *InvocationInterceptor) ConvertAsJson(value reflect.Value, t reflect.Type) (ret reflect.Value) {
@@ -298,7 +299,7 @@ func (this *InvocationInterceptor) ConvertAsJson(value reflect.Value, t reflect.
 	decoder.Decode(temp.Interface())
 
 	// Exit
-	ret = temp
+	ret = temp.Elem()
 	return ret
 }
 
@@ -324,15 +325,20 @@ func (this *InvocationInterceptor) PrepareParams(request *http.Request,
 	params := url.Values{}
 
 	request.ParseForm()
+	// Multipart bodies are parsed unless streamed by the handler
+	if plan := servicePoint.invocationPlan(); isMultipartRequest(request) && (plan == nil || !plan.streaming) {
+		this.ParseMultipartForm(request)
+	}
 	queryParams := this.GetQueryParams(request)
 	//formParams := this.GetFormParams(request)
 	postFormParams := this.GetPostFormParams(request)
 	pathParams := this.GetPathParams(request, servicePoint)
 
-	this.MergeParams2(pathParams, params)
 	this.MergeParams(queryParams, params)
 	//this.MergeParams(formParams, params)
 	this.MergeParams(postFormParams, params)
+	// Path params are part of the route and win over query/form params
+	this.MergeParams2(pathParams, params)
 
 	normalizedParams := this.NormalizeParams(params)
 	return normalizedParams
@@ -351,7 +357,7 @@ func (this *InvocationInterceptor) MergeParams2(source map[string]string, target
 }
 
 func (this *InvocationInterceptor) GetPathParams(request *http.Request, servicePoint *ServicePoint) HttpRequestPathParam {
-	return HttpRequestPathParam{}
+	return requestPathParams(request)
 }
 
 func (this *InvocationInterceptor) GetQueryParams(request *http.Request) url.Values {
@@ -366,19 +372,36 @@ func (this *InvocationInterceptor) GetPostFormParams(request *http.Request) url.
 	return request.PostForm
 }
 
-func (this *InvocationInterceptor) BackupRequestBody(request *http.Request) *bytes.Buffer {
+// Read the request body, panics with 413 if it exceeds MaxRequestBodySize
+func (this *InvocationInterceptor) BackupRequestBody(request *http.Request, response http.ResponseWriter) *bytes.Buffer {
+	body := request.Body
+	if MaxRequestBodySize > 0 {
+		body = http.MaxBytesReader(response, body, MaxRequestBodySize)
+	}
 	buffer := bytes.NewBuffer(nil)
-	io.Copy(buffer, request.Body)
+	if _, err := io.Copy(buffer, body); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			// Mapped to 413
+			panic(fmt.Errorf("request body exceeds %d bytes: %w", maxBytesErr.Limit, err))
+		}
+		bindingErr := &BindingError{}
+		bindingErr.add("", nil, fmt.Errorf("cannot read request body: %v", err))
+		bindingErr.check()
+	}
 
 	// Exit
 	return buffer
 }
 
-func (this *InvocationInterceptor) GetRequestBody(buffer *bytes.Buffer) interface{} {
+// Decode the request body with the codec of its Content-Type (see RegisterCodec)
+func (this *InvocationInterceptor) GetRequestBody(request *http.Request, buffer *bytes.Buffer) interface{} {
 	var requestBody interface{}
-	reader := bytes.NewReader(buffer.Bytes())
-	decoder := json.NewDecoder(reader)
-	decoder.Decode(&requestBody)
+	if _, err := decodeRequestBody(request, buffer.Bytes(), &requestBody); err != nil {
+		bindingErr := &BindingError{}
+		bindingErr.add("", nil, err)
+		bindingErr.check()
+	}
 	return requestBody
 }
 
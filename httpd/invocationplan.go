@@ -0,0 +1,206 @@
+package httpd
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/umeframework/gear/orm"
+)
+
+// How a handler argument is resolved
+type argumentKind int
+
+const (
+	// Injected by type
+	argumentContext argumentKind = iota
+	argumentRequestContext
+	argumentRequest
+	argumentResponse
+	argumentPathParams
+	// *multipart.Reader, for handlers streaming the parts of an upload
+	argumentMultipart
+	// orm.OrmContext registered as a service, bound to the request context
+	argumentOrmContext
+	// Interface and pointer types registered with RegisterService, looked up by type in
+	// the request context, then in the handler PropertyBag (SetInterface), then in the
+	// registered services
+	argumentService
+	// Struct or pointer to struct bound from path, query, form, headers, cookies and json body
+	argumentDto
+	// Map of all params merged with the json body
+	argumentMap
+	// Slice bound from a json array body
+	argumentList
+	// Ordered arguments taken from the elements of a json array body
+	argumentOrdered
+)
+
+var (
+	stdContextType     = reflect.TypeOf((*stdcontext.Context)(nil)).Elem()
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+	ormContextType     = reflect.TypeOf(orm.OrmContext{})
+
+	services     = map[reflect.Type]interface{}{}
+	servicesLock sync.RWMutex
+)
+
+// Register a service injected into handler arguments of type t (an interface, a pointer
+// or orm.OrmContext), must be called before NewServicePoint. Request contexts and the
+// handler PropertyBag may override it per request or per handler with SetInterface.
+func RegisterService(t reflect.Type, service interface{}) {
+	if service == nil || !reflect.TypeOf(service).AssignableTo(t) {
+		panic(fmt.Errorf("service %T is not assignable to %v", service, t))
+	}
+	servicesLock.Lock()
+	defer servicesLock.Unlock()
+	services[t] = service
+}
+
+func lookupService(t reflect.Type) (interface{}, bool) {
+	servicesLock.RLock()
+	defer servicesLock.RUnlock()
+	service, found := services[t]
+	return service, found
+}
+
+// Argument list of a handler, resolved once at registration
+type invocationPlan struct {
+	kinds   []argumentKind
+	types   []reflect.Type
+	ordered int
+	// The body is read by the handler (multipart stream)
+	streaming bool
+	// Index of the result to render and of the trailing error return, -1 if none
+	resultIndex int
+	errorIndex  int
+}
+
+func newInvocationPlan(handlerType reflect.Type) (*invocationPlan, error) {
+	if handlerType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("handler must be a function, http.Handler or http.HandlerFunc: %v", handlerType)
+	}
+	plan := &invocationPlan{resultIndex: -1, errorIndex: -1}
+	outputs := handlerType.NumOut()
+	if outputs > 0 && handlerType.Out(outputs-1) == errorType {
+		plan.errorIndex = outputs - 1
+		outputs--
+	}
+	if outputs > 0 {
+		plan.resultIndex = 0
+	}
+	inputs, lists := 0, 0
+	for i := 0; i < handlerType.NumIn(); i++ {
+		argType := handlerType.In(i)
+		kind := argumentKindOf(argType)
+		switch kind {
+		case argumentDto, argumentMap:
+			inputs++
+		case argumentList:
+			lists++
+		case argumentOrdered:
+			plan.ordered++
+		case argumentMultipart:
+			plan.streaming = true
+		case argumentService, argumentOrmContext:
+			if _, found := lookupService(argType); !found {
+				return nil, fmt.Errorf("handler %v: no service registered for %v", handlerType, argType)
+			}
+		}
+		plan.kinds = append(plan.kinds, kind)
+		plan.types = append(plan.types, argType)
+	}
+	// A single slice is the whole body; with other inputs it is one element of it
+	if lists > 1 || (lists == 1 && (plan.ordered > 0 || inputs > 0)) {
+		for i, kind := range plan.kinds {
+			if kind == argumentList {
+				plan.kinds[i] = argumentOrdered
+				plan.ordered++
+			}
+		}
+	}
+	if plan.ordered > 0 && inputs > 0 {
+		return nil, fmt.Errorf("handler %v mixes ordered arguments with input DTOs", handlerType)
+	}
+	return plan, nil
+}
+
+func argumentKindOf(argType reflect.Type) argumentKind {
+	switch {
+	case argType == stdContextType:
+		return argumentContext
+	case argType == HttpRequestContextType:
+		return argumentRequestContext
+	case argType == requestType:
+		return argumentRequest
+	case argType == responseWriterType:
+		return argumentResponse
+	case argType == HttpRequestPathParamType:
+		return argumentPathParams
+	case argType == multipartReaderType:
+		return argumentMultipart
+	case argType == ormContextType:
+		return argumentOrmContext
+	case argType.Kind() == reflect.Ptr && isBindableStruct(argType.Elem()):
+		// Registered pointers are services, others are allocated and bound
+		if _, found := lookupService(argType); found {
+			return argumentService
+		}
+		return argumentDto
+	case argType.Kind() == reflect.Interface && argType.NumMethod() > 0, argType.Kind() == reflect.Ptr:
+		return argumentService
+	case argType.Kind() == reflect.Struct && isBindableStruct(argType):
+		return argumentDto
+	case argType.Kind() == reflect.Map && argType.Key().Kind() == reflect.String:
+		return argumentMap
+	case (argType.Kind() == reflect.Slice && argType.Elem().Kind() != reflect.Uint8) || argType.Kind() == reflect.Array:
+		return argumentList
+	}
+	return argumentOrdered
+}
+
+// Plan of the service point handler (nil for http.Handler handlers)
+func (this *ServicePoint) invocationPlan() *invocationPlan {
+	if this.plan == nil {
+		if _, ok := this.handler.(http.Handler); ok {
+			return nil
+		}
+		plan, err := newInvocationPlan(reflect.TypeOf(this.handler))
+		if err != nil {
+			panic(err)
+		}
+		this.plan = plan
+	}
+	return this.plan
+}
+
+// Look up a service by type, in the request context first, then in the handler PropertyBag,
+// then in the registered services
+func (this *InvocationInterceptor) ResolveService(context HttpRequestContext, t reflect.Type) reflect.Value {
+	for _, propertyBag := range []PropertyBag{context, this.propertyBag} {
+		if propertyBag == nil {
+			continue
+		}
+		if service, found := propertyBag.GetInterface(t); found && service != nil {
+			value := reflect.ValueOf(service)
+			if value.Type().AssignableTo(t) {
+				return value
+			}
+		}
+	}
+	if service, found := lookupService(t); found {
+		return reflect.ValueOf(service)
+	}
+	panic(fmt.Errorf("no service registered for %v", t))
+}
+
+// Orm context registered as a service, bound to the request context so that queries are
+// canceled with the request and use the tenant resolved by TenantInterceptor
+func (this *InvocationInterceptor) ResolveOrmContext(context HttpRequestContext, request *http.Request) reflect.Value {
+	ormContext := this.ResolveService(context, ormContextType).Interface().(orm.OrmContext)
+	return reflect.ValueOf(ormContext.WithContext(request.Context()))
+}
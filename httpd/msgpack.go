@@ -0,0 +1,410 @@
+package httpd
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// MessagePack (https://msgpack.org), structs are encoded as maps of their fields
+// (named by msgpack or json tags), values are decoded to the same types as JSON
+// (maps, slices, strings, numbers, booleans, nil) and []byte for binary data
+type msgpackCodec struct {
+	mediaType string
+}
+
+// Nesting limit of arrays and maps
+const msgpackMaxDepth = 10000
+
+var (
+	errorMsgpackTruncated = errors.New("truncated msgpack data")
+	errorMsgpackTooDeep   = fmt.Errorf("msgpack data nested deeper than %d levels", msgpackMaxDepth)
+)
+
+func (this *msgpackCodec) MediaType() string {
+	return this.mediaType
+}
+
+func (this *msgpackCodec) ContentType() string {
+	return this.mediaType
+}
+
+func (this *msgpackCodec) Marshal(value interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := this.encode(buffer, reflect.ValueOf(value)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (this *msgpackCodec) Unmarshal(data []byte, target interface{}) error {
+	reader := bytes.NewReader(data)
+	value, err := this.decode(reader, 0)
+	if err != nil {
+		return err
+	}
+	if reader.Len() > 0 {
+		return fmt.Errorf("%d bytes after msgpack value", reader.Len())
+	}
+	if ok, err := setGeneric(target, value); ok {
+		return err
+	}
+	// Typed targets go through JSON
+	buffer, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buffer, target)
+}
+
+func (this *msgpackCodec) encode(buffer *bytes.Buffer, value reflect.Value) error {
+	if !value.IsValid() {
+		buffer.WriteByte(0xc0)
+		return nil
+	}
+	if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && value.IsNil() {
+		buffer.WriteByte(0xc0)
+		return nil
+	}
+	// Times and other text values as strings
+	if marshaler, ok := value.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return err
+		}
+		this.encodeString(buffer, 0xa0, 0xd9, string(text))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return this.encode(buffer, value.Elem())
+	case reflect.Bool:
+		if value.Bool() {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		this.encodeInt(buffer, value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		this.encodeUint(buffer, value.Uint())
+	case reflect.Float32:
+		buffer.WriteByte(0xca)
+		binary.Write(buffer, binary.BigEndian, math.Float32bits(float32(value.Float())))
+	case reflect.Float64:
+		buffer.WriteByte(0xcb)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(value.Float()))
+	case reflect.String:
+		this.encodeString(buffer, 0xa0, 0xd9, value.String())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			buffer.WriteByte(0xc0)
+			return nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			this.encodeString(buffer, 0, 0xc4, string(data))
+			return nil
+		}
+		this.encodeLength(buffer, 0x90, 0xdc, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			if err := this.encode(buffer, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.IsNil() {
+			buffer.WriteByte(0xc0)
+			return nil
+		}
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		this.encodeLength(buffer, 0x80, 0xde, len(keys))
+		for _, key := range keys {
+			if err := this.encode(buffer, key); err != nil {
+				return err
+			}
+			if err := this.encode(buffer, value.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		var names []string
+		var fields []reflect.Value
+		this.structFields(value, &names, &fields)
+		this.encodeLength(buffer, 0x80, 0xde, len(names))
+		for i, name := range names {
+			this.encodeString(buffer, 0xa0, 0xd9, name)
+			if err := this.encode(buffer, fields[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %v as msgpack", value.Type())
+	}
+	return nil
+}
+
+// Exported fields, embedded struct fields are promoted
+func (this *msgpackCodec) structFields(value reflect.Value, names *[]string, fields *[]reflect.Value) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.PkgPath == "" && field.Type.Kind() == reflect.Struct {
+			this.structFields(value.Field(i), names, fields)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name, ok := fieldName(field, "msgpack", "json"); ok {
+			*names = append(*names, name)
+			*fields = append(*fields, value.Field(i))
+		}
+	}
+}
+
+func (this *msgpackCodec) encodeInt(buffer *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0:
+		this.encodeUint(buffer, uint64(n))
+	case n >= -32:
+		buffer.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		buffer.Write([]byte{0xd0, byte(n)})
+	case n >= math.MinInt16:
+		buffer.WriteByte(0xd1)
+		binary.Write(buffer, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		buffer.WriteByte(0xd2)
+		binary.Write(buffer, binary.BigEndian, int32(n))
+	default:
+		buffer.WriteByte(0xd3)
+		binary.Write(buffer, binary.BigEndian, n)
+	}
+}
+
+func (this *msgpackCodec) encodeUint(buffer *bytes.Buffer, n uint64) {
+	switch {
+	case n <= math.MaxInt8:
+		buffer.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		buffer.Write([]byte{0xcc, byte(n)})
+	case n <= math.MaxUint16:
+		buffer.WriteByte(0xcd)
+		binary.Write(buffer, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buffer.WriteByte(0xce)
+		binary.Write(buffer, binary.BigEndian, uint32(n))
+	default:
+		buffer.WriteByte(0xcf)
+		binary.Write(buffer, binary.BigEndian, n)
+	}
+}
+
+// Strings (fixstr, str8/16/32) and binary data (bin8/16/32, no fix format)
+func (this *msgpackCodec) encodeString(buffer *bytes.Buffer, fix byte, code byte, text string) {
+	length := len(text)
+	switch {
+	case fix != 0 && length < 32:
+		buffer.WriteByte(fix | byte(length))
+	case length <= math.MaxUint8:
+		buffer.Write([]byte{code, byte(length)})
+	case length <= math.MaxUint16:
+		buffer.WriteByte(code + 1)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(code + 2)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+	buffer.WriteString(text)
+}
+
+// Arrays (fixarray, array16/32) and maps (fixmap, map16/32)
+func (this *msgpackCodec) encodeLength(buffer *bytes.Buffer, fix byte, code byte, length int) {
+	switch {
+	case length < 16:
+		buffer.WriteByte(fix | byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(code)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(code + 1)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+}
+
+// depth is the number of enclosing arrays and maps
+func (this *msgpackCodec) decode(reader *bytes.Reader, depth int) (interface{}, error) {
+	code, err := reader.ReadByte()
+	if err != nil {
+		return nil, errorMsgpackTruncated
+	}
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code >= 0x80 && code <= 0x8f:
+		return this.decodeMap(reader, int(code&0x0f), depth)
+	case code >= 0x90 && code <= 0x9f:
+		return this.decodeArray(reader, int(code&0x0f), depth)
+	case code >= 0xa0 && code <= 0xbf:
+		data, err := this.read(reader, int(code&0x1f))
+		return string(data), err
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		length, err := this.readLength(reader, code-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return this.read(reader, length)
+	case 0xca:
+		var bits uint32
+		if err := binary.Read(reader, binary.BigEndian, &bits); err != nil {
+			return nil, errorMsgpackTruncated
+		}
+		return float64(math.Float32frombits(bits)), nil
+	case 0xcb:
+		var bits uint64
+		if err := binary.Read(reader, binary.BigEndian, &bits); err != nil {
+			return nil, errorMsgpackTruncated
+		}
+		return math.Float64frombits(bits), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		data, err := this.read(reader, 1<<(code-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var n uint64
+		for _, b := range data {
+			n = n<<8 | uint64(b)
+		}
+		if n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+		return n, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		data, err := this.read(reader, size)
+		if err != nil {
+			return nil, err
+		}
+		var n uint64
+		for _, b := range data {
+			n = n<<8 | uint64(b)
+		}
+		// Sign extend
+		shift := uint(64 - size*8)
+		return int64(n<<shift) >> shift, nil
+	case 0xd9, 0xda, 0xdb:
+		length, err := this.readLength(reader, code-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		data, err := this.read(reader, length)
+		return string(data), err
+	case 0xdc, 0xdd:
+		length, err := this.readLength(reader, code-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return this.decodeArray(reader, length, depth)
+	case 0xde, 0xdf:
+		length, err := this.readLength(reader, code-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return this.decodeMap(reader, length, depth)
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%02x", code)
+}
+
+// Length of 1, 2 or 4 bytes (size 0, 1, 2)
+func (this *msgpackCodec) readLength(reader *bytes.Reader, size byte) (int, error) {
+	data, err := this.read(reader, 1<<size)
+	if err != nil {
+		return 0, err
+	}
+	length := 0
+	for _, b := range data {
+		length = length<<8 | int(b)
+	}
+	return length, nil
+}
+
+func (this *msgpackCodec) read(reader *bytes.Reader, length int) ([]byte, error) {
+	if length > reader.Len() {
+		return nil, errorMsgpackTruncated
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, errorMsgpackTruncated
+	}
+	return data, nil
+}
+
+func (this *msgpackCodec) decodeArray(reader *bytes.Reader, length int, depth int) (interface{}, error) {
+	if depth >= msgpackMaxDepth {
+		return nil, errorMsgpackTooDeep
+	}
+	// Every element takes at least one byte
+	if length > reader.Len() {
+		return nil, errorMsgpackTruncated
+	}
+	list := make([]interface{}, length)
+	for i := range list {
+		value, err := this.decode(reader, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = value
+	}
+	return list, nil
+}
+
+// Keys other than strings are converted to text
+func (this *msgpackCodec) decodeMap(reader *bytes.Reader, length int, depth int) (interface{}, error) {
+	if depth >= msgpackMaxDepth {
+		return nil, errorMsgpackTooDeep
+	}
+	if length > reader.Len() {
+		return nil, errorMsgpackTruncated
+	}
+	object := make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		key, err := this.decode(reader, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := this.decode(reader, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if text, ok := key.(string); ok {
+			object[text] = value
+		} else {
+			object[fmt.Sprint(key)] = value
+		}
+	}
+	return object, nil
+}
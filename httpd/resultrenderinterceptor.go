@@ -2,7 +2,8 @@ package httpd
 
 import (
 	"net/http"
-	"encoding/json"
+
+	"github.com/umeframework/gear/orm"
 )
 
 type ResultRenderInterceptor struct {
@@ -27,6 +28,31 @@ func (this *ResultRenderInterceptor) Intercept(chain HttpInterceptorChain, reque
 
 func (this *ResultRenderInterceptor) Render(chain HttpInterceptorChain, request *http.Request,
 	response http.ResponseWriter, context HttpRequestContext, result interface{}) {
-	encoder := json.NewEncoder(response)
-	encoder.Encode(result)
+	status := http.StatusOK
+	httpResponse, isHttpResponse := result.(*HttpResponse)
+	if isHttpResponse {
+		status = httpResponse.status()
+		result = httpResponse.Body
+		if !httpResponse.hasBody(request) {
+			httpResponse.copyHeader(response)
+			response.WriteHeader(status)
+			return
+		}
+	}
+
+	// Mask entity columns when output masking is enabled, encode with the codec accepted by the client
+	if orm.MaskingEnabled() {
+		result = orm.MaskEntity(result)
+	}
+	codec, data, err := NegotiateEncoding(request.Header.Get("Accept"), result)
+	if err != nil {
+		panic(err)
+	}
+	if isHttpResponse {
+		httpResponse.copyHeader(response)
+	}
+	response.Header().Set("Content-Type", codec.ContentType())
+	response.Header().Add("Vary", "Accept")
+	response.WriteHeader(status)
+	response.Write(data)
 }
@@ -0,0 +1,441 @@
+package httpd
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// URL patterns of service points:
+//	/albums                   static (case-insensitive)
+//	/albums/{id}              parameter, matches one path segment
+//	/albums/{year:int}        parameter with a constraint
+//	/files/{path...}          wildcard tail, matches the rest of the path
+// Static segments take precedence over constrained parameters, constrained
+// parameters over plain ones, and plain ones over wildcards.
+
+type RouteConstraint func(value string) bool
+
+var (
+	routeConstraints = map[string]RouteConstraint{
+		"int": func(value string) bool {
+			_, err := strconv.ParseInt(value, 10, 64)
+			return err == nil
+		},
+		"uint": func(value string) bool {
+			_, err := strconv.ParseUint(value, 10, 64)
+			return err == nil
+		},
+		"float": func(value string) bool {
+			_, err := strconv.ParseFloat(value, 64)
+			return err == nil
+		},
+		"bool": func(value string) bool {
+			_, err := strconv.ParseBool(value)
+			return err == nil
+		},
+		"alpha": func(value string) bool {
+			for _, c := range value {
+				if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+					return false
+				}
+			}
+			return true
+		},
+		"uuid": func(value string) bool {
+			if len(value) != 36 {
+				return false
+			}
+			for i, c := range value {
+				switch i {
+				case 8, 13, 18, 23:
+					if c != '-' {
+						return false
+					}
+				default:
+					if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+						return false
+					}
+				}
+			}
+			return true
+		},
+	}
+	routeConstraintsLock sync.RWMutex
+)
+
+// Register a named constraint usable as {name:constraint}, must be called before NewServicePoint
+func RegisterRouteConstraint(name string, constraint RouteConstraint) {
+	routeConstraintsLock.Lock()
+	defer routeConstraintsLock.Unlock()
+	routeConstraints[name] = constraint
+}
+
+func lookupRouteConstraint(name string) (RouteConstraint, bool) {
+	routeConstraintsLock.RLock()
+	defer routeConstraintsLock.RUnlock()
+	constraint, found := routeConstraints[name]
+	return constraint, found
+}
+
+// Radix tree of service points
+type Router struct {
+	lock sync.RWMutex
+	root routeNode
+}
+
+type routeNode struct {
+	// Static text of the edge leading to this node (lower case)
+	prefix string
+	// Static children, keyed by distinct first bytes
+	children []*routeNode
+	// Parameter children, constrained ones first
+	params []*routeNode
+	// Wildcard tail child
+	wildcard *routeNode
+
+	// Parameter name and constraint (parameter and wildcard nodes only)
+	name           string
+	constraintName string
+	constraint     RouteConstraint
+
+	servicePoints []*ServicePoint
+}
+
+type routeToken struct {
+	static         string
+	param          string
+	constraintName string
+	wildcard       bool
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Add a service point, panics if the pattern is malformed or conflicts with a registered one
+func (this *Router) Add(servicePoint *ServicePoint) {
+	tokens, err := parseUrlPattern(servicePoint.UrlPattern)
+	if err != nil {
+		panic(err)
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	node := &this.root
+	for _, token := range tokens {
+		switch {
+		case token.wildcard:
+			node = node.addWildcard(servicePoint.UrlPattern, token)
+		case token.param != "":
+			node = node.addParam(servicePoint.UrlPattern, token)
+		default:
+			node = node.addStatic(token.static)
+		}
+	}
+	for _, registered := range node.servicePoints {
+		if method, overlapped := overlappedMethod(registered.Methods, servicePoint.Methods); overlapped {
+			panic(fmt.Errorf("url pattern %s: method %s is already registered by %s",
+				servicePoint.UrlPattern, method, registered.UrlPattern))
+		}
+	}
+	node.servicePoints = append(node.servicePoints, servicePoint)
+}
+
+// Find the service point for the method and path, and the matched path params.
+// If the path matches but the method does not, the service point is nil and
+// the allowed methods are returned; all results are nil if the path does not match.
+func (this *Router) Match(method string, path string) (*ServicePoint, HttpRequestPathParam, []string) {
+	servicePoints, params := this.Lookup(path)
+	if len(servicePoints) == 0 {
+		return nil, nil, nil
+	}
+	if servicePoint := selectServicePoint(servicePoints, method); servicePoint != nil {
+		return servicePoint, params, nil
+	}
+	return nil, params, allowedMethods(servicePoints)
+}
+
+// Find service points registered for the path, and the matched path params
+func (this *Router) Lookup(path string) ([]*ServicePoint, HttpRequestPathParam) {
+	if path == "" {
+		path = "/"
+	}
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	params := HttpRequestPathParam{}
+	if node := this.root.match(path, params); node != nil {
+		return node.servicePoints, params
+	}
+	return nil, nil
+}
+
+func (this *routeNode) addStatic(text string) *routeNode {
+	text = strings.ToLower(text)
+	node := this
+	for text != "" {
+		var next *routeNode
+		for _, child := range node.children {
+			common := commonPrefixLength(child.prefix, text)
+			if common == 0 {
+				continue
+			}
+			if common < len(child.prefix) {
+				// Split the edge at the common prefix
+				split := *child
+				split.prefix = child.prefix[common:]
+				*child = routeNode{prefix: child.prefix[:common], children: []*routeNode{&split}}
+			}
+			next = child
+			text = text[common:]
+			break
+		}
+		if next == nil {
+			next = &routeNode{prefix: text}
+			node.children = append(node.children, next)
+			text = ""
+		}
+		node = next
+	}
+	return node
+}
+
+func (this *routeNode) addParam(pattern string, token routeToken) *routeNode {
+	for _, param := range this.params {
+		if param.constraintName != token.constraintName {
+			continue
+		}
+		if param.name != token.param {
+			panic(fmt.Errorf("url pattern %s: parameter {%s} conflicts with {%s} of a registered pattern",
+				pattern, token.param, param.name))
+		}
+		return param
+	}
+	node := &routeNode{name: token.param, constraintName: token.constraintName}
+	if token.constraintName != "" {
+		constraint, found := lookupRouteConstraint(token.constraintName)
+		if !found {
+			panic(fmt.Errorf("url pattern %s: unknown constraint %q", pattern, token.constraintName))
+		}
+		node.constraint = constraint
+	}
+	this.params = append(this.params, node)
+	sort.SliceStable(this.params, func(i, j int) bool {
+		return this.params[i].constraint != nil && this.params[j].constraint == nil
+	})
+	return node
+}
+
+func (this *routeNode) addWildcard(pattern string, token routeToken) *routeNode {
+	if this.wildcard == nil {
+		this.wildcard = &routeNode{name: token.param}
+	} else if this.wildcard.name != token.param {
+		panic(fmt.Errorf("url pattern %s: wildcard {%s...} conflicts with {%s...} of a registered pattern",
+			pattern, token.param, this.wildcard.name))
+	}
+	return this.wildcard
+}
+
+// Match the rest of the path, backtracking to lower precedence branches on failure
+func (this *routeNode) match(path string, params HttpRequestPathParam) *routeNode {
+	if path == "" && len(this.servicePoints) > 0 {
+		return this
+	}
+	for _, child := range this.children {
+		if len(path) >= len(child.prefix) && strings.EqualFold(path[:len(child.prefix)], child.prefix) {
+			if node := child.match(path[len(child.prefix):], params); node != nil {
+				return node
+			}
+		}
+	}
+	if segment := path[:segmentLength(path)]; segment != "" {
+		for _, param := range this.params {
+			if param.constraint != nil && !param.constraint(segment) {
+				continue
+			}
+			if node := param.match(path[len(segment):], params); node != nil {
+				params[param.name] = segment
+				return node
+			}
+		}
+	}
+	if this.wildcard != nil && len(this.wildcard.servicePoints) > 0 {
+		params[this.wildcard.name] = path
+		return this.wildcard
+	}
+	return nil
+}
+
+// Service point for the method: explicit methods first, then the ones without methods.
+// HEAD falls back to GET; OPTIONS is answered automatically unless registered explicitly.
+func selectServicePoint(servicePoints []*ServicePoint, method string) *ServicePoint {
+	candidates := []string{method}
+	if method == http.MethodHead {
+		candidates = append(candidates, http.MethodGet)
+	}
+	for _, candidate := range candidates {
+		for _, servicePoint := range servicePoints {
+			if hasMethod(servicePoint.Methods, candidate) {
+				return servicePoint
+			}
+		}
+	}
+	if method == http.MethodOptions {
+		return nil
+	}
+	for _, servicePoint := range servicePoints {
+		if len(servicePoint.Methods) == 0 {
+			return servicePoint
+		}
+	}
+	return nil
+}
+
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// Methods answered by the service points (for the Allow header)
+func allowedMethods(servicePoints []*ServicePoint) []string {
+	allowed := map[string]bool{http.MethodOptions: true}
+	for _, servicePoint := range servicePoints {
+		if len(servicePoint.Methods) == 0 {
+			return standardMethods
+		}
+		for _, method := range servicePoint.Methods {
+			allowed[strings.ToUpper(method)] = true
+		}
+	}
+	if allowed[http.MethodGet] {
+		allowed[http.MethodHead] = true
+	}
+	methods := make([]string, 0, len(allowed))
+	for _, method := range standardMethods {
+		if allowed[method] {
+			methods = append(methods, method)
+			delete(allowed, method)
+		}
+	}
+	extensions := make([]string, 0, len(allowed))
+	for method := range allowed {
+		extensions = append(extensions, method)
+	}
+	sort.Strings(extensions)
+	return append(methods, extensions...)
+}
+
+func hasMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// First method registered by both, service points without methods overlap each other only
+func overlappedMethod(a []string, b []string) (string, bool) {
+	if len(a) == 0 && len(b) == 0 {
+		return "*", true
+	}
+	for _, method := range a {
+		if hasMethod(b, method) {
+			return strings.ToUpper(method), true
+		}
+	}
+	return "", false
+}
+
+func segmentLength(path string) int {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return i
+	}
+	return len(path)
+}
+
+func commonPrefixLength(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// Split a url pattern into static text and parameter tokens
+func parseUrlPattern(pattern string) ([]routeToken, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("url pattern %s: must start with '/'", pattern)
+	}
+	var tokens []routeToken
+	names := map[string]bool{}
+	rest := pattern
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			tokens = append(tokens, routeToken{static: rest})
+			break
+		}
+		if open > 0 {
+			tokens = append(tokens, routeToken{static: rest[:open]})
+		}
+		end := strings.IndexByte(rest, '}')
+		if end < open {
+			return nil, fmt.Errorf("url pattern %s: unbalanced braces", pattern)
+		}
+		// Parameters must span a whole segment
+		if rest[open-1] != '/' || (end+1 < len(rest) && rest[end+1] != '/') {
+			return nil, fmt.Errorf("url pattern %s: parameter must be a whole path segment", pattern)
+		}
+		token := routeToken{param: rest[open+1 : end]}
+		if strings.ContainsAny(token.param, "{/") {
+			return nil, fmt.Errorf("url pattern %s: unbalanced braces", pattern)
+		}
+		if strings.HasSuffix(token.param, "...") {
+			if end+1 != len(rest) {
+				return nil, fmt.Errorf("url pattern %s: wildcard must be the last segment", pattern)
+			}
+			token.param = strings.TrimSuffix(token.param, "...")
+			token.wildcard = true
+		} else if i := strings.IndexByte(token.param, ':'); i >= 0 {
+			token.param, token.constraintName = token.param[:i], token.param[i+1:]
+		}
+		if token.param == "" {
+			return nil, fmt.Errorf("url pattern %s: parameter name is required", pattern)
+		}
+		if names[token.param] {
+			return nil, fmt.Errorf("url pattern %s: duplicate parameter {%s}", pattern, token.param)
+		}
+		names[token.param] = true
+		tokens = append(tokens, token)
+		rest = rest[end+1:]
+	}
+	return tokens, nil
+}
+
+//------------------------------
+// Path params of the current request
+
+type pathParamsKey struct{}
+
+// Path params matched for the current request, empty if none
+func PathParams(context HttpRequestContext) HttpRequestPathParam {
+	if params, found := context.GetInterface(HttpRequestPathParamType); found {
+		return params.(HttpRequestPathParam)
+	}
+	return HttpRequestPathParam{}
+}
+
+func requestWithPathParams(request *http.Request, params HttpRequestPathParam) *http.Request {
+	return request.WithContext(stdcontext.WithValue(request.Context(), pathParamsKey{}, params))
+}
+
+func requestPathParams(request *http.Request) HttpRequestPathParam {
+	if params, ok := request.Context().Value(pathParamsKey{}).(HttpRequestPathParam); ok {
+		return params
+	}
+	return HttpRequestPathParam{}
+}
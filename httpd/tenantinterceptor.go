@@ -0,0 +1,98 @@
+package httpd
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/umeframework/gear/orm"
+)
+
+const (
+	// Request context key of the resolved tenant
+	TenantContextKey = "gear.tenant"
+	// Property bag key to override the tenant header
+	TenantHeaderProperty = "tenant.header"
+	DefaultTenantHeader  = "X-Tenant-Id"
+)
+
+var (
+	ErrorTenantRequired         = errors.New("tenant is required")
+	ErrorTenantResolverRequired = errors.New("tenant interceptor needs a Resolver or a trusted header")
+)
+
+// Resolves the tenant of requests. The tenant isolates the data of customers (e.g. rows of
+// shared tables), so it must not be taken from what clients claim: set Resolver to derive it
+// from the authenticated principal (or host name), or set TrustedHeader only if a gateway in
+// front of the server authenticates requests and sets the header, replacing client values.
+// Initialize panics if neither is set.
+type TenantInterceptor struct {
+	// Resolver of the tenant (e.g. from the authenticated principal), overrides Header
+	Resolver func(request *http.Request) string
+	// Take the tenant from Header, set by a trusted gateway
+	TrustedHeader bool
+	// Header carrying the tenant (DefaultTenantHeader if empty)
+	Header string
+	// Reject requests without tenant with 400
+	Required bool
+}
+
+func (this *TenantInterceptor) Initialize(propertyBag PropertyBag) {
+	if this.Resolver == nil && !this.TrustedHeader {
+		panic(ErrorTenantResolverRequired)
+	}
+	if this.Header == "" && propertyBag != nil {
+		if header, found := propertyBag.GetValue(TenantHeaderProperty); found {
+			this.Header, _ = header.(string)
+		}
+	}
+	if this.Header == "" {
+		this.Header = DefaultTenantHeader
+	}
+}
+
+func (this *TenantInterceptor) Destroy() {
+	// foo
+}
+
+func (this *TenantInterceptor) Intercept(chain HttpInterceptorChain, request *http.Request, response http.ResponseWriter, context HttpRequestContext) {
+	tenant := this.ResolveTenant(request)
+	if tenant == "" && this.Required {
+		panic(NewInterceptorException(ErrorTenantRequired, http.StatusBadRequest, "tenant is required"))
+	}
+	if tenant != "" {
+		// Both the request context (for orm.OrmContext handler arguments, bound to it)
+		// and the interceptor context (for RequestTenant) carry the tenant
+		context.SetValue(TenantContextKey, tenant)
+		request = request.WithContext(orm.ContextWithTenant(request.Context(), tenant))
+	}
+	chain.DoChain(request, response, context)
+}
+
+func (this *TenantInterceptor) ResolveTenant(request *http.Request) string {
+	if this.Resolver != nil {
+		return this.Resolver(request)
+	}
+	if !this.TrustedHeader {
+		return ""
+	}
+	header := this.Header
+	if header == "" {
+		header = DefaultTenantHeader
+	}
+	return request.Header.Get(header)
+}
+
+// Tenant resolved by TenantInterceptor, empty if none
+func RequestTenant(context HttpRequestContext) string {
+	if tenant, found := context.GetValue(TenantContextKey); found {
+		if text, ok := tenant.(string); ok {
+			return text
+		}
+	}
+	return ""
+}
+
+// Bind the resolved tenant to an orm context
+func TenantOrmContext(context HttpRequestContext, ormContext orm.OrmContext) orm.OrmContext {
+	return ormContext.WithTenant(RequestTenant(context))
+}
@@ -0,0 +1,277 @@
+package test
+
+import (
+    "encoding/json"
+    "errors"
+    "net"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/umeframework/gear/httpd"
+)
+
+// Converted by a registered converter
+type upperCode string
+
+// Input of the conversion tests
+type convertInDTO struct {
+    Count int
+    Size  uint8
+    Ratio float32
+    Tags  []int
+    Level *int
+    Since time.Time
+    Addr  net.IP
+    Code  upperCode
+}
+
+func init() {
+    httpd.RegisterConverter(reflect.TypeOf(upperCode("")), func(text string) (interface{}, error) {
+        if text == "" {
+            return nil, errors.New("code is empty")
+        }
+        return upperCode(strings.ToUpper(text)), nil
+    })
+    httpd.NewServicePoint("/test/binder/convert", []string{http.MethodGet, http.MethodPost}, func(in convertInDTO) convertInDTO {
+        return in
+    })
+}
+
+func TestConvertString(t *testing.T) {
+    level := 3
+    tests := []struct {
+        text     string
+        value    interface{}
+        expected interface{}
+        err      string
+    }{
+        {"127", int8(0), int8(127), ""},
+        {" 42 ", 0, 42, ""},
+        {"128", int8(0), nil, `"128" is out of range for int8`},
+        {"1.5", 0, nil, `invalid int "1.5"`},
+        {"-1", uint(0), nil, `invalid uint "-1"`},
+        {"256", uint8(0), nil, `"256" is out of range for uint8`},
+        {"2.5", float32(0), float32(2.5), ""},
+        {"1e40", float32(0), nil, `"1e40" is out of range for float32`},
+        {"true", false, true, ""},
+        {"yes", false, nil, `invalid bool "yes"`},
+        {"3", &level, &level, ""},
+        {"x", &level, nil, `invalid int "x"`},
+        {"2024-02-29", time.Time{}, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), ""},
+        {"yesterday", time.Time{}, nil, `invalid time "yesterday"`},
+        {"1m30s", time.Duration(0), 90 * time.Second, ""},
+        {"192.168.0.1", net.IP{}, net.ParseIP("192.168.0.1"), ""},
+        {"192.168.0.256", net.IP{}, nil, "invalid IP address: 192.168.0.256"},
+        {"abc", upperCode(""), upperCode("ABC"), ""},
+        {"", upperCode(""), nil, "code is empty"},
+        {"x", struct{}{}, nil, `cannot convert "x" to struct {}`},
+    }
+    for _, test := range tests {
+        value, err := httpd.ConvertString(test.text, reflect.TypeOf(test.value))
+        checkConverted(t, test.text, value, err, test.expected, test.err)
+    }
+}
+
+func TestConvertValue(t *testing.T) {
+    level := 42
+    tests := []struct {
+        value    interface{}
+        target   interface{}
+        expected interface{}
+        err      string
+    }{
+        // Decoded JSON numbers
+        {float64(42), 0, 42, ""},
+        {float64(1.5), 0, nil, "1.5 is not a valid int"},
+        {float64(300), uint8(0), nil, "300 is not a valid uint8"},
+        {float64(-1), uint(0), nil, "-1 is not a valid uint"},
+        {float64(1e20), int64(0), nil, "1e+20 is not a valid int64"},
+        {float64(1e40), float32(0), nil, "1e+40 is out of range for float32"},
+        {float64(42), &level, &level, ""},
+        {float64(2), new(interface{}), nil, ""},
+        // Text and integers of other codecs
+        {"7", 0, 7, ""},
+        {int64(200), int8(0), nil, `"200" is out of range for int8`},
+        {uint64(7), 0, 7, ""},
+        {nil, 0, 0, ""},
+        // Structured values
+        {map[string]interface{}{"Count": float64(2)}, convertInDTO{}, convertInDTO{Count: 2}, ""},
+        {[]interface{}{"a"}, []int{}, nil, `cannot convert ["a"] to []int`},
+    }
+    for _, test := range tests {
+        value, err := httpd.ConvertValue(reflect.ValueOf(test.value), reflect.TypeOf(test.target))
+        if test.expected == nil && test.err == "" {
+            // Interface targets keep the decoded value
+            if err != nil || value.Elem().Interface() != test.value {
+                t.Errorf("%v: converted %v, err = %v", test.value, value, err)
+            }
+            continue
+        }
+        checkConverted(t, test.value, value, err, test.expected, test.err)
+    }
+}
+
+func checkConverted(t *testing.T, input interface{}, value reflect.Value, err error, expected interface{}, expectedErr string) {
+    t.Helper()
+    if expectedErr != "" {
+        if err == nil || err.Error() != expectedErr {
+            t.Errorf("%v: err = %v, expected %s", input, err, expectedErr)
+        }
+        return
+    }
+    if err != nil {
+        t.Errorf("%v: unexpected err %v", input, err)
+        return
+    }
+    actual := value.Interface()
+    if value.Kind() == reflect.Ptr && reflect.ValueOf(expected).Kind() == reflect.Ptr {
+        actual, expected = value.Elem().Interface(), reflect.ValueOf(expected).Elem().Interface()
+    }
+    if !reflect.DeepEqual(actual, expected) {
+        t.Errorf("%v: converted %#v, expected %#v", input, actual, expected)
+    }
+}
+
+// Field details of a 400 response
+func bindingErrors(t *testing.T, response interface{ Bytes() []byte }) map[string]httpd.BindingFieldError {
+    t.Helper()
+    var output struct {
+        Content []httpd.BindingFieldError `json:"content"`
+    }
+    if err := json.Unmarshal(response.Bytes(), &output); err != nil {
+        t.Fatal(err)
+    }
+    fields := map[string]httpd.BindingFieldError{}
+    for _, fieldError := range output.Content {
+        fields[fieldError.Field] = fieldError
+    }
+    return fields
+}
+
+func TestBindConversion(t *testing.T) {
+    handler := newHandler(t, nil)
+
+    // Query text, repeated keys bind slices and the last one wins for single values
+    response := serve(handler, http.MethodGet, "/test/binder/convert?count=1&count=2&size=200&ratio=0.5&tags=1&tags=2&level=9&since=2024-02-29&addr=10.0.0.1&code=ab", "")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `{"Count":2,"Size":200,"Ratio":0.5,"Tags":[1,2],"Level":9,"Since":"2024-02-29T00:00:00Z","Addr":"10.0.0.1","Code":"AB"}`)
+    }
+
+    // Every failed field is reported with its value
+    response = serve(handler, http.MethodGet, "/test/binder/convert?count=x&size=256&tags=1&tags=y&level=1.5&code=", "")
+    if assertStatus(t, response, http.StatusBadRequest) {
+        fields := bindingErrors(t, response.Body)
+        expected := map[string]string{
+            "Count":   `invalid int "x"`,
+            "Size":    `"256" is out of range for uint8`,
+            "Tags[1]": `invalid int "y"`,
+            "Level":   `invalid int "1.5"`,
+            "Code":    "code is empty",
+        }
+        if len(fields) != len(expected) {
+            t.Errorf("unexpected field errors: %v", fields)
+        }
+        for field, message := range expected {
+            if fields[field].Message != message {
+                t.Errorf("%s: message = %q, expected %q", field, fields[field].Message, message)
+            }
+        }
+        if fields["Tags[1]"].Value != "y" {
+            t.Errorf("Tags[1]: value = %v, expected y", fields["Tags[1]"].Value)
+        }
+    }
+
+    // JSON bodies: fractions and overflow of numbers
+    response = serve(handler, http.MethodPost, "/test/binder/convert", `{"Count":1.5,"Size":300,"Level":7}`, "Content-Type", "application/json")
+    if assertStatus(t, response, http.StatusBadRequest) {
+        fields := bindingErrors(t, response.Body)
+        if fields["Count"].Message != "cannot convert number 1.5 to int" || fields["Size"].Message != "cannot convert number 300 to uint8" {
+            t.Errorf("unexpected field errors: %v", fields)
+        }
+        if _, found := fields["Level"]; found {
+            t.Errorf("Level should be bound: %v", fields)
+        }
+    }
+}
+
+// Input of the binding source tests
+type sourceInDTO struct {
+    Value    string   `path:"v" json:"v" form:"v" query:"v" header:"X-V" cookie:"v" default:"none"`
+    Page     int      `query:"page"`
+    Size     int      `query:"size" default:"20"`
+    Tags     []string `query:"tag" default:"a,b"`
+    Tenant   string   `header:"x-tenant"`
+    Sid      string   `cookie:"sid"`
+    Title    string   `json:"title"`
+    Untagged string
+}
+
+func init() {
+    source := func(in sourceInDTO) sourceInDTO {
+        return in
+    }
+    httpd.NewServicePoint("/test/binder/source", []string{http.MethodPost}, source)
+    httpd.NewServicePoint("/test/binder/source/{v}", []string{http.MethodPost}, source)
+}
+
+func TestBindSources(t *testing.T) {
+    handler := newHandler(t, nil)
+    bind := func(target string, body string, headers ...string) sourceInDTO {
+        t.Helper()
+        var output sourceInDTO
+        response := serve(handler, http.MethodPost, target, body, headers...)
+        if assertStatus(t, response, http.StatusOK) {
+            if err := json.Unmarshal(response.Body.Bytes(), &output); err != nil {
+                t.Fatal(err)
+            }
+        }
+        return output
+    }
+    const (
+        jsonType = "application/json"
+        formType = "application/x-www-form-urlencoded"
+    )
+
+    // The first source in the order path, json, form, query, header, cookie wins
+    tests := []struct {
+        target   string
+        body     string
+        headers  []string
+        expected string
+    }{
+        {"/test/binder/source/path?v=query", `{"v":"json"}`, []string{"Content-Type", jsonType, "X-V", "header", "Cookie", "v=cookie"}, "path"},
+        {"/test/binder/source?v=query", `{"v":"json"}`, []string{"Content-Type", jsonType, "X-V", "header", "Cookie", "v=cookie"}, "json"},
+        {"/test/binder/source?v=query", "v=form", []string{"Content-Type", formType, "X-V", "header", "Cookie", "v=cookie"}, "form"},
+        {"/test/binder/source?v=query", "", []string{"X-V", "header", "Cookie", "v=cookie"}, "query"},
+        {"/test/binder/source", "", []string{"X-V", "header", "Cookie", "v=cookie"}, "header"},
+        {"/test/binder/source", "", []string{"Cookie", "v=cookie"}, "cookie"},
+        {"/test/binder/source", "", nil, "none"},
+    }
+    for _, test := range tests {
+        if output := bind(test.target, test.body, test.headers...); output.Value != test.expected {
+            t.Errorf("%s %s: Value = %q, expected %q", test.target, test.body, output.Value, test.expected)
+        }
+    }
+
+    // Tagged fields bind from their tagged source only, by case-sensitive name
+    output := bind("/test/binder/source?PAGE=1&title=query&untagged=query&x-tenant=query&sid=query",
+        `{"page":2,"size":3,"tenant":"json","sid":"json","title":"json"}`,
+        "Content-Type", jsonType, "X-Tenant", "header", "Page", "4", "Cookie", "sid=cookie; title=cookie")
+    expected := sourceInDTO{Value: "none", Size: 20, Tags: []string{"a", "b"}, Tenant: "header", Sid: "cookie", Title: "json", Untagged: "query"}
+    if !reflect.DeepEqual(output, expected) {
+        t.Errorf("bound %+v, expected %+v", output, expected)
+    }
+
+    // Untagged fields bind from the body before the query, defaults give way to sources
+    output = bind("/test/binder/source?untagged=query&size=5&tag=x&tag=y", `{"UNTAGGED":"json"}`, "Content-Type", jsonType)
+    if output.Untagged != "json" || output.Size != 5 || !reflect.DeepEqual(output.Tags, []string{"x", "y"}) {
+        t.Errorf("unexpected binding %+v", output)
+    }
+    output = bind("/test/binder/source?untagged=query", "untagged=form", "Content-Type", formType)
+    if output.Untagged != "form" {
+        t.Errorf("Untagged = %q, expected form", output.Untagged)
+    }
+}
@@ -0,0 +1,138 @@
+package test
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/umeframework/gear/httpd"
+    _ "github.com/umeframework/gear/httpd/test/services"
+)
+
+type benchInterceptor struct {
+    initialized int
+    destroyed   int
+}
+
+func (this *benchInterceptor) Initialize(httpd.PropertyBag) {
+    this.initialized++
+}
+
+func (this *benchInterceptor) Destroy() {
+    this.destroyed++
+}
+
+func (this *benchInterceptor) Intercept(chain httpd.HttpInterceptorChain, request *http.Request, response http.ResponseWriter, context httpd.HttpRequestContext) {
+    chain.DoChain(request, response, context)
+}
+
+type benchResponseWriter struct {
+    header http.Header
+}
+
+func (this *benchResponseWriter) Header() http.Header {
+    return this.header
+}
+
+func (this *benchResponseWriter) Write(data []byte) (int, error) {
+    return len(data), nil
+}
+
+func (this *benchResponseWriter) WriteHeader(int) {
+}
+
+func benchServe(b *testing.B, handler http.Handler, request *http.Request) {
+    response := &benchResponseWriter{header: http.Header{}}
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        handler.ServeHTTP(response, request)
+    }
+}
+
+// Interceptors initialized once, chain reused
+func BenchmarkChainSingleton(b *testing.B) {
+    interceptors := []interface{}{}
+    for i := 0; i < 5; i++ {
+        interceptors = append(interceptors, &benchInterceptor{})
+    }
+    handler := httpd.NewSimpleHttpHandler(interceptors, &httpd.HttpInterceptorExceptionHandlerBase{}, httpd.NewPropertyBag())
+    defer handler.Destroy()
+    benchServe(b, handler, httptest.NewRequest(http.MethodGet, "/", nil))
+    if interceptors[0].(*benchInterceptor).initialized != 1 {
+        b.Fatal("interceptor initialized per request")
+    }
+}
+
+// Interceptors created, initialized and destroyed per request, chain reused
+func BenchmarkChainRequestScoped(b *testing.B) {
+    interceptors := []interface{}{}
+    for i := 0; i < 5; i++ {
+        interceptors = append(interceptors, httpd.CreateInterceptorMethod(func() httpd.HttpInterceptor {
+            return &benchInterceptor{}
+        }))
+    }
+    handler := httpd.NewSimpleHttpHandler(interceptors, &httpd.HttpInterceptorExceptionHandlerBase{}, httpd.NewPropertyBag())
+    defer handler.Destroy()
+    benchServe(b, handler, httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+// Chain of the former lifecycle, cloned for every interceptor
+type cloningChain struct {
+    interceptors     []httpd.HttpInterceptor
+    exceptionHandler httpd.HttpInterceptorExceptionHandler
+}
+
+func (this *cloningChain) Initialize(propertyBag httpd.PropertyBag) {
+    for _, interceptor := range this.interceptors {
+        interceptor.Initialize(propertyBag)
+    }
+}
+
+func (this *cloningChain) Destroy() {
+    for _, interceptor := range this.interceptors {
+        interceptor.Destroy()
+    }
+}
+
+func (this *cloningChain) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+    context := httpd.NewHttpRequestContext()
+    defer func() {
+        if exception := recover(); exception != nil {
+            this.exceptionHandler.HandleException(request, response, context, exception)
+        }
+    }()
+    this.DoChain(request, response, context)
+}
+
+func (this *cloningChain) DoChain(request *http.Request, response http.ResponseWriter, context httpd.HttpRequestContext) {
+    if len(this.interceptors) > 0 {
+        next := &cloningChain{interceptors: this.interceptors[1:]}
+        this.interceptors[0].Intercept(next, request, response, context)
+    }
+}
+
+// The former lifecycle: interceptors and chain built, initialized and destroyed per request
+func BenchmarkChainFormerLifecycle(b *testing.B) {
+    handler := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+        interceptors := make([]httpd.HttpInterceptor, 0)
+        for i := 0; i < 5; i++ {
+            interceptors = append(interceptors, &benchInterceptor{})
+        }
+        chain := &cloningChain{interceptors, &httpd.HttpInterceptorExceptionHandlerBase{}}
+        chain.Initialize(httpd.NewPropertyBag())
+        defer chain.Destroy()
+        chain.ServeHTTP(response, request)
+    })
+    benchServe(b, handler, httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+// Whole request through the sample services
+func BenchmarkInvocation(b *testing.B) {
+    handler := httpd.NewSimpleHttpHandler([]interface{}{
+        &httpd.InvocationInterceptor{},
+        &httpd.ResultRenderInterceptor{},
+    }, &httpd.HttpInterceptorExceptionHandlerBase{}, httpd.NewPropertyBag())
+    defer handler.Destroy()
+    benchServe(b, handler, httptest.NewRequest(http.MethodGet, "/testGet?x=hello&y=world", nil))
+}
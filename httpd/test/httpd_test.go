@@ -0,0 +1,129 @@
+package test
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/umeframework/gear/httpd"
+)
+
+// Handler serving the service points, with the given interceptors before the invocation
+func newHandler(t testing.TB, propertyBag httpd.PropertyBag, interceptors ...interface{}) *httpd.SimpleHttpHandler {
+    if propertyBag == nil {
+        propertyBag = httpd.NewPropertyBag()
+    }
+    interceptors = append(interceptors, &httpd.InvocationInterceptor{}, &httpd.ResultRenderInterceptor{})
+    handler := httpd.NewSimpleHttpHandler(interceptors, &httpd.HttpInterceptorExceptionHandlerBase{}, propertyBag)
+    t.Cleanup(handler.Destroy)
+    return handler
+}
+
+// Serve a request, headers are given as name/value pairs
+func serve(handler http.Handler, method string, target string, body string, headers ...string) *httptest.ResponseRecorder {
+    request := httptest.NewRequest(method, target, strings.NewReader(body))
+    for i := 0; i+1 < len(headers); i += 2 {
+        request.Header.Set(headers[i], headers[i+1])
+    }
+    response := httptest.NewRecorder()
+    handler.ServeHTTP(response, request)
+    return response
+}
+
+func assertStatus(t testing.TB, response *httptest.ResponseRecorder, status int) bool {
+    t.Helper()
+    if response.Code != status {
+        t.Errorf("status = %d, expected %d: %s", response.Code, status, response.Body.String())
+        return false
+    }
+    return true
+}
+
+func assertBody(t testing.TB, response *httptest.ResponseRecorder, body string) bool {
+    t.Helper()
+    if actual := strings.TrimSpace(response.Body.String()); actual != body {
+        t.Errorf("body = %s, expected %s", actual, body)
+        return false
+    }
+    return true
+}
+
+func TestHandlerDestroy(t *testing.T) {
+    interceptor := &benchInterceptor{}
+    handler := httpd.NewSimpleHttpHandler([]interface{}{interceptor}, &httpd.HttpInterceptorExceptionHandlerBase{}, nil)
+    assertStatus(t, serve(handler, http.MethodGet, "/", ""), http.StatusOK)
+
+    handler.Destroy()
+    handler.Destroy()
+    assertStatus(t, serve(handler, http.MethodGet, "/", ""), http.StatusServiceUnavailable)
+    if interceptor.initialized != 1 || interceptor.destroyed != 1 {
+        t.Errorf("initialized %d, destroyed %d times", interceptor.initialized, interceptor.destroyed)
+    }
+
+    // Handlers of NewHttpHandler are destroyed through SimpleHttpHandler
+    var plain http.Handler = httpd.NewHttpHandler(nil, &httpd.HttpInterceptorExceptionHandlerBase{}, nil)
+    if simple, ok := plain.(*httpd.SimpleHttpHandler); !ok {
+        t.Errorf("unexpected handler %T", plain)
+    } else {
+        simple.Destroy()
+    }
+}
+
+// Blocks requests until released, records whether it was destroyed while serving
+type blockingInterceptor struct {
+    entered  chan struct{}
+    release  chan struct{}
+    serving  int32
+    violated int32
+}
+
+func (this *blockingInterceptor) Initialize(httpd.PropertyBag) {
+}
+
+func (this *blockingInterceptor) Destroy() {
+    if atomic.LoadInt32(&this.serving) != 0 {
+        atomic.StoreInt32(&this.violated, 1)
+    }
+}
+
+func (this *blockingInterceptor) Intercept(chain httpd.HttpInterceptorChain, request *http.Request, response http.ResponseWriter, context httpd.HttpRequestContext) {
+    atomic.AddInt32(&this.serving, 1)
+    defer atomic.AddInt32(&this.serving, -1)
+    this.entered <- struct{}{}
+    <-this.release
+    chain.DoChain(request, response, context)
+}
+
+func TestHandlerDestroyWaits(t *testing.T) {
+    interceptor := &blockingInterceptor{entered: make(chan struct{}), release: make(chan struct{})}
+    handler := httpd.NewSimpleHttpHandler([]interface{}{interceptor}, &httpd.HttpInterceptorExceptionHandlerBase{}, nil)
+    served := make(chan int)
+    go func() {
+        served <- serve(handler, http.MethodGet, "/", "").Code
+    }()
+    <-interceptor.entered
+
+    destroyed := make(chan struct{})
+    go func() {
+        handler.Destroy()
+        close(destroyed)
+    }()
+    select {
+    case <-destroyed:
+        t.Fatal("Destroy returned while a request was served")
+    case <-time.After(50 * time.Millisecond):
+    }
+
+    close(interceptor.release)
+    if status := <-served; status != http.StatusOK {
+        t.Errorf("in-flight request status = %d", status)
+    }
+    <-destroyed
+    if atomic.LoadInt32(&interceptor.violated) != 0 {
+        t.Error("interceptor destroyed while serving")
+    }
+    assertStatus(t, serve(handler, http.MethodGet, "/", ""), http.StatusServiceUnavailable)
+}
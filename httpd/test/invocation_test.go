@@ -0,0 +1,88 @@
+package test
+
+import (
+    "fmt"
+    "net/http"
+    "reflect"
+    "testing"
+
+    "github.com/umeframework/gear/httpd"
+)
+
+// Service injected by interface
+type greeter interface {
+    Greet(name string) string
+}
+
+type politeGreeter struct {
+    Greeting string
+}
+
+func (this *politeGreeter) Greet(name string) string {
+    return this.Greeting + ", " + name
+}
+
+// Input bound through a pointer
+type greetInDTO struct {
+    Name string `query:"name" validate:"required"`
+}
+
+func init() {
+    httpd.RegisterService(reflect.TypeOf((*greeter)(nil)).Elem(), &politeGreeter{"hello"})
+    httpd.RegisterService(reflect.TypeOf(&politeGreeter{}), &politeGreeter{"hi"})
+    httpd.NewServicePoint("/test/invocation/greet", []string{http.MethodGet}, func(service greeter, in *greetInDTO) string {
+        return service.Greet(in.Name)
+    })
+    httpd.NewServicePoint("/test/invocation/pointer", []string{http.MethodGet}, func(in *greetInDTO, service *politeGreeter) string {
+        return service.Greet(in.Name)
+    })
+}
+
+func TestServiceInjection(t *testing.T) {
+    handler := newHandler(t, nil)
+
+    // Registered services and pointer DTOs allocated by the binder
+    response := serve(handler, http.MethodGet, "/test/invocation/greet?name=sting", "")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `"hello, sting"`)
+    }
+    response = serve(handler, http.MethodGet, "/test/invocation/pointer?name=sting", "")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `"hi, sting"`)
+    }
+    assertStatus(t, serve(handler, http.MethodGet, "/test/invocation/greet", ""), http.StatusBadRequest)
+
+    // The handler PropertyBag overrides registered services
+    propertyBag := httpd.NewPropertyBag()
+    propertyBag.SetInterface(reflect.TypeOf((*greeter)(nil)).Elem(), &politeGreeter{"welcome"})
+    handler = newHandler(t, propertyBag)
+    response = serve(handler, http.MethodGet, "/test/invocation/greet?name=sting", "")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `"welcome, sting"`)
+    }
+}
+
+func TestUnregisteredService(t *testing.T) {
+    handlers := []interface{}{
+        func(service fmt.Stringer) string { return service.String() },
+        func(count *int) int { return *count },
+    }
+    for _, handler := range handlers {
+        func() {
+            defer func() {
+                if recover() == nil {
+                    t.Errorf("%T should fail at registration", handler)
+                }
+            }()
+            httpd.NewServicePoint("/test/invocation/unregistered", []string{http.MethodGet}, handler)
+        }()
+    }
+
+    // Services must be assignable to their type
+    defer func() {
+        if recover() == nil {
+            t.Error("registering a service of another type should panic")
+        }
+    }()
+    httpd.RegisterService(reflect.TypeOf((*greeter)(nil)).Elem(), "hello")
+}
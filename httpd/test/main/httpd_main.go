@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"github.com/umeframework/gear/httpd"
 	_ "github.com/umeframework/gear/test/services"
 )
@@ -16,12 +21,28 @@ func main() {
 		Addr: ":8090",
 		Handler: handler,
 	}
-	log.Fatal(server.ListenAndServe())
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Interceptors are initialized once by NewSimpleHttpHandler, and destroyed once
+	// the server has stopped serving
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelTimeout()
+	if err := server.Shutdown(timeout); err != nil {
+		log.Println(err)
+	}
+	handler.Destroy()
 }
 
-func makeHandler() http.Handler {
+func makeHandler() *httpd.SimpleHttpHandler {
 	propertyBag := httpd.NewPropertyBag()
-	handler := httpd.NewHttpHandler(
+	handler := httpd.NewSimpleHttpHandler(
 		[]interface{}{
 			&httpd.AuthenticationInterceptor{},
 			&httpd.AuthorizationInterceptor{},
@@ -0,0 +1,74 @@
+package test
+
+import (
+    "net/http"
+    "testing"
+
+    "github.com/umeframework/gear/httpd"
+)
+
+func init() {
+    httpd.NewServicePoint("/test/method/{id:int}", []string{http.MethodGet}, func(params httpd.HttpRequestPathParam) string {
+        return "get " + params["id"]
+    })
+    httpd.NewServicePoint("/test/method/{id:int}", []string{http.MethodDelete}, func(params httpd.HttpRequestPathParam) string {
+        return "delete " + params["id"]
+    })
+    httpd.NewServicePoint("/test/method/any", nil, func(request *http.Request) string {
+        return request.Method
+    })
+    httpd.NewServicePoint("/test/method/options", []string{http.MethodOptions}, func() *httpd.HttpResponse {
+        return httpd.NewHttpResponse(http.StatusOK, nil).SetHeader("Allow", "OPTIONS")
+    })
+}
+
+func TestMethodHandling(t *testing.T) {
+    handler := newHandler(t, nil)
+
+    // Handlers per method on the same pattern
+    response := serve(handler, http.MethodGet, "/test/method/7", "")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `"get 7"`)
+    }
+    response = serve(handler, http.MethodDelete, "/test/method/7", "")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `"delete 7"`)
+    }
+
+    // 405 with the allowed methods
+    response = serve(handler, http.MethodPost, "/test/method/7", "")
+    assertStatus(t, response, http.StatusMethodNotAllowed)
+    if allow := response.Header().Get("Allow"); allow != "GET, HEAD, DELETE, OPTIONS" {
+        t.Errorf("Allow = %q", allow)
+    }
+
+    // Automatic OPTIONS
+    response = serve(handler, http.MethodOptions, "/test/method/7", "")
+    assertStatus(t, response, http.StatusNoContent)
+    if allow := response.Header().Get("Allow"); allow != "GET, HEAD, DELETE, OPTIONS" {
+        t.Errorf("Allow = %q", allow)
+    }
+    response = serve(handler, http.MethodOptions, "/test/method/options", "")
+    if assertStatus(t, response, http.StatusOK) && response.Header().Get("Allow") != "OPTIONS" {
+        t.Errorf("explicit OPTIONS handler should answer: %v", response.Header())
+    }
+
+    // HEAD falls back to GET
+    response = serve(handler, http.MethodHead, "/test/method/7", "")
+    if assertStatus(t, response, http.StatusOK) && response.Header().Get("Content-Type") == "" {
+        t.Errorf("HEAD should carry the GET headers: %v", response.Header())
+    }
+
+    // Service points without methods answer any method but OPTIONS
+    for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPatch} {
+        response = serve(handler, method, "/test/method/any", "")
+        if assertStatus(t, response, http.StatusOK) {
+            assertBody(t, response, `"`+method+`"`)
+        }
+    }
+    response = serve(handler, http.MethodOptions, "/test/method/any", "")
+    assertStatus(t, response, http.StatusNoContent)
+    if allow := response.Header().Get("Allow"); allow != "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS" {
+        t.Errorf("Allow = %q", allow)
+    }
+}
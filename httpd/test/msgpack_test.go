@@ -0,0 +1,162 @@
+package test
+
+import (
+    "bytes"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/umeframework/gear/httpd"
+)
+
+// Value of the msgpack round-trip test
+type msgpackDTO struct {
+    Title    string            `msgpack:"title"`
+    Year     int               `json:"year"`
+    Rating   float64
+    Small    int8
+    Large    uint64
+    Negative int64
+    Live     bool
+    Cover    []byte
+    Tracks   []string
+    Credits  map[string]string
+    Released time.Time
+    Label    *string
+    Empty    []int
+}
+
+func msgpackCodec(t *testing.T) httpd.Codec {
+    t.Helper()
+    codec, found := httpd.LookupCodec("application/msgpack")
+    if !found {
+        t.Fatal("msgpack codec not registered")
+    }
+    return codec
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+    codec := msgpackCodec(t)
+    label := "A&M"
+    value := msgpackDTO{
+        Title:    strings.Repeat("synchronicity ", 3),
+        Year:     1983,
+        Rating:   4.5,
+        Small:    -100,
+        Large:    1 << 40,
+        Negative: -1 << 33,
+        Live:     true,
+        Cover:    []byte{0, 1, 2, 255},
+        Tracks:   []string{"Every Breath You Take", "King of Pain"},
+        Credits:  map[string]string{"producer": "Hugh Padgham"},
+        Released: time.Date(1983, 6, 17, 0, 0, 0, 0, time.UTC),
+        Label:    &label,
+    }
+    data, err := codec.Marshal(value)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var decoded msgpackDTO
+    if err := codec.Unmarshal(data, &decoded); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(decoded, value) {
+        t.Errorf("decoded %+v, expected %+v", decoded, value)
+    }
+
+    // Generic values decode like JSON
+    var generic interface{}
+    if err := codec.Unmarshal(data, &generic); err != nil {
+        t.Fatal(err)
+    }
+    fields, _ := generic.(map[string]interface{})
+    if fields["title"] != value.Title || fields["year"] != int64(1983) || fields["Rating"] != 4.5 ||
+        !bytes.Equal(fields["Cover"].([]byte), value.Cover) || fields["Empty"] != nil {
+        t.Errorf("unexpected generic value %v", generic)
+    }
+}
+
+func TestMsgpackMalformed(t *testing.T) {
+    codec := msgpackCodec(t)
+    nested := func(depth int) []byte {
+        return append(bytes.Repeat([]byte{0x91}, depth), 0xc0)
+    }
+    tests := []struct {
+        name string
+        data []byte
+        err  string
+    }{
+        {"empty", nil, "truncated msgpack data"},
+        {"truncated string", []byte{0xa5, 'a', 'b'}, "truncated msgpack data"},
+        {"truncated float", []byte{0xcb, 0, 0}, "truncated msgpack data"},
+        {"array longer than data", []byte{0xdd, 0xff, 0xff, 0xff, 0xff, 0xc0}, "truncated msgpack data"},
+        {"map without value", []byte{0x81, 0xa1, 'a'}, "truncated msgpack data"},
+        {"unsupported type", []byte{0xc1}, "unsupported msgpack type 0xc1"},
+        {"trailing bytes", []byte{0xc0, 0xc0}, "1 bytes after msgpack value"},
+        {"too deep", nested(10001), "msgpack data nested deeper than 10000 levels"},
+        {"too deep map", append(bytes.Repeat([]byte{0x81, 0xa1, 'a'}, 10001), 0xc0), "msgpack data nested deeper than 10000 levels"},
+    }
+    for _, test := range tests {
+        var value interface{}
+        if err := codec.Unmarshal(test.data, &value); err == nil || err.Error() != test.err {
+            t.Errorf("%s: err = %v, expected %s", test.name, err, test.err)
+        }
+    }
+
+    var value interface{}
+    if err := codec.Unmarshal(nested(10000), &value); err != nil {
+        t.Errorf("10000 levels: unexpected err %v", err)
+    }
+}
+
+func init() {
+    httpd.NewServicePoint("/test/codec/map", []string{http.MethodPost}, func(in map[string]interface{}) int {
+        return len(in)
+    })
+}
+
+func TestXmlNesting(t *testing.T) {
+    codec, found := httpd.LookupCodec("application/xml")
+    if !found {
+        t.Fatal("xml codec not registered")
+    }
+    nested := func(depth int) string {
+        return strings.Repeat("<a>", depth) + "x" + strings.Repeat("</a>", depth)
+    }
+    var value interface{}
+    if err := codec.Unmarshal([]byte(nested(10000)), &value); err != nil {
+        t.Errorf("10000 levels: unexpected err %v", err)
+    }
+    if err := codec.Unmarshal([]byte(nested(10001)), &value); err == nil || err.Error() != "xml data nested deeper than 10000 levels" {
+        t.Errorf("10001 levels: err = %v", err)
+    }
+
+    // Rejected as a bad request, whatever the nesting
+    handler := newHandler(t, nil)
+    response := serve(handler, http.MethodPost, "/test/codec/map", nested(1000000), "Content-Type", "application/xml")
+    if assertStatus(t, response, http.StatusBadRequest) && !strings.Contains(response.Body.String(), "nested deeper than 10000 levels") {
+        t.Errorf("unexpected body %s", response.Body.String())
+    }
+    response = serve(handler, http.MethodPost, "/test/codec/map", "<album><title>Zenyatta Mondatta</title></album>", "Content-Type", "application/xml")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, "1")
+    }
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+    limit := httpd.MaxRequestBodySize
+    httpd.MaxRequestBodySize = 64
+    defer func() {
+        httpd.MaxRequestBodySize = limit
+    }()
+    handler := newHandler(t, nil)
+
+    body := `{"Count":1,"Tags":[` + strings.Repeat("1,", 40) + `1]}`
+    response := serve(handler, http.MethodPost, "/test/binder/convert", body, "Content-Type", "application/json")
+    assertStatus(t, response, http.StatusRequestEntityTooLarge)
+
+    response = serve(handler, http.MethodPost, "/test/binder/convert", `{"Count":1}`, "Content-Type", "application/json")
+    assertStatus(t, response, http.StatusOK)
+}
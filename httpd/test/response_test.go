@@ -0,0 +1,129 @@
+package test
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/httpd"
+    "github.com/umeframework/gear/orm"
+)
+
+var (
+    errorAlbumLocked   = errors.New("album is locked")
+    errorAlbumArchived = errors.New("album is archived")
+)
+
+func init() {
+    httpd.RegisterErrorStatus(errorAlbumLocked, http.StatusConflict)
+    // Mappers registered later take precedence
+    httpd.RegisterErrorStatus(errorAlbumArchived, http.StatusConflict)
+    httpd.RegisterErrorMapper(func(err error) (int, bool) {
+        return http.StatusGone, errors.Is(err, errorAlbumArchived)
+    })
+
+    httpd.NewServicePoint("/test/response/error/{name}", []string{http.MethodGet}, func(params httpd.HttpRequestPathParam) (string, error) {
+        switch params["name"] {
+        case "locked":
+            return "", fmt.Errorf("update album 7: %w", errorAlbumLocked)
+        case "archived":
+            return "", errorAlbumArchived
+        case "notfound":
+            return "", orm.ErrorRecordNotFound
+        case "panic":
+            panic(errors.New("dial tcp 10.0.0.5:3306: connection refused"))
+        case "fields":
+            // Exported fields are serialized as JSON
+            return "", &os.PathError{Op: "open", Path: "/etc/gear/password.key", Err: os.ErrPermission}
+        case "value":
+            panic("password=secret rejected by 10.0.0.5")
+        }
+        return "", errors.New("password=secret rejected by db")
+    })
+    httpd.NewServicePoint("/test/response/created", []string{http.MethodPost}, func() *httpd.HttpResponse {
+        return httpd.Created("/albums/7", map[string]int{"id": 7})
+    })
+    httpd.NewServicePoint("/test/response/nocontent", []string{http.MethodDelete}, func() *httpd.HttpResponse {
+        return httpd.NoContent()
+    })
+    httpd.NewServicePoint("/test/response/redirect", []string{http.MethodGet}, func(request *http.Request) *httpd.HttpResponse {
+        if request.URL.Query().Get("permanent") != "" {
+            return httpd.Redirect("/albums", http.StatusMovedPermanently)
+        }
+        return httpd.Redirect("/albums", 0)
+    })
+}
+
+func TestErrorStatus(t *testing.T) {
+    handler := newHandler(t, nil)
+    tests := []struct {
+        name    string
+        status  int
+        content string
+    }{
+        {"locked", http.StatusConflict, "update album 7: album is locked"},
+        {"archived", http.StatusGone, "album is archived"},
+        {"notfound", http.StatusNotFound, orm.ErrorRecordNotFound.Error()},
+        // Unmapped errors do not reach the client
+        {"unmapped", http.StatusInternalServerError, "Internal Server Error"},
+        {"panic", http.StatusInternalServerError, "Internal Server Error"},
+        {"fields", http.StatusInternalServerError, "Internal Server Error"},
+        {"value", http.StatusInternalServerError, "Internal Server Error"},
+    }
+    for _, test := range tests {
+        response := serve(handler, http.MethodGet, "/test/response/error/"+test.name, "")
+        if !assertStatus(t, response, test.status) {
+            continue
+        }
+        var output struct {
+            StatusCode int    `json:"statusCode"`
+            Content    string `json:"content"`
+        }
+        if err := json.Unmarshal(response.Body.Bytes(), &output); err != nil {
+            t.Fatal(err)
+        }
+        if output.StatusCode != test.status || output.Content != test.content {
+            t.Errorf("%s: unexpected output %s", test.name, response.Body.String())
+        }
+        for _, secret := range []string{"password", "10.0.0.5"} {
+            if strings.Contains(response.Body.String(), secret) {
+                t.Errorf("%s: error message exposed: %s", test.name, response.Body.String())
+            }
+        }
+        // Cause and stack of server errors are logged only
+        exposed := strings.Contains(response.Body.String(), `"cause"`) || strings.Contains(response.Body.String(), `"stack"`)
+        if exposed != (test.status < http.StatusInternalServerError) {
+            t.Errorf("%s: unexpected details in %s", test.name, response.Body.String())
+        }
+    }
+}
+
+func TestHttpResponse(t *testing.T) {
+    handler := newHandler(t, nil)
+
+    response := serve(handler, http.MethodPost, "/test/response/created", "")
+    if assertStatus(t, response, http.StatusCreated) {
+        assertBody(t, response, `{"id":7}`)
+        if location := response.Header().Get("Location"); location != "/albums/7" {
+            t.Errorf("Location = %q", location)
+        }
+    }
+
+    response = serve(handler, http.MethodDelete, "/test/response/nocontent", "")
+    if assertStatus(t, response, http.StatusNoContent) && response.Body.Len() != 0 {
+        t.Errorf("204 with body %q", response.Body.String())
+    }
+
+    response = serve(handler, http.MethodGet, "/test/response/redirect", "")
+    if assertStatus(t, response, http.StatusFound) && response.Header().Get("Location") != "/albums" {
+        t.Errorf("Location = %q", response.Header().Get("Location"))
+    }
+    response = serve(handler, http.MethodGet, "/test/response/redirect?permanent=1", "")
+    if assertStatus(t, response, http.StatusMovedPermanently) && response.Header().Get("Location") != "/albums" {
+        t.Errorf("Location = %q", response.Header().Get("Location"))
+    }
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+    "net/http"
+    "reflect"
+    "testing"
+
+    "github.com/umeframework/gear/httpd"
+)
+
+func newRouter(patterns ...string) *httpd.Router {
+    router := httpd.NewRouter()
+    for _, pattern := range patterns {
+        router.Add(&httpd.ServicePoint{UrlPattern: pattern, Methods: []string{http.MethodGet}})
+    }
+    return router
+}
+
+func TestRouterMatch(t *testing.T) {
+    router := newRouter(
+        "/albums",
+        "/albums/latest",
+        "/albums/{id:int}",
+        "/albums/{slug}",
+        "/albums/{id:int}/tracks/{no:int}",
+        "/files/{path...}",
+        "/static/{path...}",
+        "/static/index.html",
+    )
+    tests := []struct {
+        path    string
+        pattern string
+        params  httpd.HttpRequestPathParam
+    }{
+        // Static before constrained before plain parameters
+        {"/albums/latest", "/albums/latest", httpd.HttpRequestPathParam{}},
+        {"/albums/42", "/albums/{id:int}", httpd.HttpRequestPathParam{"id": "42"}},
+        {"/albums/ten-summoners-tales", "/albums/{slug}", httpd.HttpRequestPathParam{"slug": "ten-summoners-tales"}},
+        {"/albums/42/tracks/3", "/albums/{id:int}/tracks/{no:int}", httpd.HttpRequestPathParam{"id": "42", "no": "3"}},
+        // Static segments are case-insensitive, parameter values keep their case
+        {"/ALBUMS/Latest", "/albums/latest", httpd.HttpRequestPathParam{}},
+        {"/Albums/Soul-Cages", "/albums/{slug}", httpd.HttpRequestPathParam{"slug": "Soul-Cages"}},
+        // Wildcards match the rest of the path, including an empty rest after the slash
+        {"/files/a/b/c.txt", "/files/{path...}", httpd.HttpRequestPathParam{"path": "a/b/c.txt"}},
+        {"/files/", "/files/{path...}", httpd.HttpRequestPathParam{"path": ""}},
+        {"/static/index.html", "/static/index.html", httpd.HttpRequestPathParam{}},
+        {"/static/css/site.css", "/static/{path...}", httpd.HttpRequestPathParam{"path": "css/site.css"}},
+    }
+    for _, test := range tests {
+        servicePoint, params, _ := router.Match(http.MethodGet, test.path)
+        if servicePoint == nil {
+            t.Errorf("%s: not matched, expected %s", test.path, test.pattern)
+            continue
+        }
+        if servicePoint.UrlPattern != test.pattern || !reflect.DeepEqual(params, test.params) {
+            t.Errorf("%s: matched %s %v, expected %s %v", test.path, servicePoint.UrlPattern, params, test.pattern, test.params)
+        }
+    }
+
+    // Not matched
+    for _, path := range []string{"/files", "/albums/42/tracks/x", "/albums/42/extra", "/unknown"} {
+        if servicePoint, params, allowed := router.Match(http.MethodGet, path); servicePoint != nil || params != nil || allowed != nil {
+            t.Errorf("%s: unexpected match %v %v %v", path, servicePoint, params, allowed)
+        }
+    }
+}
+
+func TestRouterConflict(t *testing.T) {
+    tests := []struct {
+        registered string
+        pattern    string
+    }{
+        {"/albums/{id}", "/albums/{id}"},
+        {"/albums/{id}", "/ALBUMS/{id}"},
+        {"/albums/{id}", "/albums/{slug}"},
+        {"/albums/{id:int}", "/albums/{no:int}"},
+        {"/files/{path...}", "/files/{rest...}"},
+        {"", "albums"},
+        {"", "/albums/{id"},
+        {"", "/albums/x{id}"},
+        {"", "/albums/{id}/{id}"},
+        {"", "/files/{path...}/x"},
+        {"", "/albums/{id:unknown}"},
+    }
+    for _, test := range tests {
+        func() {
+            defer func() {
+                if recover() == nil {
+                    t.Errorf("%s after %q should panic", test.pattern, test.registered)
+                }
+            }()
+            router := httpd.NewRouter()
+            if test.registered != "" {
+                router.Add(&httpd.ServicePoint{UrlPattern: test.registered, Methods: []string{http.MethodGet}})
+            }
+            router.Add(&httpd.ServicePoint{UrlPattern: test.pattern, Methods: []string{http.MethodGet}})
+        }()
+    }
+
+    // Same pattern with different methods is not a conflict
+    router := httpd.NewRouter()
+    router.Add(&httpd.ServicePoint{UrlPattern: "/albums/{id}", Methods: []string{http.MethodGet}})
+    router.Add(&httpd.ServicePoint{UrlPattern: "/albums/{id}", Methods: []string{http.MethodPut}})
+    if servicePoint, _, _ := router.Match(http.MethodPut, "/albums/1"); servicePoint == nil || servicePoint.Methods[0] != http.MethodPut {
+        t.Errorf("unexpected service point for PUT: %v", servicePoint)
+    }
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"github.com/umeframework/gear/httpd"
 	"fmt"
+	"net/http"
 )
 
 // Test for simple query params & return dto
@@ -26,8 +27,8 @@ func testGet(context httpd.HttpRequestContext, inDTO testGetInDTO) testGetOutDTO
 // Test for different kind of query params
 // [GET] /testGet2?id=100&name=tom
 type testGet2InDTO struct {
-	Id int
-	Name string
+	Id int `validate:"min=1"`
+	Name string `validate:"required,max=20"`
 }
 
 func testGet2(context httpd.HttpRequestContext, inDTO testGet2InDTO) string {
@@ -35,7 +36,6 @@ func testGet2(context httpd.HttpRequestContext, inDTO testGet2InDTO) string {
 }
 
 
-// TODO: implement for path params
 // Test for combination of query params and path params
 // [GET] /testGet3/2018?id=100&name=test
 type testGet3InDTO struct {
@@ -48,8 +48,73 @@ func testGet3(context httpd.HttpRequestContext, inDTO testGet3InDTO) string {
 	return fmt.Sprintf("id = %d, name = %s, year = %d", inDTO.Id, inDTO.Name, inDTO.Year)
 }
 
+// Test for binding sources, wire names and defaults
+// [GET] /testGet4/2018?q=rock
+// HEADER: X-Tenant: acme
+type testGet4InDTO struct {
+	Year   int    `path:"year"`
+	Query  string `query:"q"`
+	Tenant string `header:"X-Tenant"`
+	Size   int    `query:"size" default:"20"`
+}
+
+func testGet4(context httpd.HttpRequestContext, inDTO testGet4InDTO) string {
+	return fmt.Sprintf("year = %d, q = %s, tenant = %s, size = %d", inDTO.Year, inDTO.Query, inDTO.Tenant, inDTO.Size)
+}
+
+// Test for injected arguments in any order
+// [GET] /testGet5/rock?page=2
+type testGet5InDTO struct {
+	Page int `query:"page" default:"1"`
+}
+
+func testGet5(request *http.Request, inDTO testGet5InDTO, pathParams httpd.HttpRequestPathParam) string {
+	return fmt.Sprintf("%s %s, genre = %s, page = %d", request.Method, request.URL.Path, pathParams["genre"], inDTO.Page)
+}
+
+// Test for different handlers per method on the same pattern
+// [GET] /testMethod/100
+// [DELETE] /testMethod/100
+type testMethodInDTO struct {
+	Id int
+}
+
+func testMethodGet(context httpd.HttpRequestContext, inDTO testMethodInDTO) string {
+	return fmt.Sprintf("get %d", inDTO.Id)
+}
+
+func testMethodDelete(context httpd.HttpRequestContext, inDTO testMethodInDTO) string {
+	return fmt.Sprintf("delete %d", inDTO.Id)
+}
+
+// Test for content negotiation
+// [GET] /testGet6?count=3
+// HEADERS:
+//	Accept: text/csv (or application/xml, application/msgpack, ...; JSON if not set)
+type testGet6InDTO struct {
+	Count int `query:"count" default:"3" validate:"max=100"`
+}
+
+type testGet6OutDTO struct {
+	Id int `json:"id"`
+	Name string `json:"name"`
+}
+
+func testGet6(context httpd.HttpRequestContext, inDTO testGet6InDTO) []testGet6OutDTO {
+	ret := []testGet6OutDTO{}
+	for i := 1; i <= inDTO.Count; i++ {
+		ret = append(ret, testGet6OutDTO{i, fmt.Sprintf("item %d", i)})
+	}
+	return ret
+}
+
 func init() {
 	httpd.NewServicePoint("/testGet", nil, testGet)
 	httpd.NewServicePoint("/testGet2", nil, testGet2)
-	httpd.NewServicePoint("/testGet3", nil, testGet3)
+	httpd.NewServicePoint("/testGet3/{year:int}", nil, testGet3)
+	httpd.NewServicePoint("/testGet4/{year:int}", []string{http.MethodGet}, testGet4)
+	httpd.NewServicePoint("/testGet5/{genre}", []string{http.MethodGet}, testGet5)
+	httpd.NewServicePoint("/testGet6", []string{http.MethodGet}, testGet6)
+	httpd.NewServicePoint("/testMethod/{id:int}", []string{http.MethodGet}, testMethodGet)
+	httpd.NewServicePoint("/testMethod/{id:int}", []string{http.MethodDelete}, testMethodDelete)
 }
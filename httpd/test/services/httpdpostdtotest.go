@@ -2,7 +2,10 @@ package services
 
 import (
 	"github.com/umeframework/gear/httpd"
+	"github.com/umeframework/gear/orm"
+	"errors"
 	"fmt"
+	"net/http"
 )
 
 // Test for simple post DTO
@@ -42,9 +45,29 @@ func postDto3(context httpd.HttpRequestContext, inDTO postDto3InDTO) string {
 	return fmt.Sprintf("id: %d, name: %s, year: %d", inDTO.Id, inDTO.Name, inDTO.Year)
 }
 
+// Test for (result, error) returns
+// [POST] /postDto4
+// REQUEST BODY:
+//	{"id": 100, "name": "jackson"}
+// 201 with Location /postDto4/100, 404 if id is 0, 500 if id is negative
+type postDto4InDTO struct {
+	Id int
+	Name string
+}
+
+func postDto4(context httpd.HttpRequestContext, inDTO postDto4InDTO) (*httpd.HttpResponse, error) {
+	if inDTO.Id == 0 {
+		return nil, orm.ErrorRecordNotFound
+	} else if inDTO.Id < 0 {
+		return nil, errors.New("invalid id")
+	}
+	return httpd.Created(fmt.Sprintf("/postDto4/%d", inDTO.Id), inDTO), nil
+}
+
 
 func init() {
 	httpd.NewServicePoint("/postDto", nil, postDto)
 	httpd.NewServicePoint("/postDto2", nil, postDto2)
 	httpd.NewServicePoint("/postDto3", nil, postDto3)
+	httpd.NewServicePoint("/postDto4", []string{http.MethodPost}, postDto4)
 }
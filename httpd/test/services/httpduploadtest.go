@@ -0,0 +1,66 @@
+package services
+
+import (
+	"github.com/umeframework/gear/httpd"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// Test for multipart uploads
+// [POST] /postUpload/100
+// REQUEST BODY (multipart/form-data):
+//	title=Blue Train, cover=<file>, booklet=<file>
+type postUploadInDTO struct {
+	Id int `path:"id"`
+	Title string `form:"title" validate:"required"`
+	// Whole file, e.g. for a BLOB column
+	Cover []byte `form:"cover" validate:"required"`
+	CoverHeader *multipart.FileHeader `form:"cover"`
+	// Opened file, closed once the handler returns
+	Booklet io.Reader `form:"booklet"`
+}
+
+func postUpload(context httpd.HttpRequestContext, inDTO postUploadInDTO) (*httpd.HttpResponse, error) {
+	bookletSize := int64(0)
+	if inDTO.Booklet != nil {
+		n, err := io.Copy(io.Discard, inDTO.Booklet)
+		if err != nil {
+			return nil, err
+		}
+		bookletSize = n
+	}
+	return httpd.Created(fmt.Sprintf("/postUpload/%d", inDTO.Id), map[string]interface{}{
+		"title": inDTO.Title,
+		"cover": inDTO.CoverHeader.Filename,
+		"coverSize": len(inDTO.Cover),
+		"bookletSize": bookletSize,
+	}), nil
+}
+
+// Test for streamed uploads, parts are read as they arrive (limited by httpd.MaxUploadSize
+// and httpd.MaxUploadFileSize)
+// [POST] /postUploadStream
+// REQUEST BODY (multipart/form-data)
+func postUploadStream(reader *multipart.Reader) (map[string]int64, error) {
+	sizes := map[string]int64{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return sizes, nil
+		} else if err != nil {
+			return nil, err
+		}
+		n, err := io.Copy(io.Discard, part)
+		if err != nil {
+			return nil, err
+		}
+		sizes[part.FormName()] += n
+	}
+}
+
+func init() {
+	httpd.NewServicePoint("/postUpload/{id:int}", []string{http.MethodPost}, postUpload)
+	httpd.NewServicePoint("/postUploadStream", []string{http.MethodPost}, postUploadStream)
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+
+    "github.com/umeframework/gear/httpd"
+    "github.com/umeframework/gear/orm"
+)
+
+func init() {
+    httpd.RegisterService(reflect.TypeOf(orm.OrmContext{}), orm.NewOrmContext("mysql", nil))
+    httpd.NewServicePoint("/test/tenant", []string{http.MethodGet}, func(ctx orm.OrmContext, context httpd.HttpRequestContext) []string {
+        return []string{ctx.Tenant(), httpd.RequestTenant(context)}
+    })
+}
+
+func TestTenantInterceptor(t *testing.T) {
+    propertyBag := httpd.NewPropertyBag()
+    propertyBag.SetInterface(reflect.TypeOf(orm.OrmContext{}), orm.NewOrmContext("mysql", nil))
+
+    handler := newHandler(t, propertyBag, &httpd.TenantInterceptor{TrustedHeader: true})
+    response := serve(handler, http.MethodGet, "/test/tenant", "", "X-Tenant-Id", "acme")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `["acme","acme"]`)
+    }
+    response = serve(handler, http.MethodGet, "/test/tenant", "")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `["",""]`)
+    }
+
+    // Required tenant from a custom header
+    propertyBag.SetValue(httpd.TenantHeaderProperty, "X-Customer")
+    handler = newHandler(t, propertyBag, &httpd.TenantInterceptor{TrustedHeader: true, Required: true})
+    assertStatus(t, serve(handler, http.MethodGet, "/test/tenant", "", "X-Tenant-Id", "acme"), http.StatusBadRequest)
+    response = serve(handler, http.MethodGet, "/test/tenant", "", "X-Customer", "globex")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `["globex","globex"]`)
+    }
+
+    // Custom resolver
+    handler = newHandler(t, propertyBag, &httpd.TenantInterceptor{Resolver: func(request *http.Request) string {
+        return request.URL.Query().Get("tenant")
+    }})
+    response = serve(handler, http.MethodGet, "/test/tenant?tenant=initech", "", "X-Customer", "globex")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `["initech","initech"]`)
+    }
+}
+
+func TestTenantHeaderNotDefault(t *testing.T) {
+    // Client headers are ignored unless trusted
+    request := httptest.NewRequest(http.MethodGet, "/test/tenant", nil)
+    request.Header.Set(httpd.DefaultTenantHeader, "acme")
+    if tenant := (&httpd.TenantInterceptor{}).ResolveTenant(request); tenant != "" {
+        t.Errorf("tenant %q resolved from an untrusted header", tenant)
+    }
+
+    // Neither a resolver nor a trusted header
+    defer func() {
+        if recover() != httpd.ErrorTenantResolverRequired {
+            t.Error("header-only tenant interceptor should fail at initialization")
+        }
+    }()
+    httpd.NewSimpleHttpHandler([]interface{}{&httpd.TenantInterceptor{Required: true}}, &httpd.HttpInterceptorExceptionHandlerBase{}, nil)
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/httpd"
+)
+
+// Input of the upload tests
+type uploadInDTO struct {
+    Title string                `form:"title"`
+    Cover *multipart.FileHeader `form:"cover"`
+    Data  io.Reader             `form:"cover"`
+}
+
+func init() {
+    httpd.NewServicePoint("/test/upload", []string{http.MethodPost}, func(in uploadInDTO) (string, error) {
+        n, err := io.Copy(io.Discard, in.Data)
+        return fmt.Sprintf("%s %s %d", in.Title, in.Cover.Filename, n), err
+    })
+    httpd.NewServicePoint("/test/upload/stream", []string{http.MethodPost}, func(reader *multipart.Reader) (map[string]int64, error) {
+        sizes := map[string]int64{}
+        for {
+            part, err := reader.NextPart()
+            if err == io.EOF {
+                return sizes, nil
+            } else if err != nil {
+                return nil, err
+            }
+            n, err := io.Copy(io.Discard, part)
+            if err != nil {
+                return nil, err
+            }
+            sizes[part.FormName()] += n
+        }
+    })
+}
+
+// Multipart body with a title and a cover file of the given size
+func uploadBody(t *testing.T, size int) (string, string) {
+    t.Helper()
+    buffer := &bytes.Buffer{}
+    writer := multipart.NewWriter(buffer)
+    writer.WriteField("title", "Outlandos d'Amour")
+    file, err := writer.CreateFormFile("cover", "cover.png")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Line breaks and dashes as in a boundary
+    file.Write([]byte(strings.Repeat("\r\n--x", size/5+1)[:size]))
+    writer.Close()
+    return buffer.String(), writer.FormDataContentType()
+}
+
+// Run with small limits and temp files in a directory of the test
+func withUploadLimits(t *testing.T, fileSize int64, size int64) string {
+    limits := []int64{httpd.MaxUploadFileSize, httpd.MaxUploadSize, httpd.UploadMemoryLimit}
+    httpd.MaxUploadFileSize, httpd.MaxUploadSize, httpd.UploadMemoryLimit = fileSize, size, 16
+    t.Cleanup(func() {
+        httpd.MaxUploadFileSize, httpd.MaxUploadSize, httpd.UploadMemoryLimit = limits[0], limits[1], limits[2]
+    })
+    dir := t.TempDir()
+    t.Setenv("TMPDIR", dir)
+    return dir
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+    t.Helper()
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(entries) > 0 {
+        t.Errorf("%d temp files left in %s", len(entries), dir)
+    }
+}
+
+func TestUploadLimits(t *testing.T) {
+    dir := withUploadLimits(t, 1000, 4000)
+    handler := newHandler(t, nil)
+
+    // Files up to the limit are spooled and removed once the handler returns
+    body, contentType := uploadBody(t, 1000)
+    response := serve(handler, http.MethodPost, "/test/upload", body, "Content-Type", contentType)
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `"Outlandos d'Amour cover.png 1000"`)
+    }
+    assertNoTempFiles(t, dir)
+
+    // A file over the limit is rejected while it is read
+    body, contentType = uploadBody(t, 1001)
+    response = serve(handler, http.MethodPost, "/test/upload", body, "Content-Type", contentType)
+    if assertStatus(t, response, http.StatusRequestEntityTooLarge) && !strings.Contains(response.Body.String(), "a part exceeds 1000 bytes") {
+        t.Errorf("unexpected body %s", response.Body.String())
+    }
+    assertNoTempFiles(t, dir)
+
+    // The whole body over its limit
+    httpd.MaxUploadFileSize = 0
+    body, contentType = uploadBody(t, 5000)
+    response = serve(handler, http.MethodPost, "/test/upload", body, "Content-Type", contentType)
+    if assertStatus(t, response, http.StatusRequestEntityTooLarge) && !strings.Contains(response.Body.String(), "request body exceeds 4000 bytes") {
+        t.Errorf("unexpected body %s", response.Body.String())
+    }
+    assertNoTempFiles(t, dir)
+}
+
+func TestUploadStream(t *testing.T) {
+    withUploadLimits(t, 1000, 4000)
+    handler := newHandler(t, nil)
+
+    body, contentType := uploadBody(t, 1000)
+    response := serve(handler, http.MethodPost, "/test/upload/stream", body, "Content-Type", contentType)
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `{"cover":1000,"title":17}`)
+    }
+
+    // Limits apply to the parts read by the handler
+    body, contentType = uploadBody(t, 1001)
+    response = serve(handler, http.MethodPost, "/test/upload/stream", body, "Content-Type", contentType)
+    assertStatus(t, response, http.StatusRequestEntityTooLarge)
+    httpd.MaxUploadFileSize = 0
+    body, contentType = uploadBody(t, 5000)
+    response = serve(handler, http.MethodPost, "/test/upload/stream", body, "Content-Type", contentType)
+    assertStatus(t, response, http.StatusRequestEntityTooLarge)
+
+    // Streaming handlers need a multipart body
+    response = serve(handler, http.MethodPost, "/test/upload/stream", "{}", "Content-Type", "application/json")
+    assertStatus(t, response, http.StatusUnsupportedMediaType)
+}
@@ -0,0 +1,47 @@
+package test
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+
+    "github.com/umeframework/gear/httpd"
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/test/dto"
+)
+
+func init() {
+    // Entity validation error returned by the handler
+    httpd.NewServicePoint("/test/validation/returned", []string{http.MethodPost}, func() (string, error) {
+        return "", orm.ValidateEntity(&dto.AlbumEntity{})
+    })
+    // Entity validation error raised by the sql builder
+    httpd.NewServicePoint("/test/validation/raised", []string{http.MethodPost}, func() string {
+        sqlText, _ := (&orm.Orm{}).BuildSqlInsert(&dto.AlbumEntity{})
+        return sqlText
+    })
+}
+
+func TestEntityValidationError(t *testing.T) {
+    handler := newHandler(t, nil)
+    for _, target := range []string{"/test/validation/returned", "/test/validation/raised"} {
+        response := serve(handler, http.MethodPost, target, "")
+        if !assertStatus(t, response, http.StatusBadRequest) {
+            continue
+        }
+        var output struct {
+            StatusCode int              `json:"statusCode"`
+            Content    []orm.FieldError `json:"content"`
+        }
+        if err := json.Unmarshal(response.Body.Bytes(), &output); err != nil {
+            t.Fatal(err)
+        }
+        fields := map[string]string{}
+        for _, fieldError := range output.Content {
+            fields[fieldError.Field] = fieldError.Rule
+        }
+        if output.StatusCode != http.StatusBadRequest || fields["Title"] != orm.RuleRequired || fields["Artist"] != orm.RuleRequired {
+            t.Errorf("%s: unexpected output: %s", target, response.Body.String())
+        }
+    }
+}
@@ -0,0 +1,169 @@
+package test
+
+import (
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/umeframework/gear/httpd"
+)
+
+// Nested input of the validation tests
+type validateTrackDTO struct {
+    Title  string `validate:"required,max=10"`
+    Length int    `validate:"min=1"`
+}
+
+// Input of the validation tests
+type validateInDTO struct {
+    Name     string        `validate:"required,max=5"`
+    Age      int           `validate:"min=18,max=130"`
+    Code     string        `validate:"omitempty,len=3"`
+    Kind     string        `validate:"omitempty,oneof=cd vinyl tape"`
+    Mail     string        `validate:"omitempty,email"`
+    Sku      string        `validate:"omitempty,regex=^[A-Z]{3}-[0-9]+$"`
+    Tags     []string      `validate:"max=2"`
+    Timeout  time.Duration `validate:"omitempty,max=1m"`
+    Password string
+    Again    string `validate:"eqfield=Password"`
+    From     int
+    Until    int `validate:"gtefield=From"`
+    Phone    string
+    Fax      string  `validate:"required_without=Phone"`
+    Even     int     `validate:"omitempty,even"`
+    Rank     *int    `validate:"min=1,oneof=1 2 3"`
+    Contact  *string `validate:"email"`
+    Owner    *string `validate:"required"`
+    Main     validateTrackDTO
+    Tracks   []validateTrackDTO
+}
+
+func init() {
+    httpd.RegisterValidator("even", func(field reflect.Value, param string) bool {
+        return field.Int()%2 == 0
+    })
+    httpd.NewServicePoint("/test/validator", []string{http.MethodPost}, func(in validateInDTO) string {
+        return in.Name
+    })
+}
+
+// A valid input
+func validInput() validateInDTO {
+    owner := "sting"
+    return validateInDTO{
+        Name:  "sting",
+        Age:   18,
+        Phone: "555",
+        Owner: &owner,
+        Main:  validateTrackDTO{Title: "roxanne", Length: 3},
+    }
+}
+
+func TestValidateStruct(t *testing.T) {
+    rank, zero, mail := 2, 0, "sting@police.com"
+    tests := []struct {
+        name    string
+        modify  func(in *validateInDTO)
+        field   string
+        rule    string
+        message string
+    }{
+        {"valid", func(in *validateInDTO) {}, "", "", ""},
+        {"valid optional fields", func(in *validateInDTO) {
+            in.Code, in.Kind, in.Mail, in.Sku, in.Tags, in.Timeout = "abc", "vinyl", mail, "ABC-1", []string{"a", "b"}, time.Minute
+            in.Password, in.Again, in.From, in.Until, in.Even, in.Rank, in.Contact = "x", "x", 1, 1, 4, &rank, &mail
+        }, "", "", ""},
+        {"required", func(in *validateInDTO) { in.Name = "" }, "Name", "required", "is required"},
+        {"max length", func(in *validateInDTO) { in.Name = "stewart" }, "Name", "max", "must be at most 5 characters"},
+        {"min number", func(in *validateInDTO) { in.Age = 17 }, "Age", "min", "must be at least 18"},
+        {"len", func(in *validateInDTO) { in.Code = "ab" }, "Code", "len", "must be exactly 3 characters"},
+        {"oneof", func(in *validateInDTO) { in.Kind = "mp3" }, "Kind", "oneof", "must be one of [cd vinyl tape]"},
+        {"email", func(in *validateInDTO) { in.Mail = "sting" }, "Mail", "email", "must be a valid email address"},
+        {"regex", func(in *validateInDTO) { in.Sku = "abc-1" }, "Sku", "regex", "must match ^[A-Z]{3}-[0-9]+$"},
+        {"max items", func(in *validateInDTO) { in.Tags = []string{"a", "b", "c"} }, "Tags", "max", "must be at most 2 items"},
+        {"max duration", func(in *validateInDTO) { in.Timeout = time.Hour }, "Timeout", "max", "must be at most 1m"},
+        {"eqfield", func(in *validateInDTO) { in.Password = "x" }, "Again", "eqfield", "must equal Password"},
+        {"gtefield", func(in *validateInDTO) { in.From = 2 }, "Until", "gtefield", "must be greater than or equal to From"},
+        {"required_without", func(in *validateInDTO) { in.Phone = "" }, "Fax", "required_without", "is required when Phone is absent"},
+        {"custom", func(in *validateInDTO) { in.Even = 3 }, "Even", "even", "is invalid"},
+        {"pointer", func(in *validateInDTO) { in.Rank = &zero }, "Rank", "min", "must be at least 1"},
+        {"nil pointer", func(in *validateInDTO) { in.Owner = nil }, "Owner", "required", "is required"},
+        {"nested", func(in *validateInDTO) { in.Main.Title = "" }, "Main.Title", "required", "is required"},
+        {"slice element", func(in *validateInDTO) {
+            in.Tracks = []validateTrackDTO{{"roxanne", 3}, {"message in a bottle", 4}}
+        }, "Tracks[1].Title", "max", "must be at most 10 characters"},
+    }
+    for _, test := range tests {
+        in := validInput()
+        test.modify(&in)
+        err := httpd.ValidateStruct(reflect.ValueOf(in))
+        if test.field == "" {
+            if err != nil {
+                t.Errorf("%s: unexpected error %v", test.name, err)
+            }
+            continue
+        }
+        expected := []httpd.RequestFieldError{{Field: test.field, Rule: test.rule, Message: test.message}}
+        if err != nil {
+            // Params are checked through the messages
+            for i := range err.Fields {
+                err.Fields[i].Param = ""
+            }
+        }
+        if err == nil || !reflect.DeepEqual(err.Fields, expected) {
+            t.Errorf("%s: err = %v, expected %v", test.name, err, expected)
+        }
+    }
+
+    // Only the first failed rule of a field is reported, all failed fields are
+    in := validInput()
+    in.Name, in.Age = "", 200
+    err := httpd.ValidateStruct(reflect.ValueOf(in))
+    if err == nil || len(err.Fields) != 2 || err.Fields[0].Field != "Name" || err.Fields[1].Field != "Age" {
+        t.Errorf("unexpected errors: %v", err)
+    }
+}
+
+func TestRegisterValidator(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Error("overriding a built-in rule should panic")
+        }
+    }()
+    httpd.RegisterValidator("required", func(field reflect.Value, param string) bool {
+        return true
+    })
+}
+
+func TestValidationRequest(t *testing.T) {
+    handler := newHandler(t, nil)
+
+    response := serve(handler, http.MethodPost, "/test/validator",
+        `{"Name":"sting","Age":18,"Phone":"555","Owner":"sting","Main":{"Title":"roxanne","Length":3}}`,
+        "Content-Type", "application/json")
+    if assertStatus(t, response, http.StatusOK) {
+        assertBody(t, response, `"sting"`)
+    }
+
+    response = serve(handler, http.MethodPost, "/test/validator",
+        `{"Name":"sting","Age":18,"Owner":"sting","Main":{"Length":3},"Tracks":[{"Title":"roxanne"}]}`,
+        "Content-Type", "application/json")
+    if assertStatus(t, response, http.StatusBadRequest) {
+        var output struct {
+            Content []httpd.RequestFieldError `json:"content"`
+        }
+        if err := json.Unmarshal(response.Body.Bytes(), &output); err != nil {
+            t.Fatal(err)
+        }
+        var fields []string
+        for _, fieldError := range output.Content {
+            fields = append(fields, fieldError.Field+" "+fieldError.Rule)
+        }
+        if actual := strings.Join(fields, ", "); actual != "Fax required_without, Main.Title required, Tracks[0].Length min" {
+            t.Errorf("unexpected errors: %s", actual)
+        }
+    }
+}
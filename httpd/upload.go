@@ -0,0 +1,271 @@
+package httpd
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Limits of multipart uploads, 0 for no limit
+var (
+	// Whole request body (also for handlers streaming the parts)
+	MaxUploadSize int64 = 32 << 20
+	// Single part, checked while the body is read
+	MaxUploadFileSize int64 = 8 << 20
+	// Files beyond this size are spooled to temp files, removed once the handler returns
+	UploadMemoryLimit int64 = 1 << 20
+)
+
+var (
+	ErrorUploadTooLarge = errors.New("upload too large")
+
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+	multipartFileType   = reflect.TypeOf((*multipart.File)(nil)).Elem()
+	multipartReaderType = reflect.TypeOf((*multipart.Reader)(nil))
+)
+
+func init() {
+	RegisterErrorStatus(ErrorUploadTooLarge, http.StatusRequestEntityTooLarge)
+	RegisterErrorMapper(func(err error) (int, bool) {
+		var maxBytesErr *http.MaxBytesError
+		return http.StatusRequestEntityTooLarge, errors.As(err, &maxBytesErr)
+	})
+}
+
+type requestUploadsKey struct{}
+
+// Files opened while binding a request
+type requestUploads struct {
+	lock   sync.Mutex
+	opened []io.Closer
+}
+
+func isMultipartRequest(request *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
+
+// Limit the body of a multipart request to MaxUploadSize and its parts to MaxUploadFileSize,
+// and track the files opened for it
+func (this *InvocationInterceptor) PrepareUploads(request *http.Request, response http.ResponseWriter) *http.Request {
+	request = request.WithContext(stdcontext.WithValue(request.Context(), requestUploadsKey{}, &requestUploads{}))
+	if MaxUploadSize > 0 {
+		request.Body = http.MaxBytesReader(response, request.Body, MaxUploadSize)
+	}
+	if MaxUploadFileSize > 0 {
+		_, params, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+		if boundary := params["boundary"]; boundary != "" {
+			request.Body = newPartLimitReader(request.Body, boundary, MaxUploadFileSize)
+		}
+	}
+	return request
+}
+
+// Close the files opened for the request and remove its temp files
+func (this *InvocationInterceptor) CleanupUploads(request *http.Request) {
+	if uploads, ok := request.Context().Value(requestUploadsKey{}).(*requestUploads); ok {
+		uploads.lock.Lock()
+		for _, file := range uploads.opened {
+			file.Close()
+		}
+		uploads.opened = nil
+		uploads.lock.Unlock()
+	}
+	if request.MultipartForm != nil {
+		request.MultipartForm.RemoveAll()
+	}
+}
+
+// Parse a multipart body, panics with 413 if the body or a file exceeds its limit
+func (this *InvocationInterceptor) ParseMultipartForm(request *http.Request) {
+	if request.MultipartForm != nil {
+		return
+	}
+	if err := request.ParseMultipartForm(UploadMemoryLimit); err != nil {
+		// Spooled temp files are removed by ParseMultipartForm
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			panic(fmt.Errorf("%w: request body exceeds %d bytes", ErrorUploadTooLarge, maxBytesErr.Limit))
+		}
+		if errors.Is(err, ErrorUploadTooLarge) {
+			panic(err)
+		}
+		bindingErr := &BindingError{}
+		bindingErr.add("", nil, fmt.Errorf("invalid multipart body: %v", err))
+		bindingErr.check()
+	}
+}
+
+// Reader of the parts for handlers streaming the upload
+func (this *InvocationInterceptor) MultipartReader(request *http.Request) *multipart.Reader {
+	reader, err := request.MultipartReader()
+	if err == http.ErrNotMultipart {
+		panic(fmt.Errorf("%w: multipart body expected", ErrorUnsupportedMediaType))
+	} else if err != nil {
+		bindingErr := &BindingError{}
+		bindingErr.add("", nil, fmt.Errorf("invalid multipart body: %v", err))
+		bindingErr.check()
+	}
+	return reader
+}
+
+// Fails reading a multipart body once the content of a part exceeds limit, so oversized
+// files are rejected before they are spooled
+type partLimitReader struct {
+	io.ReadCloser
+	// CRLF and dashes before the boundary, with its KMP failure table
+	delimiter []byte
+	failure   []int
+	matched   int
+	// Within the headers of a part, and the CR LF CR LF bytes matched of their end
+	inHeaders     bool
+	headerMatched int
+	size          int64
+	limit         int64
+	err           error
+}
+
+func newPartLimitReader(body io.ReadCloser, boundary string, limit int64) *partLimitReader {
+	delimiter := []byte("\r\n--" + boundary)
+	failure := make([]int, len(delimiter))
+	for i, k := 1, 0; i < len(delimiter); i++ {
+		for k > 0 && delimiter[i] != delimiter[k] {
+			k = failure[k-1]
+		}
+		if delimiter[i] == delimiter[k] {
+			k++
+		}
+		failure[i] = k
+	}
+	// The first boundary is not preceded by CR LF
+	return &partLimitReader{ReadCloser: body, delimiter: delimiter, failure: failure, matched: 2, limit: limit}
+}
+
+func (this *partLimitReader) Read(p []byte) (int, error) {
+	if this.err != nil {
+		return 0, this.err
+	}
+	n, err := this.ReadCloser.Read(p)
+	for i, b := range p[:n] {
+		for this.matched > 0 && this.delimiter[this.matched] != b {
+			this.matched = this.failure[this.matched-1]
+		}
+		if this.delimiter[this.matched] == b {
+			this.matched++
+		}
+		if this.matched == len(this.delimiter) {
+			this.matched = this.failure[this.matched-1]
+			this.inHeaders, this.headerMatched, this.size = true, 0, 0
+			continue
+		}
+		if this.inHeaders {
+			if b == "\r\n\r\n"[this.headerMatched] {
+				this.headerMatched++
+			} else if b == '\r' {
+				this.headerMatched = 1
+			} else {
+				this.headerMatched = 0
+			}
+			this.inHeaders = this.headerMatched < 4
+			continue
+		}
+		this.size++
+		// Bytes matching the start of the delimiter may end the part
+		if this.size-int64(this.matched) > this.limit {
+			// The rest is withheld, so readers get the error before the end of the part
+			this.err = fmt.Errorf("%w: a part exceeds %d bytes", ErrorUploadTooLarge, this.limit)
+			return i, this.err
+		}
+	}
+	return n, err
+}
+
+//------------------------------
+// Binding of file parts
+
+// Fields bound from file parts: *multipart.FileHeader, []*multipart.FileHeader, []byte
+// and interfaces implemented by multipart.File (io.Reader, io.ReadSeeker, ...)
+func isFileTarget(t reflect.Type) bool {
+	switch {
+	case t == fileHeaderType, t == fileHeadersType:
+		return true
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return true
+	case t.Kind() == reflect.Interface && t.NumMethod() > 0:
+		return multipartFileType.Implements(t)
+	}
+	return false
+}
+
+// File parts of a field by form tag, or by case-insensitive field name if untagged
+func (this *binder) lookupFiles(fieldInfo reflect.StructField, key string) []*multipart.FileHeader {
+	if len(this.files) == 0 || !isFileTarget(fieldInfo.Type) {
+		return nil
+	}
+	if tag, ok := fieldInfo.Tag.Lookup(SourceForm); ok {
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = fieldInfo.Name
+		}
+		return this.files[name]
+	}
+	for _, source := range bindingSourceOrder {
+		if _, ok := fieldInfo.Tag.Lookup(source); ok {
+			return nil
+		}
+	}
+	for name, headers := range this.files {
+		if strings.EqualFold(name, key) {
+			return headers
+		}
+	}
+	return nil
+}
+
+func (this *binder) bindFiles(name string, headers []*multipart.FileHeader, field reflect.Value) {
+	t := field.Type()
+	if t == fileHeadersType {
+		field.Set(reflect.ValueOf(headers))
+		return
+	}
+	if len(headers) > 1 {
+		this.err.add(name, headers[0].Filename, fmt.Errorf("%d files uploaded, expected one", len(headers)))
+		return
+	}
+	header := headers[0]
+	if t == fileHeaderType {
+		field.Set(reflect.ValueOf(header))
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		this.err.add(name, header.Filename, err)
+		return
+	}
+	if t.Kind() == reflect.Slice {
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			this.err.add(name, header.Filename, err)
+			return
+		}
+		field.SetBytes(data)
+		return
+	}
+	// Closed once the handler returns
+	if this.uploads != nil {
+		this.uploads.lock.Lock()
+		this.uploads.opened = append(this.uploads.opened, file)
+		this.uploads.lock.Unlock()
+	}
+	field.Set(reflect.ValueOf(file))
+}
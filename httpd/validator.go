@@ -0,0 +1,413 @@
+package httpd
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Validation rules of handler input fields, checked after binding:
+//	Name   string   `validate:"required,max=20"`
+//	Age    int      `validate:"min=18,max=130"`
+//	Code   string   `validate:"len=6"`
+//	Kind   string   `validate:"oneof=cd vinyl tape"`
+//	Mail   string   `validate:"omitempty,email"`
+//	Sku    string   `validate:"regex=^[A-Z]{3}-[0-9]+$"`
+//	Again  string   `validate:"eqfield=Password"`
+//	Until  int      `validate:"gtfield=From"`
+// min, max and len compare numbers by value and strings, slices and maps by length.
+// regex takes the rest of the tag, so it must be the last rule. Nested structs and
+// struct elements of slices are validated too. Cross-field rules (eqfield, nefield,
+// gtfield, gtefield, ltfield, ltefield, required_with, required_without) refer to
+// fields of the same struct. Nil pointer fields are checked by required, required_with
+// and required_without only.
+
+// Custom validation rule, param is the text after '=' (empty if none)
+type ValidatorFunc func(field reflect.Value, param string) bool
+
+// Field level validation failure
+type RequestFieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Handler input that failed validation (rendered as 400)
+type RequestValidationError struct {
+	Fields []RequestFieldError `json:"fields"`
+}
+
+func (this *RequestValidationError) Error() string {
+	messages := make([]string, len(this.Fields))
+	for i, fieldError := range this.Fields {
+		messages[i] = fieldError.Field + " " + fieldError.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// Panic with a 400 exception if any field failed
+func (this *RequestValidationError) check() {
+	if len(this.Fields) > 0 {
+		panic(NewInterceptorException(this, http.StatusBadRequest, this.Fields))
+	}
+}
+
+var (
+	validators     = map[string]ValidatorFunc{}
+	validatorsLock sync.RWMutex
+
+	// Parsed rules by struct type
+	validationCache sync.Map
+
+	builtinRules = map[string]bool{
+		"required": true, "omitempty": true, "min": true, "max": true, "len": true, "oneof": true,
+		"email": true, "regex": true, "eqfield": true, "nefield": true, "gtfield": true,
+		"gtefield": true, "ltfield": true, "ltefield": true, "required_with": true, "required_without": true,
+	}
+)
+
+// Register a custom rule usable in validate tags, must be called before NewServicePoint
+func RegisterValidator(name string, validator ValidatorFunc) {
+	if builtinRules[name] {
+		panic(fmt.Errorf("validation rule %s is built in", name))
+	}
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+	validators[name] = validator
+}
+
+func lookupValidator(name string) (ValidatorFunc, bool) {
+	validatorsLock.RLock()
+	defer validatorsLock.RUnlock()
+	validator, found := validators[name]
+	return validator, found
+}
+
+type validationRule struct {
+	name   string
+	param  string
+	number float64
+	regex  *regexp.Regexp
+	custom ValidatorFunc
+	// Sibling field of cross-field rules
+	other int
+}
+
+type fieldValidation struct {
+	index     int
+	name      string
+	omitempty bool
+	rules     []validationRule
+}
+
+// Validate a bound struct value, returns nil if valid
+func ValidateStruct(value reflect.Value) *RequestValidationError {
+	validation := RequestValidationError{}
+	validation.validateStruct(value, "")
+	if len(validation.Fields) == 0 {
+		return nil
+	}
+	return &validation
+}
+
+// Parse and cache the rules of a struct type, panics on malformed tags
+func structValidations(t reflect.Type) []fieldValidation {
+	if cached, found := validationCache.Load(t); found {
+		return cached.([]fieldValidation)
+	}
+	var fields []fieldValidation
+	for i := 0; i < t.NumField(); i++ {
+		fieldInfo := t.Field(i)
+		tag, ok := fieldInfo.Tag.Lookup("validate")
+		if !ok || tag == "" || tag == "-" || fieldInfo.PkgPath != "" {
+			continue
+		}
+		field := fieldValidation{index: i, name: fieldInfo.Name}
+		for rest := tag; rest != ""; {
+			element := rest
+			if strings.HasPrefix(rest, "regex=") {
+				rest = ""
+			} else if i := strings.IndexByte(rest, ','); i >= 0 {
+				element, rest = rest[:i], rest[i+1:]
+			} else {
+				rest = ""
+			}
+			rule, err := parseValidationRule(t, fieldInfo, element)
+			if err != nil {
+				panic(fmt.Errorf("validate tag of %v.%s: %v", t, fieldInfo.Name, err))
+			}
+			if rule.name == "omitempty" {
+				field.omitempty = true
+			} else {
+				field.rules = append(field.rules, rule)
+			}
+		}
+		fields = append(fields, field)
+	}
+	validationCache.Store(t, fields)
+	return fields
+}
+
+// Parse the rules of handler input types up front, so malformed tags fail at registration
+func prepareValidations(t reflect.Type, visited map[reflect.Type]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if !isBindableStruct(t) || visited[t] {
+		return
+	}
+	visited[t] = true
+	structValidations(t)
+	for i := 0; i < t.NumField(); i++ {
+		prepareValidations(t.Field(i).Type, visited)
+	}
+}
+
+func parseValidationRule(t reflect.Type, fieldInfo reflect.StructField, element string) (validationRule, error) {
+	rule := validationRule{name: strings.TrimSpace(element)}
+	if i := strings.IndexByte(element, '='); i >= 0 {
+		rule.name, rule.param = strings.TrimSpace(element[:i]), element[i+1:]
+	}
+	switch rule.name {
+	case "required", "omitempty", "email":
+	case "min", "max", "len":
+		if fieldInfo.Type == durationType {
+			duration, err := time.ParseDuration(rule.param)
+			if err != nil {
+				return rule, err
+			}
+			rule.number = float64(duration)
+		} else {
+			number, err := strconv.ParseFloat(rule.param, 64)
+			if err != nil {
+				return rule, fmt.Errorf("invalid %s %q", rule.name, rule.param)
+			}
+			rule.number = number
+		}
+	case "oneof":
+		if strings.TrimSpace(rule.param) == "" {
+			return rule, fmt.Errorf("oneof requires values")
+		}
+	case "regex":
+		regex, err := regexp.Compile(rule.param)
+		if err != nil {
+			return rule, err
+		}
+		rule.regex = regex
+	case "eqfield", "nefield", "gtfield", "gtefield", "ltfield", "ltefield", "required_with", "required_without":
+		other, found := t.FieldByName(rule.param)
+		if !found || len(other.Index) != 1 {
+			return rule, fmt.Errorf("unknown field %q", rule.param)
+		}
+		rule.other = other.Index[0]
+	default:
+		custom, found := lookupValidator(rule.name)
+		if !found {
+			return rule, fmt.Errorf("unknown rule %q", rule.name)
+		}
+		rule.custom = custom
+	}
+	return rule, nil
+}
+
+func (this *RequestValidationError) validateStruct(value reflect.Value, prefix string) {
+	t := value.Type()
+	for _, field := range structValidations(t) {
+		fieldValue := value.Field(field.index)
+		if field.omitempty && fieldValue.IsZero() {
+			continue
+		}
+		// Nil pointers are absent, only presence rules apply
+		absent := fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil()
+		for _, rule := range field.rules {
+			if absent && !rule.checksPresence() {
+				continue
+			}
+			if message, ok := rule.check(fieldValue, value); !ok {
+				this.Fields = append(this.Fields, RequestFieldError{prefix + field.name, rule.name, rule.param, message})
+				// Report the first failed rule of a field only
+				break
+			}
+		}
+	}
+
+	// Nested structs and struct elements of slices
+	for i := 0; i < t.NumField(); i++ {
+		fieldInfo := t.Field(i)
+		if fieldInfo.PkgPath != "" {
+			continue
+		}
+		name := prefix + fieldInfo.Name + "."
+		if fieldInfo.Anonymous {
+			name = prefix
+		}
+		this.validateNested(value.Field(i), name)
+	}
+}
+
+func (this *RequestValidationError) validateNested(value reflect.Value, prefix string) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		if isBindableStruct(value.Type()) {
+			this.validateStruct(value, prefix)
+		}
+	case reflect.Slice, reflect.Array:
+		name := strings.TrimSuffix(prefix, ".")
+		for i := 0; i < value.Len(); i++ {
+			this.validateNested(value.Index(i), fmt.Sprintf("%s[%d].", name, i))
+		}
+	}
+}
+
+func (this validationRule) checksPresence() bool {
+	return this.name == "required" || this.name == "required_with" || this.name == "required_without"
+}
+
+// Check a rule, returns the failure message
+func (this validationRule) check(field reflect.Value, parent reflect.Value) (string, bool) {
+	switch this.name {
+	case "required":
+		return "is required", !isEmptyValue(field)
+	case "min":
+		actual, unit := measure(field)
+		return "must be at least " + this.param + unit, actual >= this.number
+	case "max":
+		actual, unit := measure(field)
+		return "must be at most " + this.param + unit, actual <= this.number
+	case "len":
+		actual, unit := measure(field)
+		return "must be exactly " + this.param + unit, actual == this.number
+	case "oneof":
+		text := fmt.Sprint(indirect(field).Interface())
+		for _, option := range strings.Fields(this.param) {
+			if text == option {
+				return "", true
+			}
+		}
+		return "must be one of [" + this.param + "]", false
+	case "email":
+		text := fmt.Sprint(indirect(field).Interface())
+		address, err := mail.ParseAddress(text)
+		return "must be a valid email address", err == nil && address.Address == text
+	case "regex":
+		return "must match " + this.param, this.regex.MatchString(fmt.Sprint(indirect(field).Interface()))
+	case "required_with":
+		return "is required when " + this.param + " is present",
+			isEmptyValue(parent.Field(this.other)) || !isEmptyValue(field)
+	case "required_without":
+		return "is required when " + this.param + " is absent",
+			!isEmptyValue(parent.Field(this.other)) || !isEmptyValue(field)
+	case "eqfield", "nefield", "gtfield", "gtefield", "ltfield", "ltefield":
+		return this.compareField(field, parent.Field(this.other))
+	}
+	return "is invalid", this.custom(field, this.param)
+}
+
+func (this validationRule) compareField(field reflect.Value, other reflect.Value) (string, bool) {
+	if this.name == "eqfield" || this.name == "nefield" {
+		equal := reflect.DeepEqual(indirect(field).Interface(), indirect(other).Interface())
+		if this.name == "eqfield" {
+			return "must equal " + this.param, equal
+		}
+		return "must not equal " + this.param, !equal
+	}
+	order, comparable := compareValues(indirect(field), indirect(other))
+	switch this.name {
+	case "gtfield":
+		return "must be greater than " + this.param, comparable && order > 0
+	case "gtefield":
+		return "must be greater than or equal to " + this.param, comparable && order >= 0
+	case "ltfield":
+		return "must be less than " + this.param, comparable && order < 0
+	}
+	return "must be less than or equal to " + this.param, comparable && order <= 0
+}
+
+// Order of two values of the same kind (numbers, strings, time.Time)
+func compareValues(a reflect.Value, b reflect.Value) (int, bool) {
+	if !a.IsValid() || !b.IsValid() {
+		return 0, false
+	}
+	if a.Type() == timeType && b.Type() == timeType {
+		ta, tb := a.Interface().(time.Time), b.Interface().(time.Time)
+		switch {
+		case ta.Before(tb):
+			return -1, true
+		case ta.After(tb):
+			return 1, true
+		}
+		return 0, true
+	}
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return strings.Compare(a.String(), b.String()), true
+	}
+	na, okA := numberOf(a)
+	nb, okB := numberOf(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	switch {
+	case na < nb:
+		return -1, true
+	case na > nb:
+		return 1, true
+	}
+	return 0, true
+}
+
+// Number for numeric values, length for strings, slices and maps (with the unit for messages)
+func measure(field reflect.Value) (float64, string) {
+	field = indirect(field)
+	switch field.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(field.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(field.Len()), " items"
+	}
+	number, _ := numberOf(field)
+	return number, ""
+}
+
+func numberOf(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
+
+// Nil pointers, zero values and empty strings, slices and maps
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return value.IsZero()
+}
@@ -2,16 +2,44 @@ package gear
 
 import (
 	"fmt"
+	"os"
+
+	"github.com/umeframework/gear/core"
 	"github.com/umeframework/gear/orm"
 )
 
+// 配置文件路径的环境变量
+const ConfigEnv = "GEAR_CONFIG"
+
+// 默认配置文件(按顺序查找)
+var defaultConfigFiles = []string{"gear.properties", "config/gear.properties"}
+
 // Framework initialize
 func init() {
 	fmt.Println("Gear init...")
+	if cfg := loadConfig(); cfg != nil {
+		if err := orm.ConfigureKeyring(cfg); err != nil {
+			panic(err)
+		}
+		orm.ConfigureMasking(cfg)
+	}
+}
+
+// 读取配置文件(未找到时返回nil)
+func loadConfig() *core.PropertyConfig {
+	files := defaultConfigFiles
+	if file := os.Getenv(ConfigEnv); file != "" {
+		files = []string{file}
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			return core.NewPropertyConfig(file)
+		}
+	}
+	return nil
 }
 
 // Create Orm
 func GetDao() *orm.Orm {
 	return &orm.Orm{}
 }
-
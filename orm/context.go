@@ -1,14 +1,41 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"sync"
 )
 
+// Errors定义
+var (
+	ErrorNotInTransaction     = errors.New("orm context is not in transaction")
+	ErrorAlreadyInTransaction = errors.New("orm context is already in transaction")
+)
+
 // Orm Context
 type OrmContext struct {
-	conn *sql.DB
+	conn    *sql.DB
+	tx      *ormTx
+	dialect Dialect
+	// 租户(为空时使用ctx携带的租户)
+	tenant string
+	ctx    context.Context
+}
+
+// 事务状态(同一事务的上下文副本共享)
+type ormTx struct {
+	tx *sql.Tx
+	// 事务中更新过的表(提交后使缓存失效)
+	tables map[string]bool
+}
+
+// 数据库操作接口('*sql.DB'及'*sql.Tx'共通)
+type sqlExecutor interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
+
 // 'OrmContext'指针变量
 var ormContext *OrmContext
 // 同步控制变量
@@ -22,11 +49,17 @@ func singleOrmContext(driver string, dataSource string) OrmContext {
 			panic(err)
 		}
 		ormContext.conn = db
+		ormContext.dialect = GetDialect(driver)
 
 	})
 	return *ormContext
 }
 
+// 从已打开的'*sql.DB'创建上下文(driver用于选择数据库方言)
+func NewOrmContext(driver string, db *sql.DB) OrmContext {
+	return OrmContext{conn: db, dialect: GetDialect(driver)}
+}
+
 // 获取上下文
 func GetOrmContext(driver string, dataSource string) OrmContext {
 	return singleOrmContext(driver, dataSource)
@@ -42,6 +75,173 @@ func (owner *OrmContext) DB()  *sql.DB {
 	return owner.conn
 }
 
+// 获取数据库方言
+func (owner *OrmContext) Dialect() Dialect {
+	if owner.dialect == nil {
+		return GetDialect("")
+	}
+	return owner.dialect
+}
+
+// 开始事务, 返回绑定该事务的上下文
+func (owner *OrmContext) Begin() (OrmContext, error) {
+	if owner.tx != nil {
+		return *owner, ErrorAlreadyInTransaction
+	}
+	tx, err := owner.conn.BeginTx(owner.context(), nil)
+	if err != nil {
+		return *owner, err
+	}
+	txContext := *owner
+	txContext.tx = &ormTx{tx, make(map[string]bool)}
+	return txContext, nil
+}
+
+// 提交事务
+func (owner *OrmContext) Commit() error {
+	if owner.tx == nil {
+		return ErrorNotInTransaction
+	}
+	err := owner.tx.tx.Commit()
+	for table := range owner.tx.tables {
+		invalidateCache(table)
+	}
+	return err
+}
+
+// 回滚事务
+func (owner *OrmContext) Rollback() error {
+	if owner.tx == nil {
+		return ErrorNotInTransaction
+	}
+	return owner.tx.tx.Rollback()
+}
+
+// 是否处于事务中
+func (owner *OrmContext) InTransaction() bool {
+	return owner.tx != nil
+}
+
+// 获取事务实例(不在事务中时为nil)
+func (owner *OrmContext) Tx() *sql.Tx {
+	if owner.tx == nil {
+		return nil
+	}
+	return owner.tx.tx
+}
+
+// 返回绑定租户的上下文
+func (owner OrmContext) WithTenant(tenant string) OrmContext {
+	owner.tenant = tenant
+	return owner
+}
+
+// 返回绑定context的上下文(用于取消执行及传递租户)
+func (owner OrmContext) WithContext(ctx context.Context) OrmContext {
+	owner.ctx = ctx
+	return owner
+}
+
+// 获取租户
+func (owner *OrmContext) Tenant() string {
+	if owner.tenant != "" {
+		return owner.tenant
+	}
+	return TenantFromContext(owner.ctx)
+}
+
+func (owner *OrmContext) context() context.Context {
+	if owner.ctx == nil {
+		return context.Background()
+	}
+	return owner.ctx
+}
+
+// 获取当前数据库操作实例(事务中时为'*sql.Tx')
+func (owner *OrmContext) executor() sqlExecutor {
+	if owner.tx != nil {
+		return owner.tx.tx
+	}
+	return owner.conn
+}
+
+// 获取固定连接的数据库操作实例(会话变量等需要同一连接时使用, 事务中时为'*sql.Tx'), 使用后调用release
+func (owner *OrmContext) session() (executor sqlExecutor, release func(), err error) {
+	if owner.tx != nil {
+		return owner.tx.tx, func() {}, nil
+	}
+	conn, err := owner.conn.Conn(owner.context())
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, func() { conn.Close() }, nil
+}
+
+// 执行查询(按租户, 分片及方言转换SQL文)
+func (owner *OrmContext) query(sqlText string, sqlParams []interface{}) (*sql.Rows, error) {
+	executor, routedSql, routedParams, err := owner.route(sqlText, sqlParams)
+	if err != nil {
+		return nil, err
+	}
+	return executor.QueryContext(owner.context(), routedSql, routedParams...)
+}
+
+// 按租户, 分片及方言转换SQL文, 并选择分片的数据库操作实例
+func (owner *OrmContext) route(sqlText string, sqlParams []interface{}) (sqlExecutor, string, []interface{}, error) {
+	tenantSql, tenantParams, err := tenantRouteInstance.resolve(sqlText, sqlParams, owner.Tenant())
+	if err != nil {
+		return nil, sqlText, sqlParams, err
+	}
+	shard, shardSql, err := shardRouteInstance.resolve(tenantSql, tenantParams)
+	if err != nil {
+		return nil, sqlText, sqlParams, err
+	}
+	executor, err := owner.shardExecutor(shard)
+	if err != nil {
+		return nil, sqlText, sqlParams, err
+	}
+	return executor, owner.Dialect().Rebind(shardSql), tenantParams, nil
+}
 
+// 使用指定的数据库操作实例执行查询(不进行分片路由)
+func (owner *OrmContext) queryOn(executor sqlExecutor, sqlText string, sqlParams []interface{}) (*sql.Rows, error) {
+	tenantSql, tenantParams, err := tenantRouteInstance.resolve(sqlText, sqlParams, owner.Tenant())
+	if err != nil {
+		return nil, err
+	}
+	return executor.QueryContext(owner.context(), owner.Dialect().Rebind(tenantSql), tenantParams...)
+}
 
+// 执行更新(按租户, 分片及方言转换SQL文, 并使更新表的缓存失效)
+func (owner *OrmContext) exec(sqlText string, sqlParams []interface{}) (sql.Result, error) {
+	executor, routedSql, routedParams, err := owner.route(sqlText, sqlParams)
+	if err != nil {
+		return nil, err
+	}
+	result, err := executor.ExecContext(owner.context(), routedSql, routedParams...)
+	if table := updatedTableName(sqlText); table != "" {
+		owner.invalidate(table)
+	}
+	return result, err
+}
 
+// 使用指定的数据库操作实例执行更新(不进行分片路由)
+func (owner *OrmContext) execOn(executor sqlExecutor, sqlText string, sqlParams []interface{}) (sql.Result, error) {
+	tenantSql, tenantParams, err := tenantRouteInstance.resolve(sqlText, sqlParams, owner.Tenant())
+	if err != nil {
+		return nil, err
+	}
+	result, err := executor.ExecContext(owner.context(), owner.Dialect().Rebind(tenantSql), tenantParams...)
+	if table := updatedTableName(sqlText); table != "" {
+		owner.invalidate(table)
+	}
+	return result, err
+}
+
+// 使更新表的缓存失效(事务中时提交后再次失效)
+func (owner *OrmContext) invalidate(table string) {
+	invalidateCache(table)
+	if owner.tx != nil {
+		owner.tx.tables[table] = true
+	}
+}
@@ -1,7 +1,7 @@
 package orm
 
 import (
-    "context"
+    "database/sql"
 )
 
 // O/R Mapping实例
@@ -14,35 +14,140 @@ type OrderByCondition struct {
     DESC   bool
 }
 
-// 执行数据库查询
+// 执行数据库查询(启用实体缓存时, 查询延迟至映射时执行, 命中缓存时不执行)
+// 分片表的条件中无分片键时按分片顺序连接各分片的结果(不能含JOIN, 排序, 件数限制及聚合)
 func (this *Orm) Retrieve(ctx OrmContext, sql string, sqlParams ...interface{}) (*OrmRows) {
-    rows, err := ctx.DB().Query(sql, sqlParams[:]...)
-    ormRows := newOrmRows(rows, err)
-
+    if cache := newCachedQuery(ctx, sql, sqlParams); cache != nil {
+        return &OrmRows{cache: cache}
+    }
+    // 条件中无分片键的分片表查询在所有分片执行
+    rows, err := ctx.queryShards(sql, sqlParams, false)
     if err != nil {
         panic(err)
     }
-    return ormRows
+    return newShardOrmRows(rows)
+}
+
+// 按主键查询实体, 结果写入entity, 未找到时返回false
+func (this *Orm) Find(ctx OrmContext, entity Entity) bool {
+    sqlText, sqlParams := this.BuildSqlSelectOne(entity)
+    rows := this.Retrieve(ctx, sqlText, sqlParams...)
+    defer rows.Close()
+    err := rows.DefaultMapping(entity)
+    if err == ErrorRecordNotFound {
+        return false
+    } else if err != nil {
+        panic(err)
+    }
+    return true
+}
+
+// 执行加锁查询(须在事务中, 加锁子句按数据库方言生成)
+func (this *Orm) RetrieveForLock(ctx OrmContext, lock LockOption, sqlText string, sqlParams ...interface{}) (*OrmRows, error) {
+    if !ctx.InTransaction() {
+        return nil, ErrorNotInTransaction
+    }
+    lockClause, err := ctx.Dialect().LockClause(lock)
+    if err != nil {
+        return nil, err
+    }
+    if lockClause != "" {
+        sqlText += " " + lockClause
+    }
+    rows, err := ctx.query(sqlText, sqlParams)
+    if err != nil {
+        return nil, err
+    }
+    return newOrmRows(rows, nil), nil
 }
 
-// 执行数据库'Count'查询
+// 执行数据库'Count'查询(分片表的条件中无分片键时合计各分片的件数)
 func (this *Orm) Count(ctx OrmContext, sqlText string, sqlParams ...interface{}) int64 {
-    rows, err  := ctx.DB().QueryContext(context.Background(), sqlText, sqlParams[0:]...)
+    shardRows, err := ctx.queryShards(sqlText, sqlParams, true)
+    if err != nil {
+        panic(err)
+    }
+    defer func() {
+        for _, rows := range shardRows {
+            rows.Close()
+        }
+    }()
+    var total int64
+    for _, rows := range shardRows {
+        rows.Next()
+        var count int64
+        error := rows.Scan(&count)
+        if error != nil {
+            panic(error)
+        }
+        total += count
+    }
+    return total
+}
+
+// 执行数据库聚合查询, 结果写入dest(指针)
+func (this *Orm) Aggregate(ctx OrmContext, dest interface{}, sqlText string, sqlParams ...interface{}) {
+    rows, err := ctx.query(sqlText, sqlParams)
     if err != nil {
         panic(err)
     }
-    rows.Next()
-    var count int64
-    error := rows.Scan(&count)
-    if error != nil {
-        panic(error)
+    defer rows.Close()
+    if !rows.Next() {
+        if err = rows.Err(); err != nil {
+            panic(err)
+        }
+        panic(ErrorRecordNotFound)
     }
-    return count
+    if err = rows.Scan(dest); err != nil {
+        panic(err)
+    }
+}
+
+// 执行数据库'Sum'查询(无记录时结果为NULL)
+func (this *Orm) Sum(ctx OrmContext, sqlText string, sqlParams ...interface{}) sql.NullFloat64 {
+    var sum sql.NullFloat64
+    this.Aggregate(ctx, &sum, sqlText, sqlParams[0:]...)
+    return sum
+}
+
+// 执行数据库'Avg'查询(无记录时结果为NULL)
+func (this *Orm) Avg(ctx OrmContext, sqlText string, sqlParams ...interface{}) sql.NullFloat64 {
+    var avg sql.NullFloat64
+    this.Aggregate(ctx, &avg, sqlText, sqlParams[0:]...)
+    return avg
+}
+
+// 执行数据库'Min'查询(数值列, 无记录时结果为NULL)
+func (this *Orm) Min(ctx OrmContext, sqlText string, sqlParams ...interface{}) sql.NullFloat64 {
+    var min sql.NullFloat64
+    this.Aggregate(ctx, &min, sqlText, sqlParams[0:]...)
+    return min
+}
+
+// 执行数据库'Max'查询(数值列, 无记录时结果为NULL)
+func (this *Orm) Max(ctx OrmContext, sqlText string, sqlParams ...interface{}) sql.NullFloat64 {
+    var max sql.NullFloat64
+    this.Aggregate(ctx, &max, sqlText, sqlParams[0:]...)
+    return max
+}
+
+// 执行数据库'Min'查询(字符串及日期时间列, 无记录时结果为NULL)
+func (this *Orm) MinString(ctx OrmContext, sqlText string, sqlParams ...interface{}) sql.NullString {
+    var min sql.NullString
+    this.Aggregate(ctx, &min, sqlText, sqlParams[0:]...)
+    return min
+}
+
+// 执行数据库'Max'查询(字符串及日期时间列, 无记录时结果为NULL)
+func (this *Orm) MaxString(ctx OrmContext, sqlText string, sqlParams ...interface{}) sql.NullString {
+    var max sql.NullString
+    this.Aggregate(ctx, &max, sqlText, sqlParams[0:]...)
+    return max
 }
 
 // 执行数据库更新
 func (this *Orm) Exec(ctx OrmContext, sqlText string, sqlParams ...interface{}) (*OrmResult, error) {
-    execResult, err := ctx.DB().Exec(sqlText, sqlParams[:]...)
+    execResult, err := ctx.exec(sqlText, sqlParams)
     result := newOrmResult(execResult)
     return result, err
 }
@@ -60,8 +165,11 @@ func (this *Orm) Insert(ctx OrmContext, sqlText string, sqlParams ...interface{}
     return insertId
 }
 
-// 执行数据库更新
+// 执行数据库更新(SQL文为空时表示无变更, 不执行更新)
 func (this *Orm) Update(ctx OrmContext, sqlText string, sqlParams ...interface{}) int64 {
+    if sqlText == "" {
+        return 0
+    }
     ormResult, execErr := this.Exec(ctx, sqlText, sqlParams[:]...)
     if execErr != nil {
         panic(execErr)
@@ -0,0 +1,538 @@
+package orm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Errors定义
+var (
+	ErrorUnknownFormat = errors.New("unknown bulk data format")
+)
+
+// 批量导入导出的数据格式
+type BulkFormat string
+
+const (
+	FormatCSV    BulkFormat = "csv"
+	FormatNDJSON BulkFormat = "ndjson"
+)
+
+// 导出的列标题
+type HeaderStyle int
+
+const (
+	// 列名
+	HeaderColumn HeaderStyle = iota
+	// 列注释(无注释时使用列名)
+	HeaderComment
+	// 字段名
+	HeaderField
+)
+
+// 导出选项
+type ExportOption struct {
+	Format BulkFormat
+	Header HeaderStyle
+	// 导出字段(实体字段名, 为空时导出全部列)
+	Fields []string
+	// NULL的输出文本(CSV)
+	NullText string
+	// 对掩码列进行掩码处理
+	Masked bool
+}
+
+// 导入选项
+type ImportOption struct {
+	Format BulkFormat
+	// 每批插入件数(默认100)
+	BatchSize int
+	// 主键重复时更新
+	Upsert bool
+	// 只检查数据不写入数据库
+	DryRun bool
+	// 作为NULL处理的文本(CSV)
+	NullText string
+	// 空值处理策略(为nil时使用默认策略)
+	Policy *ConvertPolicy
+}
+
+// 行单位的导入错误
+type ImportError struct {
+	// 行号(CSV不含标题行时从1开始, 标题行为第1行)
+	Line int
+	Err  error
+}
+
+func (this ImportError) Error() string {
+	return fmt.Sprintf("line %d: %v", this.Line, this.Err)
+}
+
+// 导入结果
+type ImportReport struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Errors    []ImportError
+}
+
+// 默认每批插入件数
+const defaultImportBatchSize = 100
+
+// 导出实体表数据(实体中非空字段作为查询条件), 返回导出件数
+func (this *Orm) Export(ctx OrmContext, entity Entity, w io.Writer, option ExportOption, orderByList ...OrderByCondition) (count int64, err error) {
+	// 查询及映射的panic作为错误返回
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoveredError(r)
+		}
+	}()
+	entMetadata := GetEntityMetadata(entity)
+	columns, err := entMetadata.bulkColumns(option.Fields)
+	if err != nil {
+		return 0, err
+	}
+	headers := make([]string, len(columns))
+	for i, colMetadata := range columns {
+		headers[i] = colMetadata.header(option.Header)
+	}
+
+	var writeRow func(values []interface{}) error
+	var flush func() error
+	switch option.Format {
+	case FormatCSV, "":
+		csvWriter := csv.NewWriter(w)
+		if err = csvWriter.Write(headers); err != nil {
+			return 0, err
+		}
+		record := make([]string, len(columns))
+		writeRow = func(values []interface{}) error {
+			for i, value := range values {
+				record[i] = formatBulkValue(value, option.NullText)
+			}
+			return csvWriter.Write(record)
+		}
+		flush = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	case FormatNDJSON:
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		writeRow = func(values []interface{}) error {
+			row := make(orderedRow, len(values))
+			for i, value := range values {
+				if t, ok := value.(time.Time); ok {
+					value = formatBulkValue(t, "")
+				}
+				row[i] = orderedValue{headers[i], value}
+			}
+			return encoder.Encode(row)
+		}
+		flush = buffered.Flush
+	default:
+		return 0, ErrorUnknownFormat
+	}
+
+	sqlText, sqlParams := this.BuildSqlSelect(entity, orderByList)
+	rows := this.Retrieve(ctx, sqlText, sqlParams...)
+	defer rows.Close()
+	for {
+		target := NewEntity(entity)
+		found, err := rows.Next(target)
+		if err != nil {
+			return count, err
+		}
+		if !found {
+			break
+		}
+		if option.Masked {
+			maskFields(target)
+		}
+		_, rftValue := entityTypeValue(target)
+		values := make([]interface{}, len(columns))
+		for i, colMetadata := range columns {
+			values[i], _ = fieldDriverValue(rftValue.Field(colMetadata.FieldIndex))
+		}
+		if err = writeRow(values); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, flush()
+}
+
+// 导入实体表数据(CSV标题或NDJSON的Key为列名, 字段名或列注释)
+// 各批数据以一条INSERT SQL文插入, 失败时逐行插入以确定出错的行
+func (this *Orm) Import(ctx OrmContext, entity Entity, r io.Reader, option ImportOption) (ImportReport, error) {
+	var report ImportReport
+	entMetadata := GetEntityMetadata(entity)
+	policy := GetDefaultConvertPolicy()
+	if option.Policy != nil {
+		policy = *option.Policy
+	}
+	batchSize := option.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+
+	var readRow func() (int, map[string]interface{}, error)
+	switch option.Format {
+	case FormatCSV, "":
+		csvReader := csv.NewReader(r)
+		headers, err := csvReader.Read()
+		if err != nil {
+			return report, err
+		}
+		line := 1
+		readRow = func() (int, map[string]interface{}, error) {
+			record, err := csvReader.Read()
+			line++
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				return line, nil, ImportError{line, parseErr.Err}
+			} else if err != nil {
+				return line, nil, err
+			}
+			row := make(map[string]interface{}, len(headers))
+			for i, header := range headers {
+				if i >= len(record) || (option.NullText != "" && record[i] == option.NullText) {
+					row[header] = nil
+				} else {
+					row[header] = record[i]
+				}
+			}
+			return line, row, nil
+		}
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		line := 0
+		readRow = func() (int, map[string]interface{}, error) {
+			for scanner.Scan() {
+				line++
+				text := bytes.TrimSpace(scanner.Bytes())
+				if len(text) == 0 {
+					continue
+				}
+				var row map[string]interface{}
+				decoder := json.NewDecoder(bytes.NewReader(text))
+				decoder.UseNumber()
+				if err := decoder.Decode(&row); err != nil {
+					return line, nil, ImportError{line, err}
+				}
+				return line, row, nil
+			}
+			if err := scanner.Err(); err != nil {
+				return line, nil, err
+			}
+			return line, nil, io.EOF
+		}
+	default:
+		return report, ErrorUnknownFormat
+	}
+
+	batch := make([]bulkRow, 0, batchSize)
+	for {
+		line, row, err := readRow()
+		if err == io.EOF {
+			break
+		}
+		if importErr, ok := err.(ImportError); ok {
+			// 格式错误的行记录后继续
+			report.Total++
+			report.Failed++
+			report.Errors = append(report.Errors, importErr)
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		report.Total++
+		target := NewEntity(entity)
+		if err = entMetadata.bulkAssign(row, target, policy); err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, ImportError{line, err})
+			continue
+		}
+		batch = append(batch, bulkRow{line, target})
+		if len(batch) >= batchSize {
+			if err = this.importBatch(ctx, entMetadata, batch, option, &report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := this.importBatch(ctx, entMetadata, batch, option, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// 导入行
+type bulkRow struct {
+	line   int
+	entity Entity
+}
+
+// 插入一批数据(dry-run时只计数), 返回值只用于非行单位的错误
+func (this *Orm) importBatch(ctx OrmContext, entMetadata EntityMetadata, batch []bulkRow, option ImportOption, report *ImportReport) error {
+	if option.DryRun {
+		report.Succeeded += len(batch)
+		return nil
+	}
+	entities := make([]Entity, len(batch))
+	for i, row := range batch {
+		// 序列主键在插入前取得
+		_, rftValue := entityTypeValue(row.entity)
+		if err := this.generateSequenceKeys(ctx, entMetadata, rftValue); err != nil {
+			return err
+		}
+		entities[i] = row.entity
+	}
+	sqlText, sqlParams, err := entMetadata.buildSqlBulkInsert(ctx.Dialect(), entities, option.Upsert)
+	if err != nil {
+		return err
+	}
+	execErr, err := bulkExec(ctx, sqlText, sqlParams)
+	if err != nil {
+		return err
+	}
+	if execErr == nil {
+		report.Succeeded += len(batch)
+		return nil
+	}
+	if len(batch) == 1 {
+		report.Failed++
+		report.Errors = append(report.Errors, ImportError{batch[0].line, execErr})
+		return nil
+	}
+	// 逐行插入以确定出错的行
+	for _, row := range batch {
+		if err = this.importBatch(ctx, entMetadata, []bulkRow{row}, option, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 导入使用的保存点名
+const bulkSavepoint = "ORM_BULK_IMPORT"
+
+// 执行插入, execErr为插入失败的错误, err为保存点操作的错误
+// 事务中以保存点包围, 失败时回滚至保存点, 使事务(PostgreSQL等出错后中止的事务)可继续逐行插入
+func bulkExec(ctx OrmContext, sqlText string, sqlParams []interface{}) (execErr error, err error) {
+	if !ctx.InTransaction() {
+		_, execErr = ctx.exec(sqlText, sqlParams)
+		return execErr, nil
+	}
+	if _, err = ctx.exec("SAVEPOINT "+bulkSavepoint, nil); err != nil {
+		return nil, err
+	}
+	if _, execErr = ctx.exec(sqlText, sqlParams); execErr != nil {
+		_, err = ctx.exec("ROLLBACK TO SAVEPOINT "+bulkSavepoint, nil)
+		return execErr, err
+	}
+	_, err = ctx.exec("RELEASE SAVEPOINT "+bulkSavepoint, nil)
+	return nil, err
+}
+
+// recover()的值变换为error
+func recoveredError(r interface{}) error {
+	if err, ok := r.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", r)
+}
+
+// 构建多行INSERT SQL文(插入全部列, upsert时追加方言的主键重复时更新子句)
+func (this EntityMetadata) buildSqlBulkInsert(dialect Dialect, entities []Entity, upsert bool) (string, []interface{}, error) {
+	var columns []ColumnMetadata
+	for _, colMetadata := range this.OrderedColumns() {
+		if !this.isTenantColumn(colMetadata.FieldId) {
+			columns = append(columns, colMetadata)
+		}
+	}
+	tenantCondition, tenantParams := this.tenantCondition("")
+
+	var sql bytes.Buffer
+	var sqlParamList []interface{}
+	sql.WriteString("INSERT INTO ")
+	sql.WriteString(this.tableRef())
+	sql.WriteString("(")
+	for i, colMetadata := range columns {
+		if i > 0 {
+			sql.WriteString(",")
+		}
+		sql.WriteString(colMetadata.Column)
+	}
+	if tenantCondition != "" {
+		sql.WriteString(",")
+		sql.WriteString(this.Tenant.Column)
+	}
+	sql.WriteString(") VALUES")
+	for i, entity := range entities {
+		if i > 0 {
+			sql.WriteString(",")
+		}
+		sql.WriteString("(")
+		_, rftValue := entityTypeValue(entity)
+		for j, colMetadata := range columns {
+			if j > 0 {
+				sql.WriteString(",")
+			}
+			sql.WriteString("?")
+			sqlParamList = append(sqlParamList, this.paramValue(colMetadata.FieldId, rftValue.Field(colMetadata.FieldIndex).Interface()))
+		}
+		if tenantCondition != "" {
+			sql.WriteString(",?")
+			sqlParamList = append(sqlParamList, tenantParams...)
+		}
+		sql.WriteString(")")
+	}
+
+	if upsert {
+		var keys []string
+		var updates []string
+		for _, colMetadata := range columns {
+			if colMetadata.Key {
+				keys = append(keys, colMetadata.Column)
+			} else {
+				updates = append(updates, colMetadata.Column)
+			}
+		}
+		if tenantCondition != "" {
+			keys = append(keys, this.Tenant.Column)
+		}
+		if len(keys) == 0 {
+			return "", nil, fmt.Errorf("entity %s has no primary key", this.Table)
+		}
+		clause, err := dialect.UpsertClause(keys, updates)
+		if err != nil {
+			return "", nil, err
+		}
+		sql.WriteString(" ")
+		sql.WriteString(clause)
+	}
+	return sql.String(), sqlParamList, nil
+}
+
+// 导入导出的列(fields为空时返回全部列)
+func (this EntityMetadata) bulkColumns(fields []string) ([]ColumnMetadata, error) {
+	if len(fields) == 0 {
+		return this.OrderedColumns(), nil
+	}
+	columns := make([]ColumnMetadata, len(fields))
+	for i, field := range fields {
+		colMetadata, exist := this.Columns[field]
+		if !exist {
+			return nil, fmt.Errorf("unknown entity field: %s.%s", this.Table, field)
+		}
+		columns[i] = colMetadata
+	}
+	return columns, nil
+}
+
+// 列标题
+func (this ColumnMetadata) header(style HeaderStyle) string {
+	switch style {
+	case HeaderComment:
+		if this.ColumnComment != "" {
+			return this.ColumnComment
+		}
+	case HeaderField:
+		return this.FieldId
+	}
+	return this.Column
+}
+
+// 按标题(列名, 字段名或列注释)设置实体字段, 并检查实体
+func (this EntityMetadata) bulkAssign(row map[string]interface{}, entity Entity, policy ConvertPolicy) error {
+	_, rftValue := entityTypeValue(entity)
+	for header, value := range row {
+		colMetadata, found := this.columnByHeader(header)
+		if !found {
+			return fmt.Errorf("unknown column: %s", header)
+		}
+		if number, ok := value.(json.Number); ok {
+			value = string(number)
+		}
+		if err := setEntityField(rftValue.Field(colMetadata.FieldIndex), colMetadata, value, policy); err != nil {
+			return err
+		}
+	}
+	// 生成UUID, Snowflake主键
+	this.generateKeys(rftValue)
+	if err := this.validate(entity, true); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 根据标题查找列Metadata
+func (this EntityMetadata) columnByHeader(header string) (ColumnMetadata, bool) {
+	if colMetadata, exist := this.Columns[header]; exist {
+		return colMetadata, true
+	}
+	for _, colMetadata := range this.Columns {
+		if strings.EqualFold(colMetadata.Column, header) || (colMetadata.ColumnComment != "" && colMetadata.ColumnComment == header) {
+			return colMetadata, true
+		}
+	}
+	return ColumnMetadata{}, false
+}
+
+// 导出值的文本形式
+func formatBulkValue(value interface{}, nullText string) string {
+	switch v := value.(type) {
+	case nil:
+		return nullText
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(value)
+}
+
+// 保持列顺序的JSON对象
+type orderedRow []orderedValue
+
+type orderedValue struct {
+	key   string
+	value interface{}
+}
+
+func (this orderedRow) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("{")
+	for i, item := range this {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		key, err := json.Marshal(item.key)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(key)
+		buffer.WriteString(":")
+		value := item.value
+		if bytesValue, ok := value.([]byte); ok {
+			value = string(bytesValue)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(encoded)
+	}
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
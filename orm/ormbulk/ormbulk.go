@@ -0,0 +1,201 @@
+// 实体表数据的批量导入导出命令
+//
+// 应用程序在main中导入数据库驱动, 以可导入导出的实体创建命令:
+//
+//	func main() {
+//		if err := ormbulk.NewCommand(&dto.AlbumEntity{}, &dto.AlbumTrackEntity{}).Run(os.Args[1:]); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+//	ormbulk export -table ALBUM -format csv -header comment -out album.csv
+//	ormbulk import -table ALBUM -format ndjson -in album.ndjson -upsert -dry-run
+package ormbulk
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/umeframework/gear/core"
+	"github.com/umeframework/gear/orm"
+)
+
+// 用法
+const Usage = "usage: ormbulk export|import -table TABLE [options]"
+
+// 批量导入导出命令
+type Command struct {
+	// 可导入导出的实体(Key为大写表名)
+	entities map[string]orm.Entity
+	// 打开数据库上下文(为nil时读取配置文件的'ume.gdbc.*'项, 命令结束时关闭)
+	Open func(config string) (orm.OrmContext, error)
+	// 标准输入输出(为nil时使用os.Stdin, os.Stdout, os.Stderr)
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// 创建命令(entities为可导入导出的实体, 数据库驱动由调用方导入)
+func NewCommand(entities ...orm.Entity) *Command {
+	command := &Command{entities: make(map[string]orm.Entity, len(entities))}
+	for _, entity := range entities {
+		command.entities[strings.ToUpper(entity.TableName())] = entity
+	}
+	return command
+}
+
+// 执行命令(args不含程序名)
+func (this *Command) Run(args []string) error {
+	if len(args) < 1 {
+		return errors.New(Usage)
+	}
+	command, args := args[0], args[1:]
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(this.stderr())
+	config := flags.String("config", "gear.properties", "connection properties")
+	table := flags.String("table", "", "table name")
+	format := flags.String("format", "csv", "csv or ndjson")
+	tenant := flags.String("tenant", "", "tenant")
+	null := flags.String("null", "", "text of NULL (csv)")
+
+	switch command {
+	case "export":
+		header := flags.String("header", "column", "column, comment or field")
+		fields := flags.String("fields", "", "comma separated fields")
+		out := flags.String("out", "", "output file (stdout if empty)")
+		masked := flags.Bool("masked", false, "mask masked columns")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		option := orm.ExportOption{Format: orm.BulkFormat(*format), NullText: *null, Masked: *masked}
+		switch *header {
+		case "comment":
+			option.Header = orm.HeaderComment
+		case "field":
+			option.Header = orm.HeaderField
+		}
+		if *fields != "" {
+			option.Fields = strings.Split(*fields, ",")
+		}
+		entity, err := this.lookup(*table)
+		if err != nil {
+			return err
+		}
+		return this.export(*config, entity, *tenant, *out, option)
+	case "import":
+		in := flags.String("in", "", "input file (stdin if empty)")
+		batch := flags.Int("batch", 100, "rows per insert")
+		upsert := flags.Bool("upsert", false, "update rows with duplicate key")
+		dryRun := flags.Bool("dry-run", false, "validate only")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		option := orm.ImportOption{
+			Format:    orm.BulkFormat(*format),
+			BatchSize: *batch,
+			Upsert:    *upsert,
+			DryRun:    *dryRun,
+			NullText:  *null,
+		}
+		entity, err := this.lookup(*table)
+		if err != nil {
+			return err
+		}
+		return this.load(*config, entity, *tenant, *in, option)
+	}
+	return errors.New(Usage)
+}
+
+func (this *Command) lookup(table string) (orm.Entity, error) {
+	entity, exist := this.entities[strings.ToUpper(table)]
+	if !exist {
+		return nil, fmt.Errorf("unknown table: %s", table)
+	}
+	return entity, nil
+}
+
+// 打开数据库上下文, 使用后调用release
+func (this *Command) openContext(config string, tenant string) (ctx orm.OrmContext, release func(), err error) {
+	if this.Open != nil {
+		if ctx, err = this.Open(config); err != nil {
+			return ctx, nil, err
+		}
+		return ctx.WithTenant(tenant), func() {}, nil
+	}
+	cfg := core.NewPropertyConfig(config)
+	driver := cfg.Get("ume.gdbc.driver")
+	dataSource := cfg.Get("ume.gdbc.url")
+	if username := cfg.Get("ume.gdbc.username"); username != "" {
+		dataSource = username + ":" + cfg.Get("ume.gdbc.password") + "@" + dataSource
+	}
+	ctx = orm.GetOrmContext(driver, dataSource)
+	return ctx.WithTenant(tenant), ctx.Close, nil
+}
+
+func (this *Command) export(config string, entity orm.Entity, tenant string, out string, option orm.ExportOption) error {
+	w := this.stdout()
+	if out != "" {
+		file, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	ctx, release, err := this.openContext(config, tenant)
+	if err != nil {
+		return err
+	}
+	defer release()
+	count, err := (&orm.Orm{}).Export(ctx, entity, w, option)
+	fmt.Fprintf(this.stderr(), "exported %d rows\n", count)
+	return err
+}
+
+func (this *Command) load(config string, entity orm.Entity, tenant string, in string, option orm.ImportOption) error {
+	r := this.stdin()
+	if in != "" {
+		file, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	ctx, release, err := this.openContext(config, tenant)
+	if err != nil {
+		return err
+	}
+	defer release()
+	report, err := (&orm.Orm{}).Import(ctx, entity, r, option)
+	for _, rowErr := range report.Errors {
+		fmt.Fprintln(this.stderr(), rowErr)
+	}
+	fmt.Fprintf(this.stderr(), "total %d, succeeded %d, failed %d\n", report.Total, report.Succeeded, report.Failed)
+	return err
+}
+
+func (this *Command) stdin() io.Reader {
+	if this.Stdin != nil {
+		return this.Stdin
+	}
+	return os.Stdin
+}
+
+func (this *Command) stdout() io.Writer {
+	if this.Stdout != nil {
+		return this.Stdout
+	}
+	return os.Stdout
+}
+
+func (this *Command) stderr() io.Writer {
+	if this.Stderr != nil {
+		return this.Stderr
+	}
+	return os.Stderr
+}
@@ -0,0 +1,446 @@
+package orm
+
+import (
+	"container/list"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 缓存后端接口
+type CacheBackend interface {
+	// 读取缓存
+	Get(key string) (interface{}, bool)
+	// 写入缓存(ttl为0时使用后端默认有效期)
+	Set(key string, value interface{}, ttl time.Duration)
+	// 删除以prefix开头的缓存
+	DeletePrefix(prefix string)
+	// 清空缓存
+	Clear()
+}
+
+// 实体缓存选项(通过'SetEntityCache'登录至实体Metadata)
+// 启用后, 'BuildSqlSelectOne'及'BuildSqlSelect'构建的查询经由'Retrieve'映射时优先读取缓存
+type EntityCacheOption struct {
+	// 缓存映射至单一实体的查询结果(主键查询)
+	Enabled bool
+	// 缓存映射至实体slice的查询结果
+	CacheQuery bool
+	// 有效期(为0时使用后端默认有效期)
+	TTL time.Duration
+}
+
+// 缓存命中统计
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Puts          int64
+	Invalidations int64
+}
+
+// 缓存命中率
+func (this CacheStats) HitRate() float64 {
+	total := this.Hits + this.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(this.Hits) / float64(total)
+}
+
+// 缓存种类
+const (
+	cacheKindKey   = "key"
+	cacheKindQuery = "query"
+)
+
+// 缓存管理
+type ormCache struct {
+	backend CacheBackend
+	stats   map[string]*CacheStats
+	lock    sync.RWMutex
+	// 表的版本(失效时递增), 查询期间版本变更时不写入缓存
+	generations map[string]uint64
+	genLock     sync.Mutex
+}
+
+var ormCacheInstance = &ormCache{stats: make(map[string]*CacheStats), generations: make(map[string]uint64)}
+
+// 启用缓存的实体的SELECT SQL文(SQL文 -> 实体实例)
+var cacheableSqls sync.Map
+
+// 设置缓存后端(为nil时停用缓存)
+func SetCacheBackend(backend CacheBackend) {
+	ormCacheInstance.lock.Lock()
+	defer ormCacheInstance.lock.Unlock()
+	if ormCacheInstance.backend != nil {
+		ormCacheInstance.backend.Clear()
+	}
+	ormCacheInstance.backend = backend
+}
+
+// 登录实体缓存选项
+func SetEntityCache(entity Entity, option EntityCacheOption) {
+	updateEntityMetadata(entity, func(entMetadata *EntityMetadata) {
+		entMetadata.Cache = option
+	})
+	invalidateCache(entity.TableName())
+}
+
+// 获取实体(表)缓存统计
+func GetCacheStats(entity Entity) CacheStats {
+	return ormCacheInstance.statsOf(entity.TableName()).snapshot()
+}
+
+// 获取所有表的缓存统计
+func GetAllCacheStats() map[string]CacheStats {
+	ormCacheInstance.lock.RLock()
+	defer ormCacheInstance.lock.RUnlock()
+	allStats := make(map[string]CacheStats, len(ormCacheInstance.stats))
+	for table, stats := range ormCacheInstance.stats {
+		allStats[table] = stats.snapshot()
+	}
+	return allStats
+}
+
+// 清空缓存及统计
+func ClearCache() {
+	ormCacheInstance.lock.Lock()
+	defer ormCacheInstance.lock.Unlock()
+	if ormCacheInstance.backend != nil {
+		ormCacheInstance.backend.Clear()
+	}
+	ormCacheInstance.stats = make(map[string]*CacheStats)
+}
+
+// 登录可缓存的SELECT SQL文(实体未启用缓存时不登录)
+func registerCacheableSql(sqlText string, entity Entity, entMetadata EntityMetadata) {
+	if !entMetadata.Cache.Enabled && !entMetadata.Cache.CacheQuery {
+		return
+	}
+	if _, exist := cacheableSqls.Load(sqlText); !exist {
+		cacheableSqls.Store(sqlText, NewEntity(entity))
+	}
+}
+
+//------------------------------
+// 经由缓存的查询
+
+// 启用缓存的查询(映射时读取缓存, 未命中时执行查询并写入缓存)
+type cachedQuery struct {
+	ctx        OrmContext
+	sqlText    string
+	sqlParams  []interface{}
+	entityType reflect.Type
+	metadata   EntityMetadata
+}
+
+// 创建启用缓存的查询(SQL文不可缓存, 无缓存后端或事务中时返回nil)
+func newCachedQuery(ctx OrmContext, sqlText string, sqlParams []interface{}) *cachedQuery {
+	if ctx.InTransaction() || ormCacheInstance.getBackend() == nil {
+		return nil
+	}
+	value, exist := cacheableSqls.Load(sqlText)
+	if !exist {
+		return nil
+	}
+	entity := value.(Entity)
+	entMetadata := GetEntityMetadata(entity)
+	if !entMetadata.Cache.Enabled && !entMetadata.Cache.CacheQuery {
+		return nil
+	}
+	entityType, _ := entityTypeValue(entity)
+	return &cachedQuery{ctx, sqlText, sqlParams, entityType, entMetadata}
+}
+
+// 按映射目标选择缓存种类(不缓存时返回空字符串)
+func (this *cachedQuery) kindOf(tar interface{}) string {
+	t := reflect.TypeOf(tar)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return ""
+	}
+	switch {
+	case t.Elem() == this.entityType && this.metadata.Cache.Enabled:
+		return cacheKindKey
+	case t.Elem().Kind() == reflect.Slice && t.Elem().Elem() == this.entityType && this.metadata.Cache.CacheQuery:
+		return cacheKindQuery
+	}
+	return ""
+}
+
+// 从缓存映射至tar, 未命中时执行查询并写入缓存
+func (this *cachedQuery) mapping(rows *OrmRows, tar interface{}, ormMapper OrmMapper) error {
+	kind := this.kindOf(tar)
+	backend := ormCacheInstance.getBackend()
+	if kind == "" || backend == nil {
+		rows.load()
+		return rows.mapResultSet(tar, ormMapper)
+	}
+
+	table := this.metadata.Table
+	key, ok := cacheKey(table, kind, this.ctx.Tenant(), this.sqlText, this.sqlParams)
+	if !ok {
+		rows.load()
+		return rows.mapResultSet(tar, ormMapper)
+	}
+	stats := ormCacheInstance.statsOf(table)
+	tarValue := reflect.ValueOf(tar).Elem()
+	if cached, found := backend.Get(key); found {
+		atomic.AddInt64(&stats.Hits, 1)
+		if kind == cacheKindQuery {
+			tarValue.Set(copySlice(reflect.ValueOf(cached)))
+		} else {
+			tarValue.Set(copyEntity(reflect.ValueOf(cached)))
+			if entity, ok := tar.(Entity); ok {
+				Track(entity)
+			}
+		}
+		return nil
+	}
+	atomic.AddInt64(&stats.Misses, 1)
+
+	// 查询前取得表的版本
+	generation := ormCacheInstance.generation(table)
+	rows.load()
+	if err := rows.mapResultSet(tar, ormMapper); err != nil {
+		return err
+	}
+	var value reflect.Value
+	if kind == cacheKindQuery {
+		value = copySlice(tarValue)
+	} else {
+		value = copyEntity(tarValue)
+	}
+	ormCacheInstance.put(table, generation, key, value.Interface(), this.metadata.Cache.TTL)
+	return nil
+}
+
+func (this *ormCache) getBackend() CacheBackend {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.backend
+}
+
+func (this *ormCache) statsOf(table string) *CacheStats {
+	this.lock.RLock()
+	stats, exist := this.stats[table]
+	this.lock.RUnlock()
+	if exist {
+		return stats
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if stats, exist = this.stats[table]; !exist {
+		stats = &CacheStats{}
+		this.stats[table] = stats
+	}
+	return stats
+}
+
+// 表的当前版本
+func (this *ormCache) generation(table string) uint64 {
+	this.genLock.Lock()
+	defer this.genLock.Unlock()
+	return this.generations[table]
+}
+
+// 写入缓存(表的版本与查询前不一致时不写入)
+func (this *ormCache) put(table string, generation uint64, key string, value interface{}, ttl time.Duration) bool {
+	this.genLock.Lock()
+	defer this.genLock.Unlock()
+	backend := this.getBackend()
+	if backend == nil || this.generations[table] != generation {
+		return false
+	}
+	backend.Set(key, value, ttl)
+	atomic.AddInt64(&this.statsOf(table).Puts, 1)
+	return true
+}
+
+func (this *CacheStats) snapshot() CacheStats {
+	return CacheStats{
+		Hits:          atomic.LoadInt64(&this.Hits),
+		Misses:        atomic.LoadInt64(&this.Misses),
+		Puts:          atomic.LoadInt64(&this.Puts),
+		Invalidations: atomic.LoadInt64(&this.Invalidations),
+	}
+}
+
+// 使表的缓存失效
+func invalidateCache(table string) {
+	if table == "" {
+		return
+	}
+	// 与写入缓存互斥, 失效前开始的查询结果不再写入
+	ormCacheInstance.genLock.Lock()
+	ormCacheInstance.generations[table]++
+	backend := ormCacheInstance.getBackend()
+	if backend != nil {
+		backend.DeletePrefix(table + ":")
+	}
+	ormCacheInstance.genLock.Unlock()
+	if backend != nil {
+		atomic.AddInt64(&ormCacheInstance.statsOf(table).Invalidations, 1)
+	}
+}
+
+// 缓存Key(表名:种类:租户:SQL文:参数), 参数变换为驱动值并附加类型(无法变换时返回false, 不使用缓存)
+func cacheKey(table string, kind string, tenant string, sqlText string, sqlParams []interface{}) (string, bool) {
+	var key strings.Builder
+	fmt.Fprintf(&key, "%s:%s:%s:%s:", table, kind, tenant, sqlText)
+	for _, param := range sqlParams {
+		value, err := driver.DefaultParameterConverter.ConvertValue(param)
+		if err != nil {
+			return "", false
+		}
+		switch v := value.(type) {
+		case string, []byte:
+			fmt.Fprintf(&key, "%T%q,", v, v)
+		case time.Time:
+			fmt.Fprintf(&key, "%T(%s),", v, v.Format(time.RFC3339Nano))
+		default:
+			fmt.Fprintf(&key, "%T(%v),", v, v)
+		}
+	}
+	return key.String(), true
+}
+
+// 复制slice及各元素(避免缓存内容被调用者修改)
+func copySlice(slice reflect.Value) reflect.Value {
+	copied := reflect.MakeSlice(slice.Type(), slice.Len(), slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		copied.Index(i).Set(copyEntity(slice.Index(i)))
+	}
+	return copied
+}
+
+// 复制实体, '[]byte'字段复制内容
+func copyEntity(entity reflect.Value) reflect.Value {
+	copied := reflect.New(entity.Type()).Elem()
+	copied.Set(entity)
+	if entity.Kind() != reflect.Struct {
+		return copied
+	}
+	for i := 0; i < copied.NumField(); i++ {
+		field := copied.Field(i)
+		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8 && !field.IsNil() && field.CanSet() {
+			field.SetBytes(append([]byte(nil), field.Bytes()...))
+		}
+	}
+	return copied
+}
+
+var updateSqlPattern = regexp.MustCompile("(?i)^\\s*(?:INSERT\\s+INTO|REPLACE\\s+INTO|UPDATE|DELETE\\s+FROM)\\s+([\\w.`\"{}]+)")
+
+// 解析更新SQL文的表名
+func updatedTableName(sqlText string) string {
+	match := updateSqlPattern.FindStringSubmatch(sqlText)
+	if match == nil {
+		return ""
+	}
+	table := strings.Trim(match[1], "`\"{}")
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = strings.Trim(table[i+1:], "`\"")
+	}
+	return table
+}
+
+//------------------------------
+// 内存LRU缓存
+
+// 带有效期的内存LRU缓存
+type LruCache struct {
+	capacity   int
+	defaultTTL time.Duration
+	entries    *list.List
+	items      map[string]*list.Element
+	lock       sync.Mutex
+}
+
+type lruEntry struct {
+	key    string
+	value  interface{}
+	expire time.Time
+}
+
+// 创建内存LRU缓存(capacity为最大件数, defaultTTL为0时不过期)
+func NewLruCache(capacity int, defaultTTL time.Duration) *LruCache {
+	return &LruCache{
+		capacity:   capacity,
+		defaultTTL: defaultTTL,
+		entries:    list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (this *LruCache) Get(key string) (interface{}, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	element, found := this.items[key]
+	if !found {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expire.IsZero() && time.Now().After(entry.expire) {
+		this.removeElement(element)
+		return nil, false
+	}
+	this.entries.MoveToFront(element)
+	return entry.value, true
+}
+
+func (this *LruCache) Set(key string, value interface{}, ttl time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if ttl == 0 {
+		ttl = this.defaultTTL
+	}
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	if element, found := this.items[key]; found {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expire = expire
+		this.entries.MoveToFront(element)
+		return
+	}
+	this.items[key] = this.entries.PushFront(&lruEntry{key, value, expire})
+	for this.capacity > 0 && this.entries.Len() > this.capacity {
+		this.removeElement(this.entries.Back())
+	}
+}
+
+func (this *LruCache) DeletePrefix(prefix string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for key, element := range this.items {
+		if strings.HasPrefix(key, prefix) {
+			this.removeElement(element)
+		}
+	}
+}
+
+func (this *LruCache) Clear() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.entries.Init()
+	this.items = make(map[string]*list.Element)
+}
+
+// 缓存件数
+func (this *LruCache) Len() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.entries.Len()
+}
+
+func (this *LruCache) removeElement(element *list.Element) {
+	this.entries.Remove(element)
+	delete(this.items, element.Value.(*lruEntry).key)
+}
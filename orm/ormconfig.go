@@ -2,15 +2,18 @@ package orm
 
 import (
 	"reflect"
+	"regexp"
 	"bytes"
 	"strings"
 	"strconv"
 	"sync"
+	"sort"
 )
 
 // 实体Metadata保存数据结构
 type EntityConfig struct {
 	Entities map[string]EntityMetadata
+	lock     sync.RWMutex
 }
 
 // 实体(表)Metadata数据结构
@@ -24,6 +27,9 @@ type EntityMetadata struct {
 	SQLSelectDefault      string
 	SQLSelectOneDefault   string
 	SQLSelectCountDefault string
+	Cache                 EntityCacheOption
+	Tenant                TenantPolicy
+	Shard                 ShardRule
 }
 
 // 实体字段(列)Metadata数据结构
@@ -37,6 +43,19 @@ type ColumnMetadata struct {
 	Key             bool
 	NotNull         bool
 	VersionCheck    bool
+	// 加密保存('encrypt:true')
+	Encrypted       bool
+	// 输出时的掩码方式('mask:"email"'等)
+	Mask            string
+	// 主键生成方式('generate:"snowflake"'等)
+	Generate        string
+	// 主键序列名('generate:"sequence:序列名"')
+	Sequence        string
+	// 检查规则('length:50', 'min:0', 'max:100', 'pattern:"^[0-9]+$"')
+	Length          int
+	Min             *float64
+	Max             *float64
+	Pattern         *regexp.Regexp
 }
 
 // 'EntityConfig'指针变量
@@ -56,15 +75,65 @@ func singleEntityConfig() *EntityConfig {
 func GetEntityMetadata(entity Entity) EntityMetadata {
 	instance := singleEntityConfig()
 	tableName := entity.TableName()
+	instance.lock.RLock()
 	entMetadata, exist := instance.Entities[tableName]
+	instance.lock.RUnlock()
 	if exist {
 		return entMetadata
 	}
 	nem := parseEntity(entity)
+	instance.lock.Lock()
+	defer instance.lock.Unlock()
+	if entMetadata, exist = instance.Entities[tableName]; exist {
+		return entMetadata
+	}
 	instance.Entities[tableName] = nem
 	return instance.Entities[tableName]
 }
 
+// 更新实体Metadata(用于登录缓存等附加设置)
+func updateEntityMetadata(entity Entity, update func(entMetadata *EntityMetadata)) {
+	entMetadata := GetEntityMetadata(entity)
+	instance := singleEntityConfig()
+	instance.lock.Lock()
+	defer instance.lock.Unlock()
+	entMetadata = instance.Entities[entity.TableName()]
+	update(&entMetadata)
+	instance.Entities[entity.TableName()] = entMetadata
+}
+
+// 创建与entity同类型的新实体实例
+func NewEntity(entity Entity) Entity {
+	rftType := reflect.TypeOf(entity)
+	if rftType.Kind() == reflect.Ptr {
+		rftType = rftType.Elem()
+	}
+	return reflect.New(rftType).Interface().(Entity)
+}
+
+// 按字段定义顺序返回列Metadata
+func (this EntityMetadata) OrderedColumns() []ColumnMetadata {
+	columns := make([]ColumnMetadata, 0, len(this.Columns))
+	for _, colMetadata := range this.Columns {
+		columns = append(columns, colMetadata)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].FieldIndex < columns[j].FieldIndex
+	})
+	return columns
+}
+
+// 按字段定义顺序返回主键列Metadata
+func (this EntityMetadata) KeyColumns() []ColumnMetadata {
+	var keys []ColumnMetadata
+	for _, colMetadata := range this.OrderedColumns() {
+		if colMetadata.Key {
+			keys = append(keys, colMetadata)
+		}
+	}
+	return keys
+}
+
 // 解析实体实例获得Metadata
 func parseEntity(entity Entity) EntityMetadata {
 	var sqlSelect bytes.Buffer
@@ -100,7 +169,7 @@ func parseEntity(entity Entity) EntityMetadata {
 		colMetadata.FieldId = field.Name
 		colMetadata.FieldType = field.Type
 		colMetadata.FieldIndex = i
-		tagElements := strings.Split(fieldTag, ",")
+		tagElements := splitTag(fieldTag)
 		for _, e := range tagElements {
 			e = strings.TrimSpace(e)
 			if strings.HasPrefix(e, "name:") {
@@ -134,8 +203,24 @@ func parseEntity(entity Entity) EntityMetadata {
 			} else if strings.HasPrefix(e, "version:") {
 				val := strings.Trim(strings.TrimSpace(strings.Replace(e, "version:", "", -1)), "\"")
 				colMetadata.VersionCheck,_ = strconv.ParseBool(val)
+			} else if strings.HasPrefix(e, "encrypt:") {
+				val := strings.Trim(strings.TrimSpace(strings.Replace(e, "encrypt:", "", -1)), "\"")
+				colMetadata.Encrypted,_ = strconv.ParseBool(val)
+			} else if strings.HasPrefix(e, "mask:") {
+				val := strings.Trim(strings.TrimSpace(strings.Replace(e, "mask:", "", -1)), "\"")
+				colMetadata.Mask = val
+			} else if strings.HasPrefix(e, "length:") || strings.HasPrefix(e, "min:") || strings.HasPrefix(e, "max:") || strings.HasPrefix(e, "pattern:") {
+				i := strings.Index(e, ":")
+				val := strings.Trim(strings.TrimSpace(e[i+1:]), "\"")
+				parseValidationTag(entity.TableName(), &colMetadata, e[:i], val)
+			} else if strings.HasPrefix(e, "generate:") {
+				val := strings.Trim(strings.TrimSpace(strings.Replace(e, "generate:", "", -1)), "\"")
+				parseGenerate(entity.TableName(), &colMetadata, val)
 			}
 		}
+		if colMetadata.Encrypted {
+			checkEncryptedColumn(entity.TableName(), colMetadata)
+		}
 		colMetadataMap[fieldName] = colMetadata
 	}
 
@@ -0,0 +1,486 @@
+package orm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 空值处理方式
+type EmptyPolicy int
+
+const (
+	// 空值('', 0)作为有效值
+	EmptyAsValue EmptyPolicy = iota
+	// 空字符串作为NULL
+	EmptyStringAsNull
+	// 空字符串及零值作为NULL
+	EmptyAsNull
+)
+
+// 转换时的空值处理策略(优先级: Fields > ColumnTypes > Default)
+type ConvertPolicy struct {
+	Default     EmptyPolicy
+	ColumnTypes map[string]EmptyPolicy
+	Fields      map[string]EmptyPolicy
+	// 'EntityToDto'时对掩码列进行掩码(默认输出原值, 掩码后的DTO不可再写回实体)
+	Mask        bool
+}
+
+// 默认策略: 日期时间类型的空字符串作为NULL, 其余作为有效值
+var defaultConvertPolicy = ConvertPolicy{
+	Default: EmptyAsValue,
+	ColumnTypes: map[string]EmptyPolicy{
+		"DATE":      EmptyStringAsNull,
+		"TIME":      EmptyStringAsNull,
+		"DATETIME":  EmptyStringAsNull,
+		"TIMESTAMP": EmptyStringAsNull,
+	},
+}
+var defaultConvertPolicyLock sync.RWMutex
+
+// 设置默认空值处理策略
+func SetDefaultConvertPolicy(policy ConvertPolicy) {
+	defaultConvertPolicyLock.Lock()
+	defer defaultConvertPolicyLock.Unlock()
+	defaultConvertPolicy = policy
+}
+
+// 获取默认空值处理策略
+func GetDefaultConvertPolicy() ConvertPolicy {
+	defaultConvertPolicyLock.RLock()
+	defer defaultConvertPolicyLock.RUnlock()
+	return defaultConvertPolicy
+}
+
+// 字段对应关系(实体字段序号 - 对方字段序号)
+type convertFieldPair struct {
+	column      ColumnMetadata
+	entityIndex int
+	otherIndex  int
+}
+
+var (
+	convertPairCache = make(map[[2]reflect.Type][]convertFieldPair)
+	convertPairLock  sync.RWMutex
+)
+
+// 实体变换为'map'(Key为字段名, 仅包含非NULL字段)
+func EntityToMap(entity Entity) map[string]interface{} {
+	entMetadata := GetEntityMetadata(entity)
+	_, rftValue := entityTypeValue(entity)
+	tar := make(map[string]interface{})
+	for _, colMetadata := range entMetadata.OrderedColumns() {
+		if value, valid := fieldDriverValue(rftValue.Field(colMetadata.FieldIndex)); valid {
+			tar[colMetadata.FieldId] = value
+		}
+	}
+	return tar
+}
+
+// 从'map'(Key为字段名或列名)设置实体, map中不存在的字段保持不变
+func MapToEntity(src map[string]interface{}, entity Entity, policy ...ConvertPolicy) error {
+	entMetadata := GetEntityMetadata(entity)
+	_, rftValue := entityTypeValue(entity)
+	convertPolicy := resolveConvertPolicy(policy)
+	for _, colMetadata := range entMetadata.OrderedColumns() {
+		value, exist := src[colMetadata.FieldId]
+		if !exist {
+			if value, exist = src[colMetadata.Column]; !exist {
+				continue
+			}
+		}
+		if err := setEntityField(rftValue.Field(colMetadata.FieldIndex), colMetadata, value, convertPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 实体变换为DTO(dto为结构体指针, 按字段名对应, NULL变换为零值, 策略指定Mask时掩码列进行掩码处理)
+func EntityToDto(entity Entity, dto interface{}, policy ...ConvertPolicy) error {
+	_, rftValue := entityTypeValue(entity)
+	dtoValue := reflect.ValueOf(dto)
+	if dtoValue.Kind() != reflect.Ptr || dtoValue.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("[dto] parameter must be a pointer to struct")
+	}
+	dtoValue = dtoValue.Elem()
+	mask := resolveConvertPolicy(policy).Mask
+	for _, pair := range convertPairs(entity, dtoValue.Type()) {
+		target := dtoValue.Field(pair.otherIndex)
+		value, valid := fieldDriverValue(rftValue.Field(pair.entityIndex))
+		if !valid {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		// 掩码列输出掩码后的值
+		if text, ok := value.(string); ok && pair.column.Mask != "" && mask {
+			value = MaskValue(pair.column.Mask, text)
+		}
+		if err := assignValue(target, value); err != nil {
+			return fmt.Errorf("convert field %s: %v", pair.column.FieldId, err)
+		}
+	}
+	return nil
+}
+
+// 从DTO(结构体或结构体指针)设置实体, 按字段名对应
+func DtoToEntity(dto interface{}, entity Entity, policy ...ConvertPolicy) error {
+	_, rftValue := entityTypeValue(entity)
+	dtoValue := reflect.ValueOf(dto)
+	if dtoValue.Kind() == reflect.Ptr {
+		dtoValue = dtoValue.Elem()
+	}
+	if dtoValue.Kind() != reflect.Struct {
+		return fmt.Errorf("[dto] parameter must be a struct")
+	}
+	convertPolicy := resolveConvertPolicy(policy)
+	for _, pair := range convertPairs(entity, dtoValue.Type()) {
+		value := dtoValue.Field(pair.otherIndex).Interface()
+		if err := setEntityField(rftValue.Field(pair.entityIndex), pair.column, value, convertPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolveConvertPolicy(policy []ConvertPolicy) ConvertPolicy {
+	if len(policy) > 0 {
+		return policy[0]
+	}
+	return GetDefaultConvertPolicy()
+}
+
+// 空值处理方式
+func (this ConvertPolicy) emptyPolicyOf(colMetadata ColumnMetadata) EmptyPolicy {
+	if emptyPolicy, exist := this.Fields[colMetadata.FieldId]; exist {
+		return emptyPolicy
+	}
+	if emptyPolicy, exist := this.ColumnTypes[baseColumnType(colMetadata.ColumnType)]; exist {
+		return emptyPolicy
+	}
+	return this.Default
+}
+
+// 列类型名(去除长度定义, 大写)
+func baseColumnType(columnType string) string {
+	if i := strings.IndexByte(columnType, '('); i >= 0 {
+		columnType = columnType[:i]
+	}
+	return strings.ToUpper(strings.TrimSpace(columnType))
+}
+
+// 获取(并缓存)实体与其他结构体的字段对应关系
+func convertPairs(entity Entity, otherType reflect.Type) []convertFieldPair {
+	entityType, _ := entityTypeValue(entity)
+	cacheKey := [2]reflect.Type{entityType, otherType}
+	convertPairLock.RLock()
+	pairs, exist := convertPairCache[cacheKey]
+	convertPairLock.RUnlock()
+	if exist {
+		return pairs
+	}
+
+	for _, colMetadata := range GetEntityMetadata(entity).OrderedColumns() {
+		field, found := otherType.FieldByName(colMetadata.FieldId)
+		if !found || len(field.Index) != 1 || field.PkgPath != "" {
+			continue
+		}
+		pairs = append(pairs, convertFieldPair{colMetadata, colMetadata.FieldIndex, field.Index[0]})
+	}
+	convertPairLock.Lock()
+	convertPairCache[cacheKey] = pairs
+	convertPairLock.Unlock()
+	return pairs
+}
+
+// 读取实体字段值('sql.Null*'等'driver.Valuer'字段返回其有效值)
+func fieldDriverValue(field reflect.Value) (interface{}, bool) {
+	value := field.Interface()
+	if valuer, ok := value.(driver.Valuer); ok {
+		driverValue, err := valuer.Value()
+		if err != nil || driverValue == nil {
+			return nil, false
+		}
+		return driverValue, true
+	}
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, false
+		}
+		return field.Elem().Interface(), true
+	}
+	return value, true
+}
+
+// 设置实体字段(按策略处理空值)
+func setEntityField(field reflect.Value, colMetadata ColumnMetadata, value interface{}, policy ConvertPolicy) error {
+	if isEmptyValue(value, policy.emptyPolicyOf(colMetadata)) {
+		value = nil
+	}
+	if err := assignValue(field, value); err != nil {
+		return fmt.Errorf("convert field %s: %v", colMetadata.FieldId, err)
+	}
+	return nil
+}
+
+// 是否作为NULL处理
+func isEmptyValue(value interface{}, emptyPolicy EmptyPolicy) bool {
+	if value == nil {
+		return true
+	}
+	rftValue := reflect.ValueOf(value)
+	if rftValue.Kind() == reflect.Ptr {
+		if rftValue.IsNil() {
+			return true
+		}
+		rftValue = rftValue.Elem()
+	}
+	switch emptyPolicy {
+	case EmptyStringAsNull:
+		return rftValue.Kind() == reflect.String && rftValue.Len() == 0
+	case EmptyAsNull:
+		return rftValue.IsZero()
+	}
+	return false
+}
+
+var (
+	byteSliceType = reflect.TypeOf([]byte(nil))
+)
+
+// 将value赋值至target(支持'sql.Scanner', 数值宽度变换, JSON解码的float64等)
+func assignValue(target reflect.Value, value interface{}) error {
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	if number, ok := value.(json.Number); ok {
+		value = number.String()
+	}
+	source := reflect.ValueOf(value)
+	if source.Kind() == reflect.Ptr {
+		if source.IsNil() {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		source = source.Elem()
+		value = source.Interface()
+	}
+
+	// 'sql.Null*'等Scanner字段
+	if scanner, ok := target.Addr().Interface().(sql.Scanner); ok {
+		if source.Type() == target.Type() {
+			target.Set(source)
+			return nil
+		}
+		// 从其他'sql.Null*'变换
+		if valuer, ok := value.(driver.Valuer); ok {
+			driverValue, err := valuer.Value()
+			if err != nil {
+				return err
+			}
+			return assignValue(target, driverValue)
+		}
+		return scanner.Scan(normalizeScanValue(source))
+	}
+
+	// 指针字段
+	if target.Kind() == reflect.Ptr {
+		elem := reflect.New(target.Type().Elem())
+		if err := assignValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		target.Set(elem)
+		return nil
+	}
+
+	// 从'sql.Null*'等Valuer变换
+	if valuer, ok := value.(driver.Valuer); ok {
+		driverValue, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		return assignValue(target, driverValue)
+	}
+
+	if source.Type().AssignableTo(target.Type()) {
+		target.Set(source)
+		return nil
+	}
+	return convertBasicValue(target, source)
+}
+
+// 变换为'driver.Value'兼容的基本类型以便Scanner处理
+func normalizeScanValue(source reflect.Value) interface{} {
+	switch source.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return source.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(source.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := source.Float()
+		// JSON解码的整数值
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f)
+		}
+		return f
+	case reflect.Bool:
+		return source.Bool()
+	case reflect.String:
+		return source.String()
+	}
+	return source.Interface()
+}
+
+// 基本类型间的变换
+func convertBasicValue(target reflect.Value, source reflect.Value) error {
+	if source.Type() == byteSliceType && target.Kind() == reflect.String {
+		target.SetString(string(source.Bytes()))
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.String:
+		switch source.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			target.SetString(strconv.FormatInt(source.Int(), 10))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			target.SetString(strconv.FormatUint(source.Uint(), 10))
+		case reflect.Float32, reflect.Float64:
+			target.SetString(strconv.FormatFloat(source.Float(), 'f', -1, 64))
+		case reflect.Bool:
+			target.SetString(strconv.FormatBool(source.Bool()))
+		default:
+			if t, ok := source.Interface().(time.Time); ok {
+				target.SetString(t.Format(time.RFC3339))
+				return nil
+			}
+			target.SetString(fmt.Sprint(source.Interface()))
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch source.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = source.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if source.Uint() > math.MaxInt64 {
+				return fmt.Errorf("value %v overflows %v", source.Uint(), target.Type())
+			}
+			n = int64(source.Uint())
+		case reflect.Float32, reflect.Float64:
+			f := source.Float()
+			if f != math.Trunc(f) {
+				return fmt.Errorf("value %v is not an integer", f)
+			}
+			n = int64(f)
+		case reflect.String:
+			parsed, err := strconv.ParseInt(strings.TrimSpace(source.String()), 10, 64)
+			if err != nil {
+				return err
+			}
+			n = parsed
+		case reflect.Bool:
+			if source.Bool() {
+				n = 1
+			}
+		default:
+			return fmt.Errorf("can not convert %v to %v", source.Type(), target.Type())
+		}
+		if target.OverflowInt(n) {
+			return fmt.Errorf("value %v overflows %v", n, target.Type())
+		}
+		target.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		switch source.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if source.Int() < 0 {
+				return fmt.Errorf("value %v overflows %v", source.Int(), target.Type())
+			}
+			n = uint64(source.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = source.Uint()
+		case reflect.Float32, reflect.Float64:
+			f := source.Float()
+			if f != math.Trunc(f) || f < 0 {
+				return fmt.Errorf("value %v is not an unsigned integer", f)
+			}
+			n = uint64(f)
+		case reflect.String:
+			parsed, err := strconv.ParseUint(strings.TrimSpace(source.String()), 10, 64)
+			if err != nil {
+				return err
+			}
+			n = parsed
+		default:
+			return fmt.Errorf("can not convert %v to %v", source.Type(), target.Type())
+		}
+		if target.OverflowUint(n) {
+			return fmt.Errorf("value %v overflows %v", n, target.Type())
+		}
+		target.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch source.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(source.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(source.Uint())
+		case reflect.Float32, reflect.Float64:
+			f = source.Float()
+		case reflect.String:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(source.String()), 64)
+			if err != nil {
+				return err
+			}
+			f = parsed
+		default:
+			return fmt.Errorf("can not convert %v to %v", source.Type(), target.Type())
+		}
+		target.SetFloat(f)
+		return nil
+	case reflect.Bool:
+		switch source.Kind() {
+		case reflect.String:
+			b, err := strconv.ParseBool(strings.TrimSpace(source.String()))
+			if err != nil {
+				return err
+			}
+			target.SetBool(b)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			target.SetBool(source.Int() != 0)
+		case reflect.Float32, reflect.Float64:
+			target.SetBool(source.Float() != 0)
+		default:
+			return fmt.Errorf("can not convert %v to %v", source.Type(), target.Type())
+		}
+		return nil
+	}
+	if target.Type() == timeType && source.Kind() == reflect.String {
+		t, err := time.Parse(time.RFC3339, source.String())
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if target.Type() == byteSliceType && source.Kind() == reflect.String {
+		target.SetBytes([]byte(source.String()))
+		return nil
+	}
+	if source.Type().ConvertibleTo(target.Type()) && source.Kind() == target.Kind() {
+		target.Set(source.Convert(target.Type()))
+		return nil
+	}
+	return fmt.Errorf("can not convert %v to %v", source.Type(), target.Type())
+}
@@ -0,0 +1,425 @@
+package orm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Errors定义
+var (
+	ErrorKeyringNotSet = errors.New("encryption keyring is not set")
+	ErrorUnknownKey    = errors.New("encryption key not found in keyring")
+	ErrorInvalidCipher = errors.New("invalid encrypted column value")
+)
+
+// 加密值前缀(格式: ENC:<密钥ID>:<Base64(nonce+密文)>)
+const encryptedPrefix = "ENC:"
+
+// 配置项(<前缀>key.<密钥ID>=<Base64密钥>, <前缀>current=<当前密钥ID>)
+const KeyringConfigPrefix = "ume.orm.encrypt."
+
+// 读取配置的接口('core.PropertyConfig'满足)
+type KeyringConfig interface {
+	Get(name string) string
+	KeySet() []string
+}
+
+// 列加密密钥集合(加密使用当前密钥, 解密按密文中的密钥ID选择密钥)
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+var (
+	keyringInstance *Keyring
+	keyringLock     sync.RWMutex
+)
+
+// 创建密钥集合(keys为密钥ID:AES密钥(16/24/32字节), current为加密使用的密钥ID)
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	keyring := &Keyring{current: current, aeads: make(map[string]cipher.AEAD)}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid encryption key id: %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %v", id, err)
+		}
+		keyring.aeads[id] = aead
+	}
+	if _, exist := keyring.aeads[current]; !exist {
+		return nil, fmt.Errorf("current encryption key %q not found", current)
+	}
+	return keyring, nil
+}
+
+// 从配置创建密钥集合(只有一个密钥时可省略current)
+func LoadKeyring(cfg KeyringConfig) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	var ids []string
+	for _, name := range cfg.KeySet() {
+		if !strings.HasPrefix(name, KeyringConfigPrefix+"key.") {
+			continue
+		}
+		id := strings.TrimPrefix(name, KeyringConfigPrefix+"key.")
+		key, err := base64.StdEncoding.DecodeString(cfg.Get(name))
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %v", id, err)
+		}
+		keys[id] = key
+		ids = append(ids, id)
+	}
+	current := cfg.Get(KeyringConfigPrefix + "current")
+	if current == "" && len(ids) == 1 {
+		current = ids[0]
+	}
+	return NewKeyring(current, keys)
+}
+
+// 从配置读取并设置密钥集合(未配置密钥时不做处理)
+func ConfigureKeyring(cfg KeyringConfig) error {
+	for _, name := range cfg.KeySet() {
+		if strings.HasPrefix(name, KeyringConfigPrefix+"key.") {
+			keyring, err := LoadKeyring(cfg)
+			if err != nil {
+				return err
+			}
+			SetKeyring(keyring)
+			return nil
+		}
+	}
+	return nil
+}
+
+// 设置列加密使用的密钥集合
+func SetKeyring(keyring *Keyring) {
+	keyringLock.Lock()
+	defer keyringLock.Unlock()
+	keyringInstance = keyring
+}
+
+// 获取列加密使用的密钥集合
+func GetKeyring() *Keyring {
+	keyringLock.RLock()
+	defer keyringLock.RUnlock()
+	return keyringInstance
+}
+
+// 当前密钥ID
+func (this *Keyring) Current() string {
+	return this.current
+}
+
+// 密钥ID列表
+func (this *Keyring) KeyIds() []string {
+	ids := make([]string, 0, len(this.aeads))
+	for id := range this.aeads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// 使用当前密钥加密(aad为附加认证数据, 如"表名.列名")
+func (this *Keyring) Encrypt(plain string, aad string) (string, error) {
+	aead := this.aeads[this.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(aad))
+	return encryptedPrefix + this.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// 解密(非加密格式的值原样返回, 用于兼容加密前的数据)
+func (this *Keyring) Decrypt(value string, aad string) (string, error) {
+	id, sealed, encrypted, err := splitEncrypted(value)
+	if !encrypted || err != nil {
+		return value, err
+	}
+	aead, exist := this.aeads[id]
+	if !exist {
+		return "", fmt.Errorf("%v: %s", ErrorUnknownKey, id)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrorInvalidCipher
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(aad))
+	if err != nil {
+		return "", ErrorInvalidCipher
+	}
+	return string(plain), nil
+}
+
+// 是否需要以当前密钥重新加密(未加密或使用旧密钥)
+func (this *Keyring) NeedsRotation(value string) bool {
+	id, _, encrypted, err := splitEncrypted(value)
+	return err == nil && (!encrypted || id != this.current)
+}
+
+// 分解加密值
+func splitEncrypted(value string) (string, []byte, bool, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return "", nil, false, nil
+	}
+	rest := value[len(encryptedPrefix):]
+	i := strings.IndexByte(rest, ':')
+	if i < 0 {
+		return "", nil, true, ErrorInvalidCipher
+	}
+	sealed, err := base64.StdEncoding.DecodeString(rest[i+1:])
+	if err != nil {
+		return "", nil, true, ErrorInvalidCipher
+	}
+	return rest[:i], sealed, true, nil
+}
+
+var nullStringType = reflect.TypeOf(sql.NullString{})
+
+// 检查加密列定义(只支持字符串类型的非主键列)
+func checkEncryptedColumn(table string, colMetadata ColumnMetadata) {
+	if colMetadata.Key || colMetadata.VersionCheck {
+		panic("Key or version column can not be encrypted: " + table + "." + colMetadata.FieldId)
+	}
+	if colMetadata.FieldType != nullStringType && colMetadata.FieldType.Kind() != reflect.String {
+		panic("Encrypted column must be a string: " + table + "." + colMetadata.FieldId)
+	}
+}
+
+// 加密列的附加认证数据
+func (this EntityMetadata) encryptionAad(colMetadata ColumnMetadata) string {
+	return this.Table + "." + colMetadata.Column
+}
+
+// 构建SQL文时的参数值(加密列进行加密)
+func (this EntityMetadata) paramValue(field string, value interface{}) interface{} {
+	colMetadata := this.Columns[field]
+	if !colMetadata.Encrypted {
+		return value
+	}
+	keyring := GetKeyring()
+	if keyring == nil {
+		panic(ErrorKeyringNotSet)
+	}
+	encrypt := func(plain string) string {
+		encrypted, err := keyring.Encrypt(plain, this.encryptionAad(colMetadata))
+		if err != nil {
+			panic(err)
+		}
+		return encrypted
+	}
+	switch v := value.(type) {
+	case sql.NullString:
+		if v.Valid {
+			return sql.NullString{String: encrypt(v.String), Valid: true}
+		}
+	case string:
+		return encrypt(v)
+	}
+	return value
+}
+
+// 构建SQL文时的条件值(加密列每次加密结果不同, 不能作为条件)
+func (this EntityMetadata) conditionValue(field string, value interface{}) interface{} {
+	if this.Columns[field].Encrypted {
+		panic("Encrypted column can not be used as condition: " + this.Table + "." + field)
+	}
+	return value
+}
+
+// 解密实体的加密列(tar为实体或包含实体的复合结构体)
+func decryptEntity(tar interface{}) error {
+	if entity, ok := tar.(Entity); ok {
+		return decryptFields(entity)
+	}
+	rftType, rftValue := entityTypeValue(tar)
+	if rftType.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < rftType.NumField(); i++ {
+		field := rftValue.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		if !field.CanAddr() || !field.Addr().CanInterface() {
+			continue
+		}
+		if entity, ok := field.Addr().Interface().(Entity); ok {
+			if err := decryptFields(entity); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 解密实体的加密列
+func decryptFields(entity Entity) error {
+	entMetadata := GetEntityMetadata(entity)
+	_, rftValue := entityTypeValue(entity)
+	for _, colMetadata := range entMetadata.Columns {
+		if !colMetadata.Encrypted {
+			continue
+		}
+		field := rftValue.Field(colMetadata.FieldIndex)
+		var text *string
+		if field.Type() == nullStringType {
+			nullString := field.Addr().Interface().(*sql.NullString)
+			if !nullString.Valid {
+				continue
+			}
+			text = &nullString.String
+		} else {
+			text = field.Addr().Interface().(*string)
+		}
+		if !strings.HasPrefix(*text, encryptedPrefix) {
+			continue
+		}
+		keyring := GetKeyring()
+		if keyring == nil {
+			return ErrorKeyringNotSet
+		}
+		plain, err := keyring.Decrypt(*text, entMetadata.encryptionAad(colMetadata))
+		if err != nil {
+			return fmt.Errorf("decrypt %s.%s: %v", entMetadata.Table, colMetadata.Column, err)
+		}
+		*text = plain
+	}
+	return nil
+}
+
+// 以当前密钥重新加密实体表的加密列(包括未加密的旧数据), 返回更新件数
+func (this *Orm) RotateEncryption(ctx OrmContext, entity Entity) (int64, error) {
+	keyring := GetKeyring()
+	if keyring == nil {
+		return 0, ErrorKeyringNotSet
+	}
+	entMetadata := GetEntityMetadata(entity)
+	keys := entMetadata.KeyColumns()
+	var encrypted []ColumnMetadata
+	for _, colMetadata := range entMetadata.OrderedColumns() {
+		if colMetadata.Encrypted {
+			encrypted = append(encrypted, colMetadata)
+		}
+	}
+	if len(encrypted) == 0 {
+		return 0, nil
+	}
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("entity %s has no primary key", entMetadata.Table)
+	}
+
+	var sqlSelect bytes.Buffer
+	sqlSelect.WriteString("SELECT ")
+	for i, colMetadata := range append(append([]ColumnMetadata(nil), keys...), encrypted...) {
+		if i > 0 {
+			sqlSelect.WriteString(",")
+		}
+		sqlSelect.WriteString(colMetadata.Column)
+	}
+	sqlSelect.WriteString(" FROM ")
+	sqlSelect.WriteString(entMetadata.tableRef())
+	sqlCondition, sqlParams := entMetadata.appendTenantCondition("", nil, "")
+	if sqlCondition != "" {
+		sqlSelect.WriteString(" WHERE ")
+		sqlSelect.WriteString(sqlCondition)
+	}
+
+	// 读取全部后再更新(避免查询中执行更新)
+	rows, err := ctx.query(sqlSelect.String(), sqlParams)
+	if err != nil {
+		return 0, err
+	}
+	var records [][]interface{}
+	for rows.Next() {
+		record := make([]interface{}, len(keys)+len(encrypted))
+		scanned := make([]interface{}, len(record))
+		for i := range record {
+			scanned[i] = &record[i]
+		}
+		if err = rows.Scan(scanned...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		records = append(records, record)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, record := range records {
+		var sqlUpdate bytes.Buffer
+		var updateParams []interface{}
+		sqlUpdate.WriteString("UPDATE ")
+		sqlUpdate.WriteString(entMetadata.tableRef())
+		sqlUpdate.WriteString(" SET ")
+		for i, colMetadata := range encrypted {
+			value := record[len(keys)+i]
+			if bytesValue, ok := value.([]byte); ok {
+				value = string(bytesValue)
+			}
+			text, ok := value.(string)
+			if !ok || !keyring.NeedsRotation(text) {
+				continue
+			}
+			aad := entMetadata.encryptionAad(colMetadata)
+			plain, err := keyring.Decrypt(text, aad)
+			if err != nil {
+				return updated, fmt.Errorf("decrypt %s: %v", aad, err)
+			}
+			if text, err = keyring.Encrypt(plain, aad); err != nil {
+				return updated, err
+			}
+			if len(updateParams) > 0 {
+				sqlUpdate.WriteString(",")
+			}
+			sqlUpdate.WriteString(colMetadata.Column)
+			sqlUpdate.WriteString("=?")
+			updateParams = append(updateParams, text)
+		}
+		if len(updateParams) == 0 {
+			continue
+		}
+		sqlUpdate.WriteString(" WHERE ")
+		for i, colMetadata := range keys {
+			if i > 0 {
+				sqlUpdate.WriteString(" AND ")
+			}
+			sqlUpdate.WriteString(colMetadata.Column)
+			sqlUpdate.WriteString("=?")
+			updateParams = append(updateParams, record[i])
+		}
+		sqlText, sqlParams := sqlUpdate.String(), updateParams
+		if tenantCondition, tenantParams := entMetadata.tenantCondition(""); tenantCondition != "" {
+			sqlText += " AND " + tenantCondition
+			sqlParams = append(sqlParams, tenantParams...)
+		}
+		if _, err = ctx.exec(sqlText, sqlParams); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
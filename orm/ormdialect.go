@@ -0,0 +1,385 @@
+package orm
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Errors定义
+var (
+	ErrorLockNotSupported      = errors.New("row lock is not supported by the database dialect")
+	ErrorUpsertNotSupported    = errors.New("upsert is not supported by the database dialect")
+	ErrorProcedureNotSupported = errors.New("stored procedure is not supported by the database dialect")
+)
+
+// 行锁模式
+type LockMode int
+
+const (
+	LockNone LockMode = iota
+	LockForUpdate
+	LockForShare
+)
+
+// 行锁等待方式
+type LockWait int
+
+const (
+	LockWaitDefault LockWait = iota
+	LockNoWait
+	LockSkipLocked
+)
+
+// 加锁查询选项
+type LockOption struct {
+	Mode LockMode
+	Wait LockWait
+}
+
+// 数据库方言
+type Dialect interface {
+	// 方言名称
+	Name() string
+	// 将'?'占位符及'`'标识符引号转换为数据库格式
+	Rebind(sqlText string) string
+	// 加锁查询子句
+	LockClause(lock LockOption) (string, error)
+	// INSERT SQL文后追加的主键重复时更新子句(keys为主键列, columns为更新列)
+	UpsertClause(keys []string, columns []string) (string, error)
+	// 存储过程调用SQL文
+	ProcedureCall(procedure string, params []ProcParam) (ProcedureCall, error)
+	// INSERT SQL文后追加的返回列子句(不支持时返回空)
+	ReturningClause(columns []string) string
+	// 取得序列下一个值的SQL文
+	SequenceSql(sequence string) (string, error)
+	// 件数限制子句(limit为0时无限制)
+	LimitClause(limit int, offset int) string
+}
+
+// 已登录方言(Key为驱动名)
+var (
+	dialects = map[string]Dialect{
+		"mysql":    mysqlDialect{},
+		"postgres": postgresDialect{},
+		"pgx":      postgresDialect{},
+		"sqlite":   sqliteDialect{},
+		"sqlite3":  sqliteDialect{},
+	}
+	dialectsLock sync.RWMutex
+)
+
+// 登录方言
+func RegisterDialect(driver string, dialect Dialect) {
+	dialectsLock.Lock()
+	defer dialectsLock.Unlock()
+	dialects[driver] = dialect
+}
+
+// 根据驱动名获取方言(未登录时返回标准SQL方言)
+func GetDialect(driver string) Dialect {
+	dialectsLock.RLock()
+	defer dialectsLock.RUnlock()
+	if dialect, exist := dialects[driver]; exist {
+		return dialect
+	}
+	return standardDialect{}
+}
+
+// 标准SQL方言
+type standardDialect struct {
+}
+
+func (this standardDialect) Name() string {
+	return "standard"
+}
+
+func (this standardDialect) Rebind(sqlText string) string {
+	return sqlText
+}
+
+func (this standardDialect) LockClause(lock LockOption) (string, error) {
+	return standardLockClause(lock, "FOR SHARE")
+}
+
+func (this standardDialect) UpsertClause(keys []string, columns []string) (string, error) {
+	return "", ErrorUpsertNotSupported
+}
+
+// 标准SQL无法取得OUT参数值, 只支持IN参数
+func (this standardDialect) ProcedureCall(procedure string, params []ProcParam) (ProcedureCall, error) {
+	for _, param := range params {
+		if param.Mode != ParamIn {
+			return ProcedureCall{}, ErrorProcedureNotSupported
+		}
+	}
+	return callArgumentList(procedure, params), nil
+}
+
+func (this standardDialect) ReturningClause(columns []string) string {
+	return ""
+}
+
+func (this standardDialect) SequenceSql(sequence string) (string, error) {
+	return "SELECT NEXT VALUE FOR " + sequence, nil
+}
+
+func (this standardDialect) LimitClause(limit int, offset int) string {
+	clause := "OFFSET " + strconv.Itoa(offset) + " ROWS"
+	if limit > 0 {
+		clause += " FETCH FIRST " + strconv.Itoa(limit) + " ROWS ONLY"
+	}
+	return clause
+}
+
+// MySQL方言
+type mysqlDialect struct {
+}
+
+func (this mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (this mysqlDialect) Rebind(sqlText string) string {
+	return sqlText
+}
+
+func (this mysqlDialect) LockClause(lock LockOption) (string, error) {
+	if lock.Mode == LockForShare && lock.Wait == LockWaitDefault {
+		// MySQL 5.7以前不支持'FOR SHARE'
+		return "LOCK IN SHARE MODE", nil
+	}
+	return standardLockClause(lock, "FOR SHARE")
+}
+
+func (this mysqlDialect) UpsertClause(keys []string, columns []string) (string, error) {
+	if len(columns) == 0 {
+		// 无更新列时保持原记录
+		return "ON DUPLICATE KEY UPDATE " + keys[0] + "=" + keys[0], nil
+	}
+	assigns := make([]string, len(columns))
+	for i, column := range columns {
+		assigns[i] = column + "=VALUES(" + column + ")"
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(assigns, ","), nil
+}
+
+// OUT参数通过会话变量('@_p1'等)传递, 调用后以SELECT取得
+func (this mysqlDialect) ProcedureCall(procedure string, params []ProcParam) (ProcedureCall, error) {
+	var call ProcedureCall
+	var args, prepares, outs []string
+	for i, param := range params {
+		if param.Mode == ParamIn {
+			args = append(args, "?")
+			call.CallParams = append(call.CallParams, param.Value)
+			continue
+		}
+		variable := "@_p" + strconv.Itoa(i+1)
+		args = append(args, variable)
+		outs = append(outs, variable)
+		if param.Mode == ParamInOut {
+			prepares = append(prepares, variable+"=?")
+			call.PrepareParams = append(call.PrepareParams, param.Value)
+		}
+	}
+	if len(prepares) > 0 {
+		call.Prepare = "SET " + strings.Join(prepares, ",")
+	}
+	call.Call = "CALL " + procedure + "(" + strings.Join(args, ",") + ")"
+	if len(outs) > 0 {
+		call.Out = "SELECT " + strings.Join(outs, ",")
+	}
+	return call, nil
+}
+
+func (this mysqlDialect) ReturningClause(columns []string) string {
+	return ""
+}
+
+func (this mysqlDialect) SequenceSql(sequence string) (string, error) {
+	return "", ErrorSequenceNotSupported
+}
+
+func (this mysqlDialect) LimitClause(limit int, offset int) string {
+	return limitOffsetClause(limit, offset)
+}
+
+// PostgreSQL方言
+type postgresDialect struct {
+}
+
+func (this postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (this postgresDialect) Rebind(sqlText string) string {
+	return rebindNumbered(sqlText, "$", '"')
+}
+
+func (this postgresDialect) LockClause(lock LockOption) (string, error) {
+	return standardLockClause(lock, "FOR SHARE")
+}
+
+func (this postgresDialect) UpsertClause(keys []string, columns []string) (string, error) {
+	return onConflictClause(keys, columns)
+}
+
+// OUT参数传入NULL, OUT参数值作为CALL的结果集返回
+func (this postgresDialect) ProcedureCall(procedure string, params []ProcParam) (ProcedureCall, error) {
+	return callArgumentList(procedure, params), nil
+}
+
+func (this postgresDialect) ReturningClause(columns []string) string {
+	return "RETURNING " + strings.Join(columns, ",")
+}
+
+func (this postgresDialect) SequenceSql(sequence string) (string, error) {
+	return "SELECT nextval('" + sequence + "')", nil
+}
+
+func (this postgresDialect) LimitClause(limit int, offset int) string {
+	return limitOffsetClause(limit, offset)
+}
+
+// SQLite方言(不支持行锁)
+type sqliteDialect struct {
+}
+
+func (this sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (this sqliteDialect) Rebind(sqlText string) string {
+	return sqlText
+}
+
+func (this sqliteDialect) LockClause(lock LockOption) (string, error) {
+	if lock.Mode == LockNone {
+		return "", nil
+	}
+	return "", ErrorLockNotSupported
+}
+
+func (this sqliteDialect) UpsertClause(keys []string, columns []string) (string, error) {
+	return onConflictClause(keys, columns)
+}
+
+func (this sqliteDialect) ProcedureCall(procedure string, params []ProcParam) (ProcedureCall, error) {
+	return ProcedureCall{}, ErrorProcedureNotSupported
+}
+
+// SQLite 3.35以后支持RETURNING
+func (this sqliteDialect) ReturningClause(columns []string) string {
+	return "RETURNING " + strings.Join(columns, ",")
+}
+
+func (this sqliteDialect) SequenceSql(sequence string) (string, error) {
+	return "", ErrorSequenceNotSupported
+}
+
+func (this sqliteDialect) LimitClause(limit int, offset int) string {
+	return limitOffsetClause(limit, offset)
+}
+
+// 'CALL procedure(?,...)'形式的调用(OUT参数传入NULL)
+func callArgumentList(procedure string, params []ProcParam) ProcedureCall {
+	var call ProcedureCall
+	args := make([]string, len(params))
+	for i, param := range params {
+		args[i] = "?"
+		if param.Mode == ParamOut {
+			call.CallParams = append(call.CallParams, nil)
+		} else {
+			call.CallParams = append(call.CallParams, param.Value)
+		}
+	}
+	call.Call = "CALL " + procedure + "(" + strings.Join(args, ",") + ")"
+	return call
+}
+
+// 'LIMIT n OFFSET m'形式的件数限制子句(MySQL, PostgreSQL, SQLite)
+func limitOffsetClause(limit int, offset int) string {
+	if limit <= 0 {
+		// 无限制时指定最大值
+		limit = math.MaxInt32
+	}
+	clause := "LIMIT " + strconv.Itoa(limit)
+	if offset > 0 {
+		clause += " OFFSET " + strconv.Itoa(offset)
+	}
+	return clause
+}
+
+// 'ON CONFLICT'形式的主键重复时更新子句(PostgreSQL, SQLite)
+func onConflictClause(keys []string, columns []string) (string, error) {
+	if len(keys) == 0 {
+		return "", ErrorUpsertNotSupported
+	}
+	clause := "ON CONFLICT(" + strings.Join(keys, ",") + ")"
+	if len(columns) == 0 {
+		return clause + " DO NOTHING", nil
+	}
+	assigns := make([]string, len(columns))
+	for i, column := range columns {
+		assigns[i] = column + "=excluded." + column
+	}
+	return clause + " DO UPDATE SET " + strings.Join(assigns, ","), nil
+}
+
+// 标准加锁子句
+func standardLockClause(lock LockOption, forShare string) (string, error) {
+	var clause string
+	switch lock.Mode {
+	case LockNone:
+		return "", nil
+	case LockForUpdate:
+		clause = "FOR UPDATE"
+	case LockForShare:
+		clause = forShare
+	default:
+		return "", ErrorLockNotSupported
+	}
+	switch lock.Wait {
+	case LockNoWait:
+		clause += " NOWAIT"
+	case LockSkipLocked:
+		clause += " SKIP LOCKED"
+	}
+	return clause, nil
+}
+
+// 将'?'占位符转换为带序号的占位符(如'$1'), '`'转换为identQuote, 忽略引号中的内容
+func rebindNumbered(sqlText string, prefix string, identQuote byte) string {
+	if strings.IndexAny(sqlText, "?`") < 0 {
+		return sqlText
+	}
+	var builder strings.Builder
+	var quote byte
+	n := 0
+	for i := 0; i < len(sqlText); i++ {
+		c := sqlText[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				if c == '`' {
+					c = identQuote
+				}
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '`':
+			quote = c
+			c = identQuote
+		case c == '?':
+			n++
+			builder.WriteString(prefix)
+			builder.WriteString(strconv.Itoa(n))
+			continue
+		}
+		builder.WriteByte(c)
+	}
+	return builder.String()
+}
@@ -0,0 +1,227 @@
+package orm
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// 表关联方式
+type JoinType string
+
+const (
+	JoinInner JoinType = "INNER JOIN"
+	JoinLeft  JoinType = "LEFT JOIN"
+)
+
+// 关联条件
+// Field为已加入实体的字段("前缀.字段名", 主实体可省略前缀), JoinField为被关联实体的字段名
+type JoinCondition struct {
+	Field     string
+	JoinField string
+}
+
+// 多表关联查询定义
+// 各实体的列以"前缀.字段名"作为别名输出, 前缀默认为实体结构体名,
+// 结果可映射至嵌入(或以前缀命名嵌套)各实体结构体的复合结构体
+type JoinQuery struct {
+	tables []*joinTable
+}
+
+// 关联查询中的单表定义
+type joinTable struct {
+	entity   Entity
+	metadata EntityMetadata
+	prefix   string
+	alias    string
+	joinType JoinType
+	on       []JoinCondition
+}
+
+// 以主实体创建关联查询(主实体中非空字段作为查询条件, 以下同)
+func NewJoinQuery(entity Entity, prefix string) *JoinQuery {
+	query := &JoinQuery{}
+	query.addTable("", entity, prefix, nil)
+	return query
+}
+
+// 内关联(fields为已加入实体的字段, 按顺序对应被关联实体的主键)
+func (this *JoinQuery) InnerJoin(entity Entity, prefix string, fields ...string) *JoinQuery {
+	return this.Join(JoinInner, entity, prefix, keyJoinConditions(entity, fields)...)
+}
+
+// 左外关联(fields为已加入实体的字段, 按顺序对应被关联实体的主键)
+func (this *JoinQuery) LeftJoin(entity Entity, prefix string, fields ...string) *JoinQuery {
+	return this.Join(JoinLeft, entity, prefix, keyJoinConditions(entity, fields)...)
+}
+
+// 按指定条件关联
+func (this *JoinQuery) Join(joinType JoinType, entity Entity, prefix string, on ...JoinCondition) *JoinQuery {
+	if len(on) == 0 {
+		panic("Join condition can not be empty.")
+	}
+	this.addTable(joinType, entity, prefix, on)
+	return this
+}
+
+func (this *JoinQuery) addTable(joinType JoinType, entity Entity, prefix string, on []JoinCondition) {
+	if prefix == "" {
+		prefix = entityTypeName(entity)
+	}
+	table := &joinTable{
+		entity:   entity,
+		metadata: GetEntityMetadata(entity),
+		prefix:   prefix,
+		alias:    "T" + strconv.Itoa(len(this.tables)),
+		joinType: joinType,
+		on:       on,
+	}
+	if this.findTable(prefix) != nil {
+		panic("Duplicated join prefix: " + prefix)
+	}
+	// 关联条件只能引用已加入的实体
+	for _, condition := range on {
+		this.mustColumn(condition.Field)
+		table.metadata.mustColumn(condition.JoinField)
+	}
+	this.tables = append(this.tables, table)
+}
+
+func (this *JoinQuery) findTable(prefix string) *joinTable {
+	for _, table := range this.tables {
+		if table.prefix == prefix {
+			return table
+		}
+	}
+	return nil
+}
+
+// 解析"前缀.字段名"获得"表别名.列名"
+func (this *JoinQuery) mustColumn(name string) string {
+	table := this.tables[0]
+	field := name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		table = this.findTable(name[:i])
+		field = name[i+1:]
+		if table == nil {
+			panic("Unknown join prefix: " + name[:i])
+		}
+	}
+	return table.alias + "." + table.metadata.mustColumn(field).Column
+}
+
+// 尝试解析排序字段, 无法解析时原样返回
+func (this *JoinQuery) orderColumn(name string) string {
+	table := this.tables[0]
+	field := name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		if table = this.findTable(name[:i]); table == nil {
+			return name
+		}
+		field = name[i+1:]
+	}
+	if colMetadata, exist := table.metadata.Columns[field]; exist {
+		return table.alias + "." + colMetadata.Column
+	}
+	return name
+}
+
+// 构建关联查询SELECT SQL文
+func (this *Orm) BuildSqlJoin(query *JoinQuery, orderByList []OrderByCondition) (string, []interface{}) {
+	var sql bytes.Buffer
+	var sqlCondition bytes.Buffer
+	var sqlParamList []interface{}
+	// ON子句中的参数(位于WHERE条件之前)
+	var onParamList []interface{}
+
+	sql.WriteString("SELECT ")
+	for i, table := range query.tables {
+		for j, colMetadata := range table.metadata.OrderedColumns() {
+			if i > 0 || j > 0 {
+				sql.WriteString(",")
+			}
+			sql.WriteString(table.alias)
+			sql.WriteString(".")
+			sql.WriteString(colMetadata.Column)
+			sql.WriteString(" AS `")
+			sql.WriteString(table.prefix)
+			sql.WriteString(".")
+			sql.WriteString(colMetadata.FieldId)
+			sql.WriteString("`")
+		}
+	}
+
+	for i, table := range query.tables {
+		if i == 0 {
+			sql.WriteString(" FROM ")
+		} else {
+			sql.WriteString(" ")
+			sql.WriteString(string(table.joinType))
+			sql.WriteString(" ")
+		}
+		sql.WriteString(table.metadata.tableRef())
+		sql.WriteString(" ")
+		sql.WriteString(table.alias)
+		for j, condition := range table.on {
+			if j == 0 {
+				sql.WriteString(" ON ")
+			} else {
+				sql.WriteString(" AND ")
+			}
+			sql.WriteString(table.alias)
+			sql.WriteString(".")
+			sql.WriteString(table.metadata.mustColumn(condition.JoinField).Column)
+			sql.WriteString("=")
+			sql.WriteString(query.mustColumn(condition.Field))
+		}
+
+		condition, params := this.buildSqlCondition(table.metadata, table.entity, table.alias+".")
+		if i == 0 {
+			condition, params = table.metadata.appendTenantCondition(condition, params, table.alias+".")
+		} else if tenantCondition, tenantParams := table.metadata.tenantCondition(table.alias + "."); tenantCondition != "" {
+			// 被关联表的租户条件置于ON子句(外连接时保留未关联的行)
+			sql.WriteString(" AND ")
+			sql.WriteString(tenantCondition)
+			onParamList = append(onParamList, tenantParams...)
+		}
+		if condition != "" {
+			if sqlCondition.Len() > 0 {
+				sqlCondition.WriteString(" AND ")
+			}
+			sqlCondition.WriteString(condition)
+			sqlParamList = append(sqlParamList, params...)
+		}
+	}
+
+	if sqlCondition.Len() > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(sqlCondition.String())
+	}
+	if len(orderByList) > 0 {
+		resolved := make([]OrderByCondition, len(orderByList))
+		for i, orderBy := range orderByList {
+			resolved[i] = OrderByCondition{query.orderColumn(orderBy.Name), orderBy.DESC}
+		}
+		writeSqlOrderBy(&sql, resolved)
+	}
+	return sql.String(), append(onParamList, sqlParamList...)
+}
+
+// 根据被关联实体主键生成关联条件
+func keyJoinConditions(entity Entity, fields []string) []JoinCondition {
+	keys := GetEntityMetadata(entity).KeyColumns()
+	if len(keys) == 0 || len(keys) != len(fields) {
+		panic("Join fields must match primary key of " + entity.TableName())
+	}
+	conditions := make([]JoinCondition, len(keys))
+	for i, key := range keys {
+		conditions[i] = JoinCondition{fields[i], key.FieldId}
+	}
+	return conditions
+}
+
+// 实体结构体名
+func entityTypeName(entity Entity) string {
+	t, _ := entityTypeValue(entity)
+	return t.Name()
+}
@@ -0,0 +1,281 @@
+package orm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors定义
+var (
+	ErrorSequenceNotSupported = errors.New("sequence is not supported by the database dialect")
+	ErrorInvalidSnowflakeNode = errors.New("snowflake node id must be between 0 and 1023")
+)
+
+// 主键生成方式('generate'标签值, 序列为'generate:"sequence:序列名"')
+const (
+	// 数据库自增列(插入后取得)
+	KeyAuto = "auto"
+	// UUID版本7(时间有序的文本)
+	KeyUUID = "uuid"
+	// Snowflake形式的int64(时间41位, 节点10位, 序号12位)
+	KeySnowflake = "snowflake"
+	// 数据库序列(插入前取得)
+	KeySequence = "sequence"
+)
+
+// 插入实体(主键为空时按生成方式生成并设置至实体), 返回插入的主键值(非整数主键时为0)
+// 自增主键在支持RETURNING的数据库中以RETURNING取得, 否则使用'LastInsertId'
+func (this *Orm) InsertEntity(ctx OrmContext, entity Entity) int64 {
+	entMetadata := GetEntityMetadata(entity)
+	_, rftValue := entityTypeValue(entity)
+	// 生成UUID, Snowflake主键
+	entMetadata.generateKeys(rftValue)
+	if err := this.generateSequenceKeys(ctx, entMetadata, rftValue); err != nil {
+		panic(err)
+	}
+	autoColumn, hasAuto := entMetadata.emptyAutoKey(rftValue)
+	sqlText, sqlParams := this.BuildSqlInsert(entity)
+	if !hasAuto {
+		ormResult, err := this.Exec(ctx, sqlText, sqlParams...)
+		if err != nil {
+			panic(err)
+		}
+		if id, found := entMetadata.integerKey(rftValue); found {
+			return id
+		}
+		// PostgreSQL等不支持'LastInsertId'的驱动返回0
+		id, _ := ormResult.LastInsertId()
+		return id
+	}
+
+	var id int64
+	if returning := ctx.Dialect().ReturningClause([]string{autoColumn.Column}); returning != "" {
+		this.Aggregate(ctx, &id, sqlText+" "+returning, sqlParams...)
+		ctx.invalidate(entMetadata.Table)
+	} else {
+		id = this.Insert(ctx, sqlText, sqlParams...)
+	}
+	setGeneratedKey(rftValue.Field(autoColumn.FieldIndex), autoColumn, id)
+	return id
+}
+
+// 生成插入前可生成的主键(UUID, Snowflake)
+func (this EntityMetadata) generateKeys(rftValue reflect.Value) {
+	for _, colMetadata := range this.KeyColumns() {
+		field := rftValue.Field(colMetadata.FieldIndex)
+		if !isEmptyKey(field) {
+			continue
+		}
+		switch colMetadata.Generate {
+		case KeyUUID:
+			setGeneratedKey(field, colMetadata, NewUUIDv7())
+		case KeySnowflake:
+			setGeneratedKey(field, colMetadata, NextSnowflakeId())
+		}
+	}
+}
+
+// 取得值为空的序列主键的序列值
+func (this *Orm) generateSequenceKeys(ctx OrmContext, entMetadata EntityMetadata, rftValue reflect.Value) error {
+	for _, colMetadata := range entMetadata.KeyColumns() {
+		if colMetadata.Generate != KeySequence || !isEmptyKey(rftValue.Field(colMetadata.FieldIndex)) {
+			continue
+		}
+		sequenceSql, err := ctx.Dialect().SequenceSql(colMetadata.Sequence)
+		if err != nil {
+			return err
+		}
+		rows, err := ctx.query(sequenceSql, nil)
+		if err != nil {
+			return err
+		}
+		var next int64
+		if rows.Next() {
+			err = rows.Scan(&next)
+		} else if err = rows.Err(); err == nil {
+			err = ErrorRecordNotFound
+		}
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		setGeneratedKey(rftValue.Field(colMetadata.FieldIndex), colMetadata, next)
+	}
+	return nil
+}
+
+// 值为空的自增主键列
+func (this EntityMetadata) emptyAutoKey(rftValue reflect.Value) (ColumnMetadata, bool) {
+	for _, colMetadata := range this.KeyColumns() {
+		if colMetadata.Generate == KeyAuto && isEmptyKey(rftValue.Field(colMetadata.FieldIndex)) {
+			return colMetadata, true
+		}
+	}
+	return ColumnMetadata{}, false
+}
+
+// 单一整数主键的值
+func (this EntityMetadata) integerKey(rftValue reflect.Value) (int64, bool) {
+	keys := this.KeyColumns()
+	if len(keys) != 1 {
+		return 0, false
+	}
+	value, valid := fieldDriverValue(rftValue.Field(keys[0].FieldIndex))
+	if !valid {
+		return 0, false
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+// 主键字段是否为空(NULL或零值)
+func isEmptyKey(field reflect.Value) bool {
+	value, valid := fieldDriverValue(field)
+	return !valid || reflect.ValueOf(value).IsZero()
+}
+
+// 设置生成的主键
+func setGeneratedKey(field reflect.Value, colMetadata ColumnMetadata, value interface{}) {
+	if err := assignValue(field, value); err != nil {
+		panic(fmt.Errorf("generated key %s: %v", colMetadata.FieldId, err))
+	}
+}
+
+// 解析'generate'标签值
+func parseGenerate(table string, colMetadata *ColumnMetadata, value string) {
+	strategy, sequence := value, ""
+	if i := strings.Index(value, ":"); i >= 0 {
+		strategy, sequence = value[:i], strings.TrimSpace(value[i+1:])
+	}
+	switch strategy {
+	case KeyAuto, KeyUUID, KeySnowflake:
+	case KeySequence:
+		if sequence == "" {
+			panic(fmt.Sprintf("sequence name is required: %s.%s", table, colMetadata.Column))
+		}
+	default:
+		panic(fmt.Sprintf("unknown key generation strategy %q: %s.%s", value, table, colMetadata.Column))
+	}
+	colMetadata.Generate = strategy
+	colMetadata.Sequence = sequence
+}
+
+// UUID版本7的最后时间及计数(同一毫秒内以rand_a的12位作为计数保证递增)
+var (
+	uuidLock     sync.Mutex
+	uuidLastTime uint64
+	uuidCounter  uint16
+)
+
+// 生成UUID版本7(前48位为毫秒时间戳, 同一进程内递增)
+func NewUUIDv7() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[6:]); err != nil {
+		panic(err)
+	}
+	uuidLock.Lock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms <= uuidLastTime {
+		ms = uuidLastTime
+		uuidCounter++
+		if uuidCounter > 0xfff {
+			// 计数用尽时借用下一毫秒
+			ms++
+			uuidCounter = 0
+		}
+	} else {
+		uuidCounter = uint16(uuid[6]&0x07)<<8 | uint16(uuid[7])
+	}
+	uuidLastTime = ms
+	counter := uuidCounter
+	uuidLock.Unlock()
+
+	for i := 0; i < 6; i++ {
+		uuid[i] = byte(ms >> uint(40-8*i))
+	}
+	uuid[6] = 0x70 | byte(counter>>8)
+	uuid[7] = byte(counter)
+	uuid[8] = uuid[8]&0x3f | 0x80
+	text := hex.EncodeToString(uuid[:])
+	return text[0:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:]
+}
+
+// Snowflake的起始时间(2020-01-01 UTC)
+const snowflakeEpoch int64 = 1577836800000
+
+// Snowflake形式的ID生成器
+type Snowflake struct {
+	lock     sync.Mutex
+	node     int64
+	lastTime int64
+	sequence int64
+}
+
+// 创建Snowflake生成器(node为0~1023)
+func NewSnowflake(node int64) (*Snowflake, error) {
+	if node < 0 || node > 1023 {
+		return nil, ErrorInvalidSnowflakeNode
+	}
+	return &Snowflake{node: node}, nil
+}
+
+// 生成下一个ID(时钟回拨时沿用最后的时间)
+func (this *Snowflake) Next() int64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	now := time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+	if now < this.lastTime {
+		now = this.lastTime
+	}
+	if now == this.lastTime {
+		this.sequence = (this.sequence + 1) & 0xfff
+		if this.sequence == 0 {
+			// 同一毫秒的序号用尽时等待下一毫秒
+			for now <= this.lastTime {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+			}
+		}
+	} else {
+		this.sequence = 0
+	}
+	this.lastTime = now
+	return now<<22 | this.node<<12 | this.sequence
+}
+
+// 默认Snowflake生成器
+var (
+	snowflakeInstance, _ = NewSnowflake(0)
+	snowflakeLock        sync.RWMutex
+)
+
+// 设置默认Snowflake生成器的节点ID(各进程须使用不同的节点ID)
+func SetSnowflakeNode(node int64) error {
+	snowflake, err := NewSnowflake(node)
+	if err != nil {
+		return err
+	}
+	snowflakeLock.Lock()
+	defer snowflakeLock.Unlock()
+	snowflakeInstance = snowflake
+	return nil
+}
+
+// 使用默认Snowflake生成器生成ID
+func NextSnowflakeId() int64 {
+	snowflakeLock.RLock()
+	snowflake := snowflakeInstance
+	snowflakeLock.RUnlock()
+	return snowflake.Next()
+}
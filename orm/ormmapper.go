@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"strings"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 )
 
 //
@@ -22,11 +25,18 @@ type callbackMapper struct {
 type ormTypeInfo struct {
 	t reflect.Type
 	fields []reflect.StructField
-	fieldMap map[string]*reflect.StructField
+	fieldMap map[string]*ormFieldInfo
+}
+type ormFieldInfo struct {
+	index []int
+	t reflect.Type
 }
 type defaultStructMapper struct {
 	typeInfo *ormTypeInfo
 }
+type defaultMapMapper struct {
+	t reflect.Type
+}
 
 
 // Cached  OrmMapper instance
@@ -35,8 +45,16 @@ var (
 )
 var (
 	typeInfoMap = make(map[reflect.Type]*ormTypeInfo)
+	typeInfoLock sync.RWMutex
+)
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType = reflect.TypeOf(time.Time{})
 )
 
+// Max depth of nested struct mapping
+const maxNestedDepth = 4
+
 func (this callbackMapper) Mapping(row *sql.Rows, result interface{}) error {
 	return this.callback(row, result)
 }
@@ -68,15 +86,21 @@ func newDefaultOrmMapper(t reflect.Type) OrmMapper {
 	if t.Kind() == reflect.Struct {
 		// Retrieve type info
 		// (Use a caching map to reduce reflect operations)
+		typeInfoLock.RLock()
 		typeInfoPtr, found := typeInfoMap[t]
+		typeInfoLock.RUnlock()
 		if !found {
 			typeInfo := newOrmTypeInfo(t)
 			typeInfoPtr = &typeInfo
+			typeInfoLock.Lock()
 			typeInfoMap[t] = typeInfoPtr
+			typeInfoLock.Unlock()
 		}
 
 		// Create Mapper
 		mapper = defaultStructMapper{typeInfoPtr}
+	} else if t.Kind() == reflect.Map && t.Key().Kind() == reflect.String {
+		mapper = defaultMapMapper{t}
 	} else {
 		mapper = defaultSimpleMapper{t}
 	}
@@ -89,6 +113,53 @@ func (this defaultSimpleMapper) Mapping(row *sql.Rows, result interface{}) error
 	return err
 }
 
+// Mapping each column into a map keyed by column name (alias)
+func (this defaultMapMapper) Mapping(row *sql.Rows, result interface{}) error {
+	columnNames, err := row.Columns()
+	if err != nil {
+		return err
+	}
+	columnValues := make([]interface{}, len(columnNames))
+	columnMappings := make([]interface{}, len(columnNames))
+	for i := range columnValues {
+		columnMappings[i] = &columnValues[i]
+	}
+	if err = row.Scan(columnMappings...); err != nil {
+		return err
+	}
+
+	resultElem := reflect.ValueOf(result).Elem()
+	if resultElem.IsNil() {
+		resultElem.Set(reflect.MakeMapWithSize(this.t, len(columnNames)))
+	}
+	elemType := this.t.Elem()
+	for i, columnName := range columnNames {
+		value := columnValues[i]
+		// Drivers return text columns as []byte
+		if bytesValue, ok := value.([]byte); ok {
+			value = string(bytesValue)
+		}
+		var mapValue reflect.Value
+		if value == nil {
+			mapValue = reflect.Zero(elemType)
+		} else {
+			mapValue = reflect.ValueOf(value)
+			if elemType.Kind() == reflect.String && mapValue.Kind() != reflect.String {
+				// Avoid integer to rune conversion
+				mapValue = reflect.ValueOf(fmt.Sprint(value))
+			}
+			if !mapValue.Type().AssignableTo(elemType) {
+				if !mapValue.Type().ConvertibleTo(elemType) {
+					return errors.New("can not convert column " + columnName + " to " + elemType.String())
+				}
+				mapValue = mapValue.Convert(elemType)
+			}
+		}
+		resultElem.SetMapIndex(reflect.ValueOf(columnName).Convert(this.t.Key()), mapValue)
+	}
+	return nil
+}
+
 func normalizeFieldName(fieldName string) string {
 	return strings.ToUpper(fieldName)
 }
@@ -101,19 +172,72 @@ func newOrmTypeInfo(t reflect.Type) ormTypeInfo {
 	if t.Kind() == reflect.Struct {
 		fieldCount := t.NumField()
 		typeInfo.fields = make([]reflect.StructField, 0, fieldCount)
-		typeInfo.fieldMap = make(map[string]*reflect.StructField)
+		typeInfo.fieldMap = make(map[string]*ormFieldInfo)
 		for i := 0; i < fieldCount; i++ {
-			fieldInfo := t.Field(i)
-			typeInfo.fields = append(typeInfo.fields, fieldInfo)
-			typeInfo.fieldMap[normalizeFieldName(fieldInfo.Name)] = &fieldInfo
+			typeInfo.fields = append(typeInfo.fields, t.Field(i))
 		}
+		typeInfo.addFields(t, "", nil, 0)
 	}
 
 	// Exit
 	return typeInfo
 }
 
-// A simple mapper only matching with column names
+// Register fields of t (and its embedded/nested structs) into field map.
+// Nested fields are registered as "PREFIX.FIELD", fields of embedded structs are
+// also promoted to the outer level unless shadowed by an outer field.
+func (this *ormTypeInfo) addFields(t reflect.Type, prefix string, index []int, depth int) {
+	var nested []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		fieldInfo := t.Field(i)
+		if fieldInfo.PkgPath != "" && !fieldInfo.Anonymous {
+			continue
+		}
+		fieldIndex := append(append(make([]int, 0, len(index)+1), index...), i)
+		name := prefix + normalizeFieldName(fieldInfo.Name)
+		if fieldInfo.PkgPath == "" {
+			this.putField(name, &ormFieldInfo{fieldIndex, fieldInfo.Type})
+		}
+		if isNestedStructType(fieldInfo.Type) && depth < maxNestedDepth {
+			fieldInfo.Index = fieldIndex
+			nested = append(nested, fieldInfo)
+		}
+	}
+	for _, fieldInfo := range nested {
+		structType := fieldInfo.Type
+		if structType.Kind() == reflect.Ptr {
+			structType = structType.Elem()
+		}
+		this.addFields(structType, prefix+normalizeFieldName(fieldInfo.Name)+".", fieldInfo.Index, depth+1)
+		if fieldInfo.Anonymous {
+			this.addFields(structType, prefix, fieldInfo.Index, depth+1)
+		}
+	}
+}
+
+func (this *ormTypeInfo) putField(name string, fieldInfo *ormFieldInfo) {
+	if exist, found := this.fieldMap[name]; found && len(exist.index) <= len(fieldInfo.index) {
+		return
+	}
+	this.fieldMap[name] = fieldInfo
+}
+
+// Struct types mapped column by column (sql.Null*, time.Time are mapped as a whole)
+func isNestedStructType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	if reflect.PtrTo(t).Implements(scannerType) || t == timeType {
+		return false
+	}
+	return true
+}
+
+// A simple mapper matching with column names
+// (use "PREFIX.FIELD" column alias to fill embedded or nested struct fields)
 func (self defaultStructMapper) Mapping(row *sql.Rows, result interface{}) error {
 	var err error = nil
 	var columnNames []string
@@ -122,7 +246,7 @@ func (self defaultStructMapper) Mapping(row *sql.Rows, result interface{}) error
 		return err
 	}
 	columnCount := len(columnNames)
-	fieldInfos := make([]*reflect.StructField, 0, columnCount)
+	fieldInfos := make([]*ormFieldInfo, 0, columnCount)
 	columnMappings := make([]interface{}, 0, columnCount)
 	for i := 0; i < columnCount; i++ {
 		columnName := columnNames[i]
@@ -133,7 +257,8 @@ func (self defaultStructMapper) Mapping(row *sql.Rows, result interface{}) error
 		fieldInfos = append(fieldInfos, fieldInfo)
 
 		// Create object to store column value
-		fieldValue := reflect.New(fieldInfo.Type)
+		// (use a pointer so that NULL values can be scanned for any field type)
+		fieldValue := reflect.New(reflect.PtrTo(fieldInfo.t))
 		columnMappings = append(columnMappings, fieldValue.Interface())
 	}
 
@@ -146,22 +271,38 @@ func (self defaultStructMapper) Mapping(row *sql.Rows, result interface{}) error
 	resultElem := reflect.ValueOf(result).Elem()
 	for i := 0; i < columnCount; i++ {
 		fieldInfo := fieldInfos[i]
-		columnMapping := columnMappings[i]
-		fieldValue := reflect.ValueOf(columnMapping).Elem()
-		//fmt.Println(fieldValue)
-		resultElem.Field(fieldInfo.Index[0]).Set(fieldValue)
+		fieldValue := reflect.ValueOf(columnMappings[i]).Elem()
+		if fieldValue.IsNil() {
+			// NULL value, e.g. columns of an outer joined table
+			continue
+		}
+		fieldByIndex(resultElem, fieldInfo.index).Set(fieldValue.Elem())
 	}
 
 	// Exit
 	return err
 }
 
-func (self *defaultStructMapper) findFieldInfo(columnName string) *reflect.StructField {
-	var fieldInfo *reflect.StructField = nil
+func (self *defaultStructMapper) findFieldInfo(columnName string) *ormFieldInfo {
+	var fieldInfo *ormFieldInfo = nil
 	var found bool
 	fieldInfo, found = self.typeInfo.fieldMap[normalizeFieldName(columnName)]
 	if !found {
 		fieldInfo = nil
 	}
 	return fieldInfo
-}
\ No newline at end of file
+}
+
+// Get field by index path, allocating nil struct pointers on the way
+func fieldByIndex(value reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		value = value.Field(x)
+	}
+	return value
+}
@@ -0,0 +1,194 @@
+package orm
+
+import (
+	"database/sql"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// 掩码方式('mask'标签值)
+const (
+	// 全部掩码
+	MaskFull = "full"
+	// 保留首字符(姓名等)
+	MaskName = "name"
+	// 保留首尾字符
+	MaskMiddle = "middle"
+	// 保留末尾4字符(电话号码, 卡号等)
+	MaskLast4 = "last4"
+	// 保留账户首字符及域名(邮件地址)
+	MaskEmail = "email"
+)
+
+// 掩码字符
+const maskChar = "*"
+
+// 掩码处理函数
+type MaskFunc func(value string) string
+
+var (
+	maskFuncs = map[string]MaskFunc{
+		MaskFull:   maskFull,
+		MaskName:   func(value string) string { return maskKeep(value, 1, 0) },
+		MaskMiddle: func(value string) string { return maskKeep(value, 1, 1) },
+		MaskLast4:  func(value string) string { return maskKeep(value, 0, 4) },
+		MaskEmail:  maskEmail,
+	}
+	maskFuncLock sync.RWMutex
+	// 输出掩码标志(默认停用)
+	maskingEnabled int32
+)
+
+// 配置项(true时httpd输出实体前进行掩码处理)
+const MaskingConfigKey = "ume.orm.mask.enabled"
+
+
+// 登录掩码方式
+func RegisterMask(name string, fn MaskFunc) {
+	maskFuncLock.Lock()
+	defer maskFuncLock.Unlock()
+	maskFuncs[name] = fn
+}
+
+// 启用/停用输出掩码(只影响httpd等输出边界, 实体及DTO变换始终保持原值)
+func SetMaskingEnabled(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&maskingEnabled, 1)
+	} else {
+		atomic.StoreInt32(&maskingEnabled, 0)
+	}
+}
+
+// 是否启用输出掩码
+func MaskingEnabled() bool {
+	return atomic.LoadInt32(&maskingEnabled) == 1
+}
+
+// 从配置读取输出掩码设置
+func ConfigureMasking(cfg KeyringConfig) {
+	if enabled, err := strconv.ParseBool(cfg.Get(MaskingConfigKey)); err == nil {
+		SetMaskingEnabled(enabled)
+	}
+}
+
+// 按掩码方式处理文本(未登录的掩码方式作为全部掩码)
+func MaskValue(mask string, value string) string {
+	maskFuncLock.RLock()
+	fn, exist := maskFuncs[mask]
+	maskFuncLock.RUnlock()
+	if !exist {
+		fn = maskFull
+	}
+	return fn(value)
+}
+
+// 返回掩码处理后的副本(v为实体, 实体指针或其slice, 其它值原样返回)
+func MaskEntity(v interface{}) interface{} {
+	if v == nil {
+		return v
+	}
+	masked := maskReflectValue(reflect.ValueOf(v))
+	if !masked.IsValid() {
+		return v
+	}
+	return masked.Interface()
+}
+
+// 掩码处理(无需掩码时返回无效值)
+func maskReflectValue(value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		entity, ok := value.Interface().(Entity)
+		if !ok || !hasMaskColumn(entity) {
+			return reflect.Value{}
+		}
+		copied := reflect.New(value.Type().Elem())
+		copied.Elem().Set(value.Elem())
+		maskFields(copied.Interface().(Entity))
+		return copied
+	case reflect.Struct:
+		pointer := reflect.New(value.Type())
+		pointer.Elem().Set(value)
+		if masked := maskReflectValue(pointer); masked.IsValid() {
+			return masked.Elem()
+		}
+	case reflect.Slice:
+		elemType := value.Type().Elem()
+		if elemType.Kind() != reflect.Ptr {
+			elemType = reflect.PtrTo(elemType)
+		}
+		if !elemType.Implements(entityType) {
+			return reflect.Value{}
+		}
+		copied := reflect.MakeSlice(reflect.SliceOf(value.Type().Elem()), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elem := value.Index(i)
+			if masked := maskReflectValue(elem); masked.IsValid() {
+				elem = masked
+			}
+			copied.Index(i).Set(elem)
+		}
+		return copied
+	}
+	return reflect.Value{}
+}
+
+var entityType = reflect.TypeOf((*Entity)(nil)).Elem()
+
+// 实体是否有掩码列
+func hasMaskColumn(entity Entity) bool {
+	for _, colMetadata := range GetEntityMetadata(entity).Columns {
+		if colMetadata.Mask != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// 对实体的掩码列进行掩码处理
+func maskFields(entity Entity) {
+	entMetadata := GetEntityMetadata(entity)
+	_, rftValue := entityTypeValue(entity)
+	for _, colMetadata := range entMetadata.Columns {
+		if colMetadata.Mask == "" {
+			continue
+		}
+		field := rftValue.Field(colMetadata.FieldIndex)
+		switch v := field.Interface().(type) {
+		case sql.NullString:
+			if v.Valid {
+				field.Set(reflect.ValueOf(sql.NullString{String: MaskValue(colMetadata.Mask, v.String), Valid: true}))
+			}
+		case string:
+			field.SetString(MaskValue(colMetadata.Mask, v))
+		}
+	}
+}
+
+func maskFull(value string) string {
+	return strings.Repeat(maskChar, utf8.RuneCountInString(value))
+}
+
+// 保留开头keepHead个及末尾keepTail个字符(保留字符不少于全体时全部掩码)
+func maskKeep(value string, keepHead int, keepTail int) string {
+	runes := []rune(value)
+	if len(runes) <= keepHead+keepTail {
+		return maskFull(value)
+	}
+	return string(runes[:keepHead]) + strings.Repeat(maskChar, len(runes)-keepHead-keepTail) + string(runes[len(runes)-keepTail:])
+}
+
+func maskEmail(value string) string {
+	i := strings.LastIndex(value, "@")
+	if i < 0 {
+		return maskKeep(value, 1, 0)
+	}
+	return maskKeep(value[:i], 1, 0) + value[i:]
+}
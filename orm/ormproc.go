@@ -0,0 +1,145 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// 存储过程参数方向
+type ParamMode int
+
+const (
+	ParamIn ParamMode = iota
+	ParamOut
+	ParamInOut
+)
+
+// 存储过程参数
+type ProcParam struct {
+	Mode ParamMode
+	// 参数名(OUT参数值的Key)
+	Name string
+	// IN参数值
+	Value interface{}
+	// OUT参数值的接收指针(可为nil)
+	Dest interface{}
+}
+
+// IN参数
+func ProcIn(value interface{}) ProcParam {
+	return ProcParam{Mode: ParamIn, Value: value}
+}
+
+// OUT参数
+func ProcOut(name string, dest interface{}) ProcParam {
+	return ProcParam{Mode: ParamOut, Name: name, Dest: dest}
+}
+
+// INOUT参数
+func ProcInOut(name string, value interface{}, dest interface{}) ProcParam {
+	return ProcParam{Mode: ParamInOut, Name: name, Value: value, Dest: dest}
+}
+
+// 方言生成的存储过程调用SQL文
+type ProcedureCall struct {
+	// 调用前执行的SQL文(设置INOUT参数的会话变量等, 可为空)
+	Prepare       string
+	PrepareParams []interface{}
+	// CALL SQL文
+	Call       string
+	CallParams []interface{}
+	// 读取OUT参数值的SQL文(为空时OUT参数值作为CALL的最后一个结果集返回)
+	Out string
+}
+
+// 调用存储过程: 各结果集按顺序映射至results(对象指针或slice指针, nil时跳过该结果集),
+// OUT参数值设置至各参数的Dest, 并以参数名为Key返回
+// 存储过程更新的表的缓存不会自动失效(必要时调用'ClearCache')
+func (this *Orm) CallProcedure(ctx OrmContext, procedure string, params []ProcParam, results ...interface{}) (map[string]interface{}, error) {
+	call, err := ctx.Dialect().ProcedureCall(procedure, params)
+	if err != nil {
+		return nil, err
+	}
+	var outs []ProcParam
+	for _, param := range params {
+		if param.Mode != ParamIn {
+			outs = append(outs, param)
+		}
+	}
+
+	// 会话变量只在同一连接中有效
+	executor, release, err := ctx.session()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if call.Prepare != "" {
+		if _, err = ctx.execOn(executor, call.Prepare, call.PrepareParams); err != nil {
+			return nil, err
+		}
+	}
+	sqlRows, err := ctx.queryOn(executor, call.Call, call.CallParams)
+	rows := newOrmRows(sqlRows, err)
+	defer rows.Close()
+	if err = rows.mapResultSets(results); err != nil {
+		return nil, err
+	}
+	if len(outs) == 0 {
+		return map[string]interface{}{}, rows.Close()
+	}
+
+	if call.Out == "" {
+		if len(results) > 0 && !rows.NextResultSet() {
+			return nil, fmt.Errorf("procedure %s returned no OUT values", procedure)
+		}
+		return scanOutValues(procedure, sqlRows, outs)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	outRows, err := ctx.queryOn(executor, call.Out, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer outRows.Close()
+	return scanOutValues(procedure, outRows, outs)
+}
+
+// 读取OUT参数值
+func scanOutValues(procedure string, rows *sql.Rows, outs []ProcParam) (map[string]interface{}, error) {
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("procedure %s returned no OUT values", procedure)
+	}
+	values := make([]interface{}, len(outs))
+	pointers := make([]interface{}, len(outs))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+	outValues := make(map[string]interface{}, len(outs))
+	for i, param := range outs {
+		value := values[i]
+		if bytes, ok := value.([]byte); ok {
+			// 会话变量等以文本返回
+			value = string(bytes)
+		}
+		outValues[param.Name] = value
+		if param.Dest == nil {
+			continue
+		}
+		dest := reflect.ValueOf(param.Dest)
+		if dest.Kind() != reflect.Ptr || dest.IsNil() {
+			return nil, fmt.Errorf("OUT parameter %s: dest must be a non-nil pointer", param.Name)
+		}
+		if err := assignValue(dest.Elem(), value); err != nil {
+			return nil, fmt.Errorf("OUT parameter %s: %v", param.Name, err)
+		}
+	}
+	return outValues, nil
+}
@@ -3,13 +3,14 @@ package orm
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"reflect"
 )
 
 // Errors定义
 var (
 	errorRowsNotSpecified = errors.New("no sql.Rows specified.")
-	errorRecordNotFound = errors.New("No records found.")
+	ErrorRecordNotFound = errors.New("No records found.")
 )
 
 // O/R Mapping 结果集
@@ -23,11 +24,22 @@ type OrmRows struct {
 	rows       *sql.Rows
 	err        error
 	closed bool
+	// 跨分片查询时未读取的其它分片结果集
+	pending []*sql.Rows
+	// 逐行映射('Next')使用的mapper
+	mapper OrmMapper
+	// 启用缓存的查询(映射前不执行查询)
+	cache *cachedQuery
 }
 
 // 创建'OrmRows'实例
 func newOrmRows(rows *sql.Rows, err error) *OrmRows {
-	return &OrmRows{rows, err, false}
+	return &OrmRows{rows: rows, err: err}
+}
+
+// 创建跨分片查询的'OrmRows'实例(按顺序读取各分片的结果集)
+func newShardOrmRows(rows []*sql.Rows) *OrmRows {
+	return &OrmRows{rows: rows[0], pending: rows[1:]}
 }
 
 // 创建'OrmResult'实例
@@ -37,6 +49,7 @@ func newOrmResult(execResult sql.Result) *OrmResult {
 
 // 获取'*sql.Rows'
 func (this *OrmRows) Rows() (*sql.Rows, error) {
+	this.load()
 	return this.rows, this.err
 }
 
@@ -53,13 +66,50 @@ func (this *OrmResult) RowsAffected() (int64, error) {
 // 关闭'*sql.Rows'
 func (this *OrmRows) Close() error {
 	var err error
-	if !this.closed {
+	if !this.closed && this.rows != nil {
 		err = this.rows.Close()
+		for _, rows := range this.pending {
+			rows.Close()
+		}
+		this.pending = nil
 		this.closed = true
 	}
 	return err
 }
 
+// 读取下一行(跨分片查询时当前分片读完后切换至下一分片)
+func (this *OrmRows) next() bool {
+	for !this.rows.Next() {
+		if this.rows.Err() != nil || len(this.pending) == 0 {
+			return false
+		}
+		this.rows.Close()
+		this.rows, this.pending = this.pending[0], this.pending[1:]
+	}
+	return true
+}
+
+// 逐行映射处理: 读取下一行至tar(对象指针), 无下一行或出错时关闭结果集并返回false
+func (this *OrmRows) Next(tar interface{}) (bool, error) {
+	if this.err != nil {
+		return false, this.err
+	}
+	this.load()
+	if !this.next() {
+		err := this.rows.Err()
+		this.Close()
+		return false, err
+	}
+	if this.mapper == nil {
+		this.mapper = newDefaultOrmMapper(reflect.TypeOf(tar).Elem())
+	}
+	if err := this.mapRowToObject(this.rows, tar, this.mapper); err != nil {
+		this.Close()
+		return false, err
+	}
+	return true, nil
+}
+
 // 查询结果映射处理
 func (this *OrmRows) DefaultMapping(dest interface{}) error {
 	return this.Mapping(dest, nil)
@@ -68,7 +118,77 @@ func (this *OrmRows) DefaultMapping(dest interface{}) error {
 // 带有特定mapper的查询结果映射处理
 //func (this *OrmRows) Mapping(tar interface{}, mapper OrmMapper) error {
 func (this *OrmRows) Mapping(tar interface{}, mapper func(entity interface{}) []interface{}) error {
-	ormMapper := NewSimpleCallbackMapper(mapper)
+	var ormMapper OrmMapper = nil
+	if mapper != nil {
+		ormMapper = NewSimpleCallbackMapper(mapper)
+	}
+	return this.MappingWith(tar, ormMapper)
+}
+
+// 使用'OrmMapper'的查询结果映射处理(mapper为nil时按目标类型选择默认mapper)
+func (this *OrmRows) MappingWith(tar interface{}, ormMapper OrmMapper) error {
+	if this.err != nil {
+		return this.err
+	}
+	if this.cache != nil && this.rows == nil {
+		return this.cache.mapping(this, tar, ormMapper)
+	}
+	return this.mapResultSet(tar, ormMapper)
+}
+
+// 切换至下一个结果集(存储过程等返回多个结果集时使用)
+func (this *OrmRows) NextResultSet() bool {
+	if this.err != nil || this.closed {
+		return false
+	}
+	this.load()
+	this.mapper = nil
+	return this.rows.NextResultSet()
+}
+
+// 多结果集映射处理: 按顺序将各结果集映射至targets(对象指针或slice指针, nil时跳过该结果集)
+func (this *OrmRows) MappingResultSets(targets ...interface{}) error {
+	defer this.Close()
+	return this.mapResultSets(targets)
+}
+
+// 按顺序映射各结果集(不关闭结果集)
+func (this *OrmRows) mapResultSets(targets []interface{}) error {
+	if this.err != nil {
+		return this.err
+	}
+	this.load()
+	for i, tar := range targets {
+		if i > 0 && !this.NextResultSet() {
+			if err := this.rows.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("result set %d does not exist", i)
+		}
+		if tar == nil {
+			continue
+		}
+		if err := this.mapResultSet(tar, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 执行启用缓存时延迟的查询(出错时panic, 与'Retrieve'一致)
+func (this *OrmRows) load() {
+	if this.rows != nil || this.err != nil || this.cache == nil {
+		return
+	}
+	rows, err := this.cache.ctx.queryShards(this.cache.sqlText, this.cache.sqlParams, false)
+	if err != nil {
+		panic(err)
+	}
+	this.rows, this.pending = rows[0], rows[1:]
+}
+
+// 映射当前结果集至目标实例(不关闭结果集)
+func (this *OrmRows) mapResultSet(tar interface{}, ormMapper OrmMapper) error {
 	var err error = nil
 	// Check tar type: Must be pointer
 	t := reflect.TypeOf(tar)
@@ -102,17 +222,23 @@ func (this *OrmRows) mapToSlice(tar interface{}, sliceType reflect.Type, mapper
 	slice := sliceObj.Elem()
 
 	// Read each row and convert to object
-	for this.rows.Next() {
+	for this.next() {
 		// Create new element object
 		elem := reflect.New(elemType)
 
 		// DefaultMapping row to object
-		this.mapRowToObject(this.rows, elem.Interface(), mapper)
+		if err = this.mapRowToObject(this.rows, elem.Interface(), mapper); err != nil {
+			return err
+		}
 
 		// Add to slice
 		slice = reflect.Append(slice, elem.Elem())
 	}
 
+	if err = this.rows.Err(); err != nil {
+		return err
+	}
+
 	// Write slice object back to tar interface{}
 	reflect.ValueOf(tar).Elem().Set(slice)
 
@@ -122,8 +248,11 @@ func (this *OrmRows) mapToSlice(tar interface{}, sliceType reflect.Type, mapper
 
 // 映射sql.Rows数据至目标实例
 func (this *OrmRows) mapToObject(tar interface{}, elemType reflect.Type, mapper OrmMapper) error {
-	if !this.rows.Next() {
-		return errorRecordNotFound
+	if !this.next() {
+		if err := this.rows.Err(); err != nil {
+			return err
+		}
+		return ErrorRecordNotFound
 	}
 
 	if mapper == nil {
@@ -139,5 +268,13 @@ func (this *OrmRows) mapRowToObject(row *sql.Rows, tar interface{}, mapper OrmMa
 	if mapper != nil {
 		err = mapper.Mapping(row, tar)
 	}
+	// 解密加密列
+	if err == nil {
+		err = decryptEntity(tar)
+	}
+	// 保存读取时的快照
+	if entity, ok := tar.(Entity); ok && err == nil {
+		Track(entity)
+	}
 	return err
 }
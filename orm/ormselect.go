@@ -0,0 +1,235 @@
+package orm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+)
+
+// 聚合函数
+type AggregateFunc string
+
+const (
+	AggregateCount AggregateFunc = "COUNT"
+	AggregateSum   AggregateFunc = "SUM"
+	AggregateAvg   AggregateFunc = "AVG"
+	AggregateMin   AggregateFunc = "MIN"
+	AggregateMax   AggregateFunc = "MAX"
+)
+
+// 聚合列定义(Name为实体字段名, COUNT时可为空或"*")
+type AggregateColumn struct {
+	Func  AggregateFunc
+	Name  string
+	Alias string
+}
+
+// HAVING条件(Condition为SQL片段, 参数使用'?'占位)
+type HavingCondition struct {
+	Condition string
+	Params    []interface{}
+}
+
+// 构建指定列SELECT SQL文(fields为实体字段名)
+func (this *Orm) BuildSqlSelectColumns(entity Entity, fields []string, orderByList []OrderByCondition) (string, []interface{}) {
+	entMetadata := GetEntityMetadata(entity)
+	if len(fields) == 0 {
+		return this.BuildSqlSelect(entity, orderByList)
+	}
+
+	var sql bytes.Buffer
+	sql.WriteString("SELECT ")
+	for i, field := range fields {
+		if i > 0 {
+			sql.WriteString(",")
+		}
+		colMetadata := entMetadata.mustColumn(field)
+		sql.WriteString(colMetadata.Column)
+		sql.WriteString(" AS `")
+		sql.WriteString(colMetadata.FieldId)
+		sql.WriteString("`")
+	}
+	sql.WriteString(" FROM ")
+	sql.WriteString(entMetadata.tableRef())
+
+	sqlCondition, sqlParamList := this.buildSqlCondition(entMetadata, entity, "")
+	sqlCondition, sqlParamList = entMetadata.appendTenantCondition(sqlCondition, sqlParamList, "")
+	if sqlCondition != "" {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(sqlCondition)
+	}
+	writeSqlOrderBy(&sql, orderByList)
+	return sql.String(), sqlParamList
+}
+
+// 构建SUM SQL文
+func (this *Orm) BuildSqlSum(entity Entity, field string) (string, []interface{}) {
+	return this.BuildSqlAggregate(entity, AggregateSum, field)
+}
+
+// 构建AVG SQL文
+func (this *Orm) BuildSqlAvg(entity Entity, field string) (string, []interface{}) {
+	return this.BuildSqlAggregate(entity, AggregateAvg, field)
+}
+
+// 构建MIN SQL文
+func (this *Orm) BuildSqlMin(entity Entity, field string) (string, []interface{}) {
+	return this.BuildSqlAggregate(entity, AggregateMin, field)
+}
+
+// 构建MAX SQL文
+func (this *Orm) BuildSqlMax(entity Entity, field string) (string, []interface{}) {
+	return this.BuildSqlAggregate(entity, AggregateMax, field)
+}
+
+// 构建聚合SQL文(实体中非空字段作为查询条件)
+func (this *Orm) BuildSqlAggregate(entity Entity, fn AggregateFunc, field string) (string, []interface{}) {
+	entMetadata := GetEntityMetadata(entity)
+
+	var sql bytes.Buffer
+	sql.WriteString("SELECT ")
+	sql.WriteString(entMetadata.aggregateExpr(AggregateColumn{Func: fn, Name: field}))
+	sql.WriteString(" AS `")
+	sql.WriteString(strings.ToLower(string(fn)))
+	sql.WriteString("` FROM ")
+	sql.WriteString(entMetadata.tableRef())
+
+	sqlCondition, sqlParamList := this.buildSqlCondition(entMetadata, entity, "")
+	sqlCondition, sqlParamList = entMetadata.appendTenantCondition(sqlCondition, sqlParamList, "")
+	if sqlCondition != "" {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(sqlCondition)
+	}
+	return sql.String(), sqlParamList
+}
+
+// 构建GROUP BY SQL文(groupByList为实体字段名, 分组列以字段名作为别名)
+func (this *Orm) BuildSqlGroupBy(entity Entity, groupByList []string, aggregateList []AggregateColumn,
+	having *HavingCondition, orderByList []OrderByCondition) (string, []interface{}) {
+	entMetadata := GetEntityMetadata(entity)
+	if len(groupByList) == 0 && len(aggregateList) == 0 {
+		panic("Group by or aggregate column must be specified.")
+	}
+
+	var sql bytes.Buffer
+	var groupBy bytes.Buffer
+	sql.WriteString("SELECT ")
+	for i, field := range groupByList {
+		colMetadata := entMetadata.mustColumn(field)
+		if i > 0 {
+			sql.WriteString(",")
+			groupBy.WriteString(",")
+		}
+		sql.WriteString(colMetadata.Column)
+		sql.WriteString(" AS `")
+		sql.WriteString(colMetadata.FieldId)
+		sql.WriteString("`")
+		groupBy.WriteString(colMetadata.Column)
+	}
+	for i, aggregate := range aggregateList {
+		if i > 0 || len(groupByList) > 0 {
+			sql.WriteString(",")
+		}
+		alias := aggregate.Alias
+		if alias == "" {
+			alias = strings.ToLower(string(aggregate.Func))
+			if aggregate.Name != "" && aggregate.Name != "*" {
+				alias += aggregate.Name
+			}
+		}
+		sql.WriteString(entMetadata.aggregateExpr(aggregate))
+		sql.WriteString(" AS `")
+		sql.WriteString(alias)
+		sql.WriteString("`")
+	}
+	sql.WriteString(" FROM ")
+	sql.WriteString(entMetadata.tableRef())
+
+	sqlCondition, sqlParamList := this.buildSqlCondition(entMetadata, entity, "")
+	sqlCondition, sqlParamList = entMetadata.appendTenantCondition(sqlCondition, sqlParamList, "")
+	if sqlCondition != "" {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(sqlCondition)
+	}
+	if groupBy.Len() > 0 {
+		sql.WriteString(" GROUP BY ")
+		sql.WriteString(groupBy.String())
+	}
+	if having != nil && having.Condition != "" {
+		sql.WriteString(" HAVING ")
+		sql.WriteString(having.Condition)
+		sqlParamList = append(sqlParamList, having.Params...)
+	}
+	writeSqlOrderBy(&sql, orderByList)
+	return sql.String(), sqlParamList
+}
+
+// 构建实体非空字段的WHERE条件(不含'WHERE', columnPrefix为列名前缀如表别名)
+func (this *Orm) buildSqlCondition(entMetadata EntityMetadata, entity Entity, columnPrefix string) (string, []interface{}) {
+	rftType, rftValue := entityTypeValue(entity)
+	var sqlCondition bytes.Buffer
+	var sqlParamList []interface{}
+	for i := 0; i < rftType.NumField(); i++ {
+		field := rftType.Field(i)
+		colMetadata, exist := entMetadata.Columns[field.Name]
+		if !exist || entMetadata.isTenantColumn(field.Name) {
+			continue
+		}
+		value := rftValue.Field(i).Interface()
+		if this.isNotNull(field.Type.String(), value) {
+			sqlCondition.WriteString(columnPrefix)
+			sqlCondition.WriteString(colMetadata.Column)
+			sqlCondition.WriteString("=? AND ")
+			sqlParamList = append(sqlParamList, entMetadata.conditionValue(field.Name, value))
+		}
+	}
+	return strings.TrimSuffix(sqlCondition.String(), " AND "), sqlParamList
+}
+
+// 获取实体的反射类型与值
+func entityTypeValue(entity interface{}) (reflect.Type, reflect.Value) {
+	if reflect.Ptr == reflect.TypeOf(entity).Kind() {
+		return reflect.TypeOf(entity).Elem(), reflect.ValueOf(entity).Elem()
+	}
+	return reflect.TypeOf(entity), reflect.ValueOf(entity)
+}
+
+// 输出ORDER BY子句
+func writeSqlOrderBy(sql *bytes.Buffer, orderByList []OrderByCondition) {
+	if len(orderByList) == 0 {
+		return
+	}
+	sql.WriteString(" ORDER BY ")
+	for i, orderBy := range orderByList {
+		if i > 0 {
+			sql.WriteString(",")
+		}
+		sql.WriteString(orderBy.Name)
+		if orderBy.DESC {
+			sql.WriteString(" DESC")
+		}
+	}
+}
+
+// 根据字段名获取列Metadata(不存在时panic)
+func (this EntityMetadata) mustColumn(field string) ColumnMetadata {
+	colMetadata, exist := this.Columns[field]
+	if !exist {
+		panic("Unknown entity field: " + this.Table + "." + field)
+	}
+	return colMetadata
+}
+
+// 聚合表达式
+func (this EntityMetadata) aggregateExpr(aggregate AggregateColumn) string {
+	if aggregate.Func == "" {
+		panic("Aggregate function can not be empty.")
+	}
+	if aggregate.Name == "" || aggregate.Name == "*" {
+		if aggregate.Func != AggregateCount {
+			panic("Aggregate column can not be empty: " + string(aggregate.Func))
+		}
+		return "COUNT(*)"
+	}
+	return string(aggregate.Func) + "(" + this.mustColumn(aggregate.Name).Column + ")"
+}
@@ -0,0 +1,590 @@
+package orm
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors定义
+var (
+	ErrorShardKeyRequired      = errors.New("shard key is required for sharded table")
+	ErrorCrossShardQuery       = errors.New("query without shard key can not be joined, ordered, limited or aggregated across shards, use SelectSharded")
+	ErrorCrossShard            = errors.New("statement spans multiple shards")
+	ErrorCrossShardTransaction = errors.New("transaction can not span multiple data sources")
+	ErrorUnknownDataSource     = errors.New("unknown data source")
+)
+
+//------------------------------
+// 数据源
+
+var (
+	dataSources     = map[string]OrmContext{}
+	dataSourcesLock sync.RWMutex
+)
+
+// 登录数据源(分片规则按名称引用)
+func RegisterDataSource(name string, ctx OrmContext) {
+	dataSourcesLock.Lock()
+	defer dataSourcesLock.Unlock()
+	dataSources[name] = ctx
+}
+
+// 获取已登录的数据源
+func GetDataSource(name string) (OrmContext, bool) {
+	dataSourcesLock.RLock()
+	defer dataSourcesLock.RUnlock()
+	ctx, exist := dataSources[name]
+	return ctx, exist
+}
+
+//------------------------------
+// 分片规则
+
+// 分片方式
+type ShardStrategy int
+
+const (
+	ShardNone ShardStrategy = iota
+	// 按分片键的哈希值(整数为其值)取余
+	ShardHash
+	// 按分片键(整数)的范围
+	ShardRange
+)
+
+// 分片
+type Shard struct {
+	// 数据源名(为空时使用调用方的上下文)
+	DataSource string
+	// 表名后缀(如'_0')
+	Suffix string
+	// 范围分片的上限(不含), 最后的分片为0时无上限
+	Upper int64
+}
+
+// 分片规则
+type ShardRule struct {
+	Strategy ShardStrategy
+	// 分片键字段(实体字段名)
+	Field  string
+	Shards []Shard
+}
+
+// 设置实体的分片规则(分片键须为实体字段)
+// 各分片的表结构须相同, 所有数据源须使用与调用方上下文相同的数据库方言
+func SetShardRule(entity Entity, rule ShardRule) {
+	table := entity.TableName()
+	var column string
+	if rule.Strategy != ShardNone {
+		colMetadata, exist := GetEntityMetadata(entity).Columns[rule.Field]
+		if !exist {
+			panic(fmt.Sprintf("shard key field not found: %s.%s", table, rule.Field))
+		}
+		if len(rule.Shards) == 0 {
+			panic(fmt.Sprintf("no shards defined: %s", table))
+		}
+		column = colMetadata.Column
+	}
+	updateEntityMetadata(entity, func(entMetadata *EntityMetadata) {
+		entMetadata.Shard = rule
+	})
+	shardRouteInstance.set(table, column, rule)
+}
+
+// 根据分片键的值确定分片序号
+func (this ShardRule) Locate(value interface{}) (int, error) {
+	if valuer, ok := value.(driver.Valuer); ok {
+		var err error
+		if value, err = valuer.Value(); err != nil {
+			return 0, err
+		}
+	}
+	if value == nil {
+		return 0, ErrorShardKeyRequired
+	}
+	switch this.Strategy {
+	case ShardHash:
+		n := int64(len(this.Shards))
+		if i, ok := integerValue(value); ok {
+			return int((i%n + n) % n), nil
+		}
+		hash := fnv.New32a()
+		if bytesValue, ok := value.([]byte); ok {
+			hash.Write(bytesValue)
+		} else {
+			hash.Write([]byte(fmt.Sprint(value)))
+		}
+		return int(int64(hash.Sum32()) % n), nil
+	case ShardRange:
+		i, ok := integerValue(value)
+		if !ok {
+			return 0, fmt.Errorf("range shard key must be an integer: %v", value)
+		}
+		for index, shard := range this.Shards {
+			if i < shard.Upper || (shard.Upper == 0 && index == len(this.Shards)-1) {
+				return index, nil
+			}
+		}
+		return 0, fmt.Errorf("shard key %d is out of range", i)
+	}
+	return 0, fmt.Errorf("unknown shard strategy: %d", this.Strategy)
+}
+
+// 整数值
+func integerValue(value interface{}) (int64, bool) {
+	rftValue := reflect.ValueOf(value)
+	switch rftValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rftValue.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rftValue.Uint()), true
+	}
+	return 0, false
+}
+
+//------------------------------
+// 分片路由(执行时根据SQL文中分片键的参数值改写表名及选择数据源)
+
+// 分片表
+type shardTable struct {
+	table   string
+	column  string
+	rule    ShardRule
+	pattern *regexp.Regexp
+	// WHERE条件中的分片键('COLUMN=?'或'T0.COLUMN=?')
+	condition *regexp.Regexp
+}
+
+// 分片路由(表名为Key, 更新时复制)
+type shardRoute struct {
+	lock   sync.RWMutex
+	tables map[string]*shardTable
+}
+
+var shardRouteInstance = &shardRoute{}
+
+var insertPattern = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+[^(\s]+\s*\(([^)]*)\)\s*VALUES`)
+
+func (this *shardRoute) set(table string, column string, rule ShardRule) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	routed := make(map[string]*shardTable, len(this.tables)+1)
+	for name, routedTable := range this.tables {
+		routed[name] = routedTable
+	}
+	key := strings.ToUpper(table)
+	if rule.Strategy == ShardNone {
+		delete(routed, key)
+	} else {
+		routed[key] = &shardTable{
+			table:  table,
+			column: column,
+			rule:   rule,
+			// 租户路由改写后的表名('tenant_TABLE', 'tenant.TABLE')也作为对象
+			pattern:   regexp.MustCompile(`(?i)\b(FROM|JOIN|UPDATE|INTO)(\s+)((?:\w+[._])?)(` + regexp.QuoteMeta(table) + `)\b([^.]|$)`),
+			condition: regexp.MustCompile(`(?i)(?:^|[\s(.])` + regexp.QuoteMeta(column) + `\s*=\s*\?`),
+		}
+	}
+	this.tables = routed
+}
+
+// 根据分片键确定分片并改写表名(非分片表时返回nil)
+func (this *shardRoute) resolve(sqlText string, sqlParams []interface{}) (*Shard, string, error) {
+	this.lock.RLock()
+	tables := this.tables
+	this.lock.RUnlock()
+	var routed *Shard
+	for _, table := range tables {
+		if !table.pattern.MatchString(sqlText) {
+			continue
+		}
+		index, err := table.locate(sqlText, sqlParams)
+		if err != nil {
+			return nil, sqlText, err
+		}
+		shard := table.rule.Shards[index]
+		if routed != nil && routed.DataSource != shard.DataSource {
+			return nil, sqlText, ErrorCrossShard
+		}
+		routed = &shard
+		sqlText = table.rewrite(sqlText, shard.Suffix)
+	}
+	return routed, sqlText, nil
+}
+
+// 无分片键时在所有分片执行的查询: 单一分片表的SELECT, 且无JOIN, 排序, 件数限制及聚合(count时允许COUNT)
+var (
+	selectPattern     = regexp.MustCompile(`(?is)^\s*SELECT\s`)
+	crossShardPattern = regexp.MustCompile(`(?i)\b(JOIN|ORDER\s+BY|GROUP\s+BY|HAVING|LIMIT|OFFSET|FETCH|DISTINCT|UNION)\b`)
+	aggregatePattern  = regexp.MustCompile(`(?i)\b(COUNT|SUM|AVG|MIN|MAX)\s*\(`)
+)
+
+// 获取在所有分片执行查询的分片表(count为true时允许'COUNT'查询)
+func (this *shardRoute) scatter(sqlText string, count bool) (*shardTable, error) {
+	this.lock.RLock()
+	tables := this.tables
+	this.lock.RUnlock()
+	var scattered *shardTable
+	for _, table := range tables {
+		if !table.pattern.MatchString(sqlText) {
+			continue
+		}
+		if scattered != nil {
+			return nil, ErrorCrossShardQuery
+		}
+		scattered = table
+	}
+	if scattered == nil || !selectPattern.MatchString(sqlText) || crossShardPattern.MatchString(sqlText) {
+		return nil, ErrorCrossShardQuery
+	}
+	if aggregates := aggregatePattern.FindAllStringSubmatch(sqlText, -1); len(aggregates) > 0 {
+		if !count || len(aggregates) > 1 || !strings.EqualFold(aggregates[0][1], "COUNT") {
+			return nil, ErrorCrossShardQuery
+		}
+	}
+	return scattered, nil
+}
+
+// 获取分片表(非分片表时返回nil)
+func (this *shardRoute) table(table string) *shardTable {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.tables[strings.ToUpper(table)]
+}
+
+// 改写为分片的表名
+func (this *shardTable) rewrite(sqlText string, suffix string) string {
+	if suffix == "" {
+		return sqlText
+	}
+	return this.pattern.ReplaceAllString(sqlText, "${1}${2}${3}${4}"+suffix+"${5}")
+}
+
+// 确定SQL文的分片(INSERT按插入列, 其它按WHERE条件中的分片键)
+func (this *shardTable) locate(sqlText string, sqlParams []interface{}) (int, error) {
+	var values []interface{}
+	if groups := insertPattern.FindStringSubmatch(sqlText); groups != nil {
+		columns := strings.Split(groups[1], ",")
+		position := -1
+		for i, column := range columns {
+			if strings.EqualFold(strings.TrimSpace(column), this.column) {
+				position = i
+			}
+		}
+		if position < 0 || len(sqlParams)%len(columns) != 0 {
+			return 0, ErrorShardKeyRequired
+		}
+		for row := 0; row < len(sqlParams)/len(columns); row++ {
+			values = append(values, sqlParams[row*len(columns)+position])
+		}
+	} else {
+		where := strings.Index(strings.ToUpper(sqlText), " WHERE ")
+		if where < 0 {
+			return 0, ErrorShardKeyRequired
+		}
+		loc := this.condition.FindStringIndex(sqlText[where:])
+		if loc == nil {
+			return 0, ErrorShardKeyRequired
+		}
+		position := countPlaceholders(sqlText[:where+loc[1]]) - 1
+		if position >= len(sqlParams) {
+			return 0, ErrorShardKeyRequired
+		}
+		values = append(values, sqlParams[position])
+	}
+	index := -1
+	for _, value := range values {
+		located, err := this.rule.Locate(value)
+		if err != nil {
+			return 0, err
+		}
+		if index >= 0 && located != index {
+			return 0, ErrorCrossShard
+		}
+		index = located
+	}
+	return index, nil
+}
+
+// 计算占位符'?'的数量(忽略引号中的内容)
+func countPlaceholders(sqlText string) int {
+	count := 0
+	var quote byte
+	for i := 0; i < len(sqlText); i++ {
+		c := sqlText[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			count++
+		}
+	}
+	return count
+}
+
+// 分片的数据库操作实例(事务中只能使用同一数据库的分片)
+func (owner *OrmContext) shardExecutor(shard *Shard) (sqlExecutor, error) {
+	if shard == nil || shard.DataSource == "" {
+		return owner.executor(), nil
+	}
+	dataSource, exist := GetDataSource(shard.DataSource)
+	if !exist {
+		return nil, fmt.Errorf("%w: %s", ErrorUnknownDataSource, shard.DataSource)
+	}
+	if owner.tx != nil {
+		if dataSource.conn != owner.conn {
+			return nil, ErrorCrossShardTransaction
+		}
+		return owner.executor(), nil
+	}
+	return dataSource.executor(), nil
+}
+
+// 在指定分片执行查询
+func (owner *OrmContext) queryShard(table *shardTable, shard Shard, sqlText string, sqlParams []interface{}) (*sql.Rows, error) {
+	tenantSql, tenantParams, err := tenantRouteInstance.resolve(sqlText, sqlParams, owner.Tenant())
+	if err != nil {
+		return nil, err
+	}
+	executor, err := owner.shardExecutor(&shard)
+	if err != nil {
+		return nil, err
+	}
+	shardSql := table.rewrite(tenantSql, shard.Suffix)
+	return executor.QueryContext(owner.context(), owner.Dialect().Rebind(shardSql), tenantParams...)
+}
+
+// 执行查询, 条件中无分片键的分片表查询在所有分片执行(按分片顺序返回各分片的结果集)
+func (owner *OrmContext) queryShards(sqlText string, sqlParams []interface{}, count bool) ([]*sql.Rows, error) {
+	rows, err := owner.query(sqlText, sqlParams)
+	if err == nil {
+		return []*sql.Rows{rows}, nil
+	} else if err != ErrorShardKeyRequired {
+		return nil, err
+	}
+	table, err := shardRouteInstance.scatter(sqlText, count)
+	if err != nil {
+		return nil, err
+	}
+	shardRows := make([]*sql.Rows, 0, len(table.rule.Shards))
+	for _, shard := range table.rule.Shards {
+		rows, err := owner.queryShard(table, shard, sqlText, sqlParams)
+		if err != nil {
+			for _, opened := range shardRows {
+				opened.Close()
+			}
+			return nil, err
+		}
+		shardRows = append(shardRows, rows)
+	}
+	return shardRows, nil
+}
+
+//------------------------------
+// 跨分片查询
+
+// 跨分片查询选项
+type ShardQuery struct {
+	OrderBy []OrderByCondition
+	Offset  int
+	// 最大件数(0为无限制)
+	Limit int
+}
+
+// 查询实体(实体中非空字段作为查询条件), 结果写入dest(实体slice指针)
+// 条件中无分片键时查询所有分片, 合并后排序并截取Offset及Limit范围
+// ('Retrieve'在无分片键时只连接各分片的结果, 需要排序及件数限制时使用本方法)
+func (this *Orm) SelectSharded(ctx OrmContext, entity Entity, dest interface{}, query ShardQuery) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return errors.New("[dest] parameter must be a pointer to a slice")
+	}
+	entMetadata := GetEntityMetadata(entity)
+	sqlText, sqlParams := this.BuildSqlSelect(entity, query.OrderBy)
+	table := shardRouteInstance.table(entMetadata.Table)
+	if table == nil || entMetadata.hasShardKey(entity) {
+		// 单一分片
+		if query.Limit > 0 || query.Offset > 0 {
+			sqlText += " " + ctx.Dialect().LimitClause(query.Limit, query.Offset)
+		}
+		ormRows := newOrmRows(ctx.query(sqlText, sqlParams))
+		defer ormRows.Close()
+		return ormRows.DefaultMapping(dest)
+	}
+
+	// 各分片最多读取Offset+Limit件
+	if query.Limit > 0 {
+		sqlText += " " + ctx.Dialect().LimitClause(query.Offset+query.Limit, 0)
+	}
+	merged := reflect.MakeSlice(destValue.Elem().Type(), 0, 0)
+	for _, shard := range table.rule.Shards {
+		rows, err := ctx.queryShard(table, shard, sqlText, sqlParams)
+		part := reflect.New(destValue.Elem().Type())
+		ormRows := newOrmRows(rows, err)
+		err = ormRows.DefaultMapping(part.Interface())
+		ormRows.Close()
+		if err != nil {
+			return err
+		}
+		merged = reflect.AppendSlice(merged, part.Elem())
+	}
+	if len(query.OrderBy) > 0 {
+		if err := sortMerged(entMetadata, merged, query.OrderBy); err != nil {
+			return err
+		}
+	}
+	from, to := query.Offset, merged.Len()
+	if from > to {
+		from = to
+	}
+	if query.Limit > 0 && from+query.Limit < to {
+		to = from + query.Limit
+	}
+	destValue.Elem().Set(merged.Slice(from, to))
+	return nil
+}
+
+// 计算件数(条件中无分片键时合计所有分片)
+func (this *Orm) CountSharded(ctx OrmContext, entity Entity) int64 {
+	entMetadata := GetEntityMetadata(entity)
+	sqlText, sqlParams := this.BuildSqlCount(entity)
+	table := shardRouteInstance.table(entMetadata.Table)
+	if table == nil || entMetadata.hasShardKey(entity) {
+		return this.Count(ctx, sqlText, sqlParams...)
+	}
+	var total int64
+	for _, shard := range table.rule.Shards {
+		rows, err := ctx.queryShard(table, shard, sqlText, sqlParams)
+		if err != nil {
+			panic(err)
+		}
+		var count int64
+		if rows.Next() {
+			err = rows.Scan(&count)
+		} else {
+			err = rows.Err()
+		}
+		rows.Close()
+		if err != nil {
+			panic(err)
+		}
+		total += count
+	}
+	return total
+}
+
+// 实体是否设置了分片键
+func (this EntityMetadata) hasShardKey(entity Entity) bool {
+	colMetadata, exist := this.Columns[this.Shard.Field]
+	if !exist {
+		return false
+	}
+	_, rftValue := entityTypeValue(entity)
+	_, valid := fieldDriverValue(rftValue.Field(colMetadata.FieldIndex))
+	return valid
+}
+
+// 按排序条件(列名或字段名)排序合并结果
+func sortMerged(entMetadata EntityMetadata, merged reflect.Value, orderByList []OrderByCondition) error {
+	indexes := make([]int, len(orderByList))
+	for i, orderBy := range orderByList {
+		indexes[i] = -1
+		for _, colMetadata := range entMetadata.Columns {
+			if strings.EqualFold(colMetadata.Column, orderBy.Name) || colMetadata.FieldId == orderBy.Name {
+				indexes[i] = colMetadata.FieldIndex
+			}
+		}
+		if indexes[i] < 0 {
+			return fmt.Errorf("unknown order by column: %s", orderBy.Name)
+		}
+	}
+	elements := make([]reflect.Value, merged.Len())
+	for i := range elements {
+		elements[i] = reflect.Indirect(merged.Index(i))
+	}
+	sortedIndex := make([]int, len(elements))
+	for i := range sortedIndex {
+		sortedIndex[i] = i
+	}
+	sort.SliceStable(sortedIndex, func(a, b int) bool {
+		for i, orderBy := range orderByList {
+			compared := compareFieldValues(elements[sortedIndex[a]].Field(indexes[i]), elements[sortedIndex[b]].Field(indexes[i]))
+			if compared != 0 {
+				return (compared < 0) != orderBy.DESC
+			}
+		}
+		return false
+	})
+	sorted := reflect.MakeSlice(merged.Type(), merged.Len(), merged.Len())
+	for i, index := range sortedIndex {
+		sorted.Index(i).Set(merged.Index(index))
+	}
+	reflect.Copy(merged, sorted)
+	return nil
+}
+
+// 比较字段值(NULL最小)
+func compareFieldValues(left reflect.Value, right reflect.Value) int {
+	leftValue, leftValid := fieldDriverValue(left)
+	rightValue, rightValid := fieldDriverValue(right)
+	if !leftValid || !rightValid {
+		switch {
+		case leftValid:
+			return 1
+		case rightValid:
+			return -1
+		}
+		return 0
+	}
+	if l, ok := integerValue(leftValue); ok {
+		if r, ok := integerValue(rightValue); ok {
+			switch {
+			case l < r:
+				return -1
+			case l > r:
+				return 1
+			}
+			return 0
+		}
+	}
+	switch l := leftValue.(type) {
+	case float64:
+		if r, ok := rightValue.(float64); ok {
+			switch {
+			case l < r:
+				return -1
+			case l > r:
+				return 1
+			}
+			return 0
+		}
+	case time.Time:
+		if r, ok := rightValue.(time.Time); ok {
+			switch {
+			case l.Before(r):
+				return -1
+			case l.After(r):
+				return 1
+			}
+			return 0
+		}
+	case []byte:
+		if r, ok := rightValue.([]byte); ok {
+			return bytes.Compare(l, r)
+		}
+	}
+	return strings.Compare(fmt.Sprint(leftValue), fmt.Sprint(rightValue))
+}
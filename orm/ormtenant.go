@@ -0,0 +1,232 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Errors定义
+var (
+	ErrorTenantRequired = errors.New("tenant is required for multi-tenant entity")
+	ErrorInvalidTenant  = errors.New("tenant contains invalid characters")
+)
+
+// 多租户模式
+type TenantMode int
+
+const (
+	// 不区分租户
+	TenantNone TenantMode = iota
+	// 按租户区分表名前缀(<租户>_<表名>)
+	TenantTablePrefix
+	// 按租户区分模式(<租户>.<表名>)
+	TenantSchema
+	// 共享表, 以租户列区分数据
+	TenantSharedTable
+)
+
+// 实体多租户策略(通过'SetTenantPolicy'登录至实体Metadata)
+type TenantPolicy struct {
+	Mode TenantMode
+	// 共享表模式的租户列名
+	Column string
+}
+
+// 共享表模式中代替租户值的SQL参数(执行时替换为上下文的租户)
+type tenantParam struct{}
+
+func (tenantParam) String() string {
+	return "<tenant>"
+}
+
+// 用于表名的租户格式
+var tenantNamePattern = regexp.MustCompile("^\\w+$")
+
+// 按租户区分表名的表(表名:策略)
+type tenantRoute struct {
+	tables map[string]TenantPolicy
+	lock   sync.RWMutex
+}
+
+var tenantRouteInstance = &tenantRoute{tables: make(map[string]TenantPolicy)}
+
+// 登录实体多租户策略
+func SetTenantPolicy(entity Entity, policy TenantPolicy) {
+	if policy.Mode == TenantSharedTable && policy.Column == "" {
+		panic("Tenant column can not be empty: " + entity.TableName())
+	}
+	updateEntityMetadata(entity, func(entMetadata *EntityMetadata) {
+		tableRef := entMetadata.tableRef()
+		entMetadata.Tenant = policy
+		entMetadata.replaceTableRef(tableRef, entMetadata.tableRef())
+	})
+	tenantRouteInstance.set(entity.TableName(), policy)
+	invalidateCache(entity.TableName())
+}
+
+// 根据租户解析实际表名
+func (this EntityMetadata) ResolveTable(tenant string) string {
+	return resolveTenantTable(this.Table, this.Tenant, tenant)
+}
+
+func resolveTenantTable(table string, policy TenantPolicy, tenant string) string {
+	switch policy.Mode {
+	case TenantTablePrefix:
+		return tenant + "_" + table
+	case TenantSchema:
+		return tenant + "." + table
+	}
+	return table
+}
+
+// 构建SQL文时使用的表名, 按租户区分表名时为'{{表名}}', 执行时替换为租户的表名
+// (手写的SQL文中也可使用'{{表名}}'引用按租户区分的表)
+func (this EntityMetadata) tableRef() string {
+	if this.Tenant.Mode == TenantTablePrefix || this.Tenant.Mode == TenantSchema {
+		return "{{" + this.Table + "}}"
+	}
+	return this.Table
+}
+
+// 替换默认SQL文中的表名
+func (this *EntityMetadata) replaceTableRef(oldRef string, newRef string) {
+	if oldRef == newRef {
+		return
+	}
+	for _, sql := range []*string{&this.SQLInsertDefault, &this.SQLUpdateDefault, &this.SQLDeleteDefault,
+		&this.SQLSelectDefault, &this.SQLSelectOneDefault, &this.SQLSelectCountDefault} {
+		for _, keyword := range []string{"FROM ", "INTO ", "UPDATE "} {
+			*sql = strings.Replace(*sql, keyword+oldRef, keyword+newRef, 1)
+		}
+	}
+}
+
+// 是否为共享表模式的租户列(构建SQL文时由租户条件代替)
+func (this EntityMetadata) isTenantColumn(field string) bool {
+	return this.Tenant.Mode == TenantSharedTable && this.Columns[field].Column == this.Tenant.Column
+}
+
+// 共享表模式的租户条件(非共享表模式时返回空)
+func (this EntityMetadata) tenantCondition(columnPrefix string) (string, []interface{}) {
+	if this.Tenant.Mode != TenantSharedTable {
+		return "", nil
+	}
+	return columnPrefix + this.Tenant.Column + "=?", []interface{}{tenantParam{}}
+}
+
+// 在WHERE条件中追加租户条件
+func (this EntityMetadata) appendTenantCondition(sqlCondition string, sqlParamList []interface{}, columnPrefix string) (string, []interface{}) {
+	condition, params := this.tenantCondition(columnPrefix)
+	if condition == "" {
+		return sqlCondition, sqlParamList
+	}
+	if sqlCondition != "" {
+		sqlCondition += " AND "
+	}
+	return sqlCondition + condition, append(sqlParamList, params...)
+}
+
+// 在WHERE条件('AND'结尾)中追加租户条件
+func (this EntityMetadata) writeTenantCondition(sqlCondition *bytes.Buffer, sqlParamList []interface{}) []interface{} {
+	condition, params := this.tenantCondition("")
+	if condition == "" {
+		return sqlParamList
+	}
+	sqlCondition.WriteString(condition)
+	sqlCondition.WriteString(" AND ")
+	return append(sqlParamList, params...)
+}
+
+func (this *tenantRoute) set(table string, policy TenantPolicy) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if policy.Mode == TenantTablePrefix || policy.Mode == TenantSchema {
+		this.tables[strings.ToUpper(table)] = policy
+	} else {
+		delete(this.tables, strings.ToUpper(table))
+	}
+}
+
+func (this *tenantRoute) policy(table string) (TenantPolicy, bool) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	policy, exist := this.tables[strings.ToUpper(table)]
+	return policy, exist
+}
+
+// 将SQL文中的'{{表名}}'替换为租户的表名, 并将租户参数替换为租户值
+func (this *tenantRoute) resolve(sqlText string, sqlParams []interface{}, tenant string) (string, []interface{}, error) {
+	copied := false
+	for i, param := range sqlParams {
+		if _, ok := param.(tenantParam); !ok {
+			continue
+		}
+		if tenant == "" {
+			return sqlText, sqlParams, ErrorTenantRequired
+		}
+		// 不修改调用者的参数列表
+		if !copied {
+			sqlParams = append([]interface{}(nil), sqlParams...)
+			copied = true
+		}
+		sqlParams[i] = tenant
+	}
+
+	if !strings.Contains(sqlText, "{{") {
+		return sqlText, sqlParams, nil
+	}
+	var resolved strings.Builder
+	rest := sqlText
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			break
+		}
+		table := rest[start+2 : start+end]
+		policy, exist := this.policy(table)
+		if !exist {
+			// 非按租户区分的表
+			resolved.WriteString(rest[:start+end+2])
+			rest = rest[start+end+2:]
+			continue
+		}
+		if tenant == "" {
+			return sqlText, sqlParams, ErrorTenantRequired
+		}
+		if !tenantNamePattern.MatchString(tenant) {
+			return sqlText, sqlParams, ErrorInvalidTenant
+		}
+		resolved.WriteString(rest[:start])
+		resolved.WriteString(resolveTenantTable(table, policy, tenant))
+		rest = rest[start+end+2:]
+	}
+	resolved.WriteString(rest)
+	return resolved.String(), sqlParams, nil
+}
+
+//------------------------------
+// 租户上下文
+
+type tenantContextKey struct{}
+
+// 返回携带租户的context
+func ContextWithTenant(parent context.Context, tenant string) context.Context {
+	return context.WithValue(parent, tenantContextKey{}, tenant)
+}
+
+// 获取context携带的租户
+func TenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
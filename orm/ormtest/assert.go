@@ -0,0 +1,65 @@
+package ormtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/umeframework/gear/orm"
+)
+
+// 统计与实体非NULL字段一致的记录件数
+func CountRows(ctx orm.OrmContext, entity orm.Entity) (count int64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("count %s: %v", entity.TableName(), r)
+		}
+	}()
+	dao := &orm.Orm{}
+	sqlText, sqlParams := dao.BuildSqlCount(entity)
+	return dao.Count(ctx, sqlText, sqlParams...), nil
+}
+
+// 断言与实体非NULL字段一致的记录件数(实体无条件时为全件数)
+func AssertRowCount(t testing.TB, ctx orm.OrmContext, entity orm.Entity, expected int64) bool {
+	t.Helper()
+	count, err := CountRows(ctx, entity)
+	if err != nil {
+		t.Errorf("ormtest: %v", err)
+		return false
+	}
+	if count != expected {
+		t.Errorf("ormtest: %s row count = %d, expected %d", entity.TableName(), count, expected)
+		return false
+	}
+	return true
+}
+
+// 断言存在与实体非NULL字段一致的记录
+func AssertEntityExists(t testing.TB, ctx orm.OrmContext, entity orm.Entity) bool {
+	t.Helper()
+	count, err := CountRows(ctx, entity)
+	if err != nil {
+		t.Errorf("ormtest: %v", err)
+		return false
+	}
+	if count == 0 {
+		t.Errorf("ormtest: %s has no row with %v", entity.TableName(), orm.EntityToMap(entity))
+		return false
+	}
+	return true
+}
+
+// 断言不存在与实体非NULL字段一致的记录
+func AssertEntityNotExists(t testing.TB, ctx orm.OrmContext, entity orm.Entity) bool {
+	t.Helper()
+	count, err := CountRows(ctx, entity)
+	if err != nil {
+		t.Errorf("ormtest: %v", err)
+		return false
+	}
+	if count != 0 {
+		t.Errorf("ormtest: %s has %d row(s) with %v", entity.TableName(), count, orm.EntityToMap(entity))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,502 @@
+package ormtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/umeframework/gear/orm"
+)
+
+// 伪驱动名
+const FakeDriverName = "ormtest-fake"
+
+// 语句种类
+type StatementKind string
+
+const (
+	KindBegin    StatementKind = "BEGIN"
+	KindCommit   StatementKind = "COMMIT"
+	KindRollback StatementKind = "ROLLBACK"
+	KindExec     StatementKind = "EXEC"
+	KindQuery    StatementKind = "QUERY"
+)
+
+// 伪驱动记录的语句
+type Statement struct {
+	Kind StatementKind
+	Sql  string
+	Args []driver.Value
+	// 是否在事务中执行
+	InTx bool
+}
+
+func (this Statement) String() string {
+	if this.Sql == "" {
+		return string(this.Kind)
+	}
+	return fmt.Sprintf("%s %s %v", this.Kind, this.Sql, this.Args)
+}
+
+// 参数匹配接口(用于'WithArgs')
+type ArgMatcher interface {
+	Match(value driver.Value) bool
+}
+
+type anyArg struct{}
+
+func (anyArg) Match(value driver.Value) bool {
+	return true
+}
+
+// 匹配任意参数
+var AnyArg ArgMatcher = anyArg{}
+
+// 语句预期
+type Expectation struct {
+	kind      StatementKind
+	sql       string
+	args      []interface{}
+	checkArgs bool
+	columns   []string
+	rows      [][]interface{}
+	// 第2个以后的结果集
+	moreSets     []fakeResultSet
+	lastInsertId int64
+	rowsAffected int64
+	err          error
+	fulfilled    bool
+}
+
+// 指定预期参数(可使用'ArgMatcher')
+func (this *Expectation) WithArgs(args ...interface{}) *Expectation {
+	this.args = args
+	this.checkArgs = true
+	return this
+}
+
+// 指定查询返回的结果集
+func (this *Expectation) WillReturnRows(columns []string, rows ...[]interface{}) *Expectation {
+	this.columns = columns
+	this.rows = rows
+	return this
+}
+
+// 追加查询返回的结果集(存储过程等返回多个结果集时, 在'WillReturnRows'之后指定)
+func (this *Expectation) WillReturnResultSet(columns []string, rows ...[]interface{}) *Expectation {
+	this.moreSets = append(this.moreSets, fakeResultSet{columns, rows})
+	return this
+}
+
+// 指定更新返回的插入ID及影响件数
+func (this *Expectation) WillReturnResult(lastInsertId int64, rowsAffected int64) *Expectation {
+	this.lastInsertId = lastInsertId
+	this.rowsAffected = rowsAffected
+	return this
+}
+
+// 指定返回的错误
+func (this *Expectation) WillReturnError(err error) *Expectation {
+	this.err = err
+	return this
+}
+
+func (this *Expectation) String() string {
+	if this.sql == "" {
+		return string(this.kind)
+	}
+	if this.checkArgs {
+		return fmt.Sprintf("%s %s %v", this.kind, this.sql, this.args)
+	}
+	return fmt.Sprintf("%s %s", this.kind, this.sql)
+}
+
+// 判断语句是否满足预期(SQL文忽略空白差异)
+func (this *Expectation) matches(stmt Statement) bool {
+	if this.kind != stmt.Kind {
+		return false
+	}
+	if this.sql != "" && normalizeSql(this.sql) != normalizeSql(stmt.Sql) {
+		return false
+	}
+	if !this.checkArgs {
+		return true
+	}
+	if len(this.args) != len(stmt.Args) {
+		return false
+	}
+	for i, arg := range this.args {
+		if matcher, ok := arg.(ArgMatcher); ok {
+			if !matcher.Match(stmt.Args[i]) {
+				return false
+			}
+			continue
+		}
+		expected, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil || !reflect.DeepEqual(expected, stmt.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeSql(sqlText string) string {
+	return strings.Join(strings.Fields(sqlText), " ")
+}
+
+//------------------------------
+// 伪数据库
+
+// 记录语句并按预期返回结果的伪数据库
+type FakeDB struct {
+	name         string
+	dialect      string
+	db           *sql.DB
+	expectations []*Expectation
+	statements   []Statement
+	unordered    bool
+	lock         sync.Mutex
+}
+
+var (
+	fakeDriverOnce sync.Once
+	fakeSeq        int64
+	fakeDatabases  = make(map[string]*FakeDB)
+	fakeLock       sync.Mutex
+)
+
+// 创建伪数据库(dialect为SQL文转换使用的方言)
+func NewFakeDB(dialect string) *FakeDB {
+	fakeDriverOnce.Do(func() {
+		sql.Register(FakeDriverName, fakeDriver{})
+	})
+	fake := &FakeDB{
+		name:    fmt.Sprintf("fake%d", atomic.AddInt64(&fakeSeq, 1)),
+		dialect: dialect,
+	}
+	fakeLock.Lock()
+	fakeDatabases[fake.name] = fake
+	fakeLock.Unlock()
+
+	fake.db, _ = sql.Open(FakeDriverName, fake.name)
+	// 使用单一连接保证语句顺序及事务状态
+	fake.db.SetMaxOpenConns(1)
+	return fake
+}
+
+// 创建伪数据库, 测试结束时检查所有预期均已满足
+func NewFake(t testing.TB, dialect string) *FakeDB {
+	t.Helper()
+	fake := NewFakeDB(dialect)
+	t.Cleanup(func() {
+		if err := fake.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		fake.Close()
+	})
+	return fake
+}
+
+// 关闭伪数据库
+func (this *FakeDB) Close() {
+	this.db.Close()
+	fakeLock.Lock()
+	delete(fakeDatabases, this.name)
+	fakeLock.Unlock()
+}
+
+// 获取数据库实例
+func (this *FakeDB) DB() *sql.DB {
+	return this.db
+}
+
+// 获取上下文
+func (this *FakeDB) Context() orm.OrmContext {
+	return orm.NewOrmContext(this.dialect, this.db)
+}
+
+// 是否按登录顺序匹配预期(默认按顺序)
+func (this *FakeDB) MatchExpectationsInOrder(ordered bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.unordered = !ordered
+}
+
+// 预期开始事务
+func (this *FakeDB) ExpectBegin() *Expectation {
+	return this.expect(&Expectation{kind: KindBegin})
+}
+
+// 预期提交事务
+func (this *FakeDB) ExpectCommit() *Expectation {
+	return this.expect(&Expectation{kind: KindCommit})
+}
+
+// 预期回滚事务
+func (this *FakeDB) ExpectRollback() *Expectation {
+	return this.expect(&Expectation{kind: KindRollback})
+}
+
+// 预期执行更新(sqlText为空时匹配任意SQL文)
+func (this *FakeDB) ExpectExec(sqlText string) *Expectation {
+	return this.expect(&Expectation{kind: KindExec, sql: sqlText})
+}
+
+// 预期执行查询(sqlText为空时匹配任意SQL文)
+func (this *FakeDB) ExpectQuery(sqlText string) *Expectation {
+	return this.expect(&Expectation{kind: KindQuery, sql: sqlText})
+}
+
+func (this *FakeDB) expect(expectation *Expectation) *Expectation {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.expectations = append(this.expectations, expectation)
+	return expectation
+}
+
+// 获取已执行的语句
+func (this *FakeDB) Statements() []Statement {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return append([]Statement(nil), this.statements...)
+}
+
+// 清除预期及已执行的语句
+func (this *FakeDB) Reset() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.expectations = nil
+	this.statements = nil
+}
+
+// 检查所有预期均已满足
+func (this *FakeDB) ExpectationsWereMet() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	var unmet []string
+	for _, expectation := range this.expectations {
+		if !expectation.fulfilled {
+			unmet = append(unmet, expectation.String())
+		}
+	}
+	if len(unmet) > 0 {
+		return fmt.Errorf("ormtest: unfulfilled expectations: %s", strings.Join(unmet, "; "))
+	}
+	return nil
+}
+
+// 记录语句并查找满足的预期
+func (this *FakeDB) match(stmt Statement) (*Expectation, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.statements = append(this.statements, stmt)
+	for _, expectation := range this.expectations {
+		if expectation.fulfilled {
+			continue
+		}
+		if expectation.matches(stmt) {
+			expectation.fulfilled = true
+			return expectation, expectation.err
+		}
+		if !this.unordered {
+			return nil, fmt.Errorf("ormtest: unexpected %s, next expectation is %s", stmt, expectation)
+		}
+	}
+	return nil, fmt.Errorf("ormtest: unexpected %s", stmt)
+}
+
+//------------------------------
+// database/sql驱动实现
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeLock.Lock()
+	defer fakeLock.Unlock()
+	fake, exist := fakeDatabases[name]
+	if !exist {
+		return nil, fmt.Errorf("ormtest: fake database %s is closed", name)
+	}
+	return &fakeConn{fake: fake}, nil
+}
+
+type fakeConn struct {
+	fake *FakeDB
+	inTx bool
+}
+
+func (this *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{this, query}, nil
+}
+
+func (this *fakeConn) Close() error {
+	return nil
+}
+
+func (this *fakeConn) Begin() (driver.Tx, error) {
+	return this.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (this *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := this.fake.match(Statement{Kind: KindBegin}); err != nil {
+		return nil, err
+	}
+	this.inTx = true
+	return &fakeTx{this}, nil
+}
+
+func (this *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return this.exec(query, namedValues(args))
+}
+
+func (this *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return this.query(query, namedValues(args))
+}
+
+func (this *fakeConn) exec(query string, args []driver.Value) (driver.Result, error) {
+	expectation, err := this.fake.match(Statement{KindExec, query, args, this.inTx})
+	if err != nil {
+		return nil, err
+	}
+	return fakeResult{expectation.lastInsertId, expectation.rowsAffected}, nil
+}
+
+func (this *fakeConn) query(query string, args []driver.Value) (driver.Rows, error) {
+	expectation, err := this.fake.match(Statement{KindQuery, query, args, this.inTx})
+	if err != nil {
+		return nil, err
+	}
+	rows := &fakeRows{}
+	sets := append([]fakeResultSet{{expectation.columns, expectation.rows}}, expectation.moreSets...)
+	for _, set := range sets {
+		values, err := set.driverValues()
+		if err != nil {
+			return nil, err
+		}
+		rows.columns = append(rows.columns, set.columns)
+		rows.sets = append(rows.sets, values)
+	}
+	return rows, nil
+}
+
+// 预期的结果集
+type fakeResultSet struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+func (this fakeResultSet) driverValues() ([][]driver.Value, error) {
+	var err error
+	values := make([][]driver.Value, len(this.rows))
+	for i, row := range this.rows {
+		values[i] = make([]driver.Value, len(row))
+		for j, value := range row {
+			if values[i][j], err = driver.DefaultParameterConverter.ConvertValue(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (this *fakeTx) Commit() error {
+	this.conn.inTx = false
+	_, err := this.conn.fake.match(Statement{Kind: KindCommit})
+	return err
+}
+
+func (this *fakeTx) Rollback() error {
+	this.conn.inTx = false
+	_, err := this.conn.fake.match(Statement{Kind: KindRollback})
+	return err
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (this *fakeStmt) Close() error {
+	return nil
+}
+
+func (this *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (this *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return this.conn.exec(this.query, args)
+}
+
+func (this *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return this.conn.query(this.query, args)
+}
+
+type fakeResult struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (this fakeResult) LastInsertId() (int64, error) {
+	return this.lastInsertId, nil
+}
+
+func (this fakeResult) RowsAffected() (int64, error) {
+	return this.rowsAffected, nil
+}
+
+type fakeRows struct {
+	columns [][]string
+	sets    [][][]driver.Value
+	set     int
+	pos     int
+}
+
+func (this *fakeRows) Columns() []string {
+	return this.columns[this.set]
+}
+
+func (this *fakeRows) Close() error {
+	return nil
+}
+
+func (this *fakeRows) Next(dest []driver.Value) error {
+	if this.pos >= len(this.sets[this.set]) {
+		return io.EOF
+	}
+	copy(dest, this.sets[this.set][this.pos])
+	this.pos++
+	return nil
+}
+
+func (this *fakeRows) HasNextResultSet() bool {
+	return this.set+1 < len(this.sets)
+}
+
+func (this *fakeRows) NextResultSet() error {
+	if !this.HasNextResultSet() {
+		return io.EOF
+	}
+	this.set++
+	this.pos = 0
+	return nil
+}
@@ -0,0 +1,89 @@
+package ormtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/umeframework/gear/orm"
+	"gopkg.in/yaml.v3"
+)
+
+// 测试数据文件扩展名(按顺序查找)
+var fixtureExtensions = []string{".yaml", ".yml", ".json"}
+
+// 从YAML或JSON文件加载实体测试数据
+// 文件内容为记录列表, Key为字段名或列名, 例:
+//
+//	- Id: 1
+//	  Title: Nothing Like The Sun
+func LoadFixture(ctx orm.OrmContext, entity orm.Entity, path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var rows []map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &rows)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &rows)
+	default:
+		err = fmt.Errorf("unsupported fixture file: %s", path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return InsertRows(ctx, entity, rows)
+}
+
+// 插入实体记录(Key为字段名或列名)
+func InsertRows(ctx orm.OrmContext, entity orm.Entity, rows []map[string]interface{}) (count int, err error) {
+	dao := &orm.Orm{}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("insert %s row %d: %v", entity.TableName(), count+1, r)
+		}
+	}()
+	for _, row := range rows {
+		target := orm.NewEntity(entity)
+		if err = orm.MapToEntity(row, target); err != nil {
+			return count, fmt.Errorf("%s row %d: %v", entity.TableName(), count+1, err)
+		}
+		sqlText, sqlParams := dao.BuildSqlInsert(target)
+		if _, err = dao.Exec(ctx, sqlText, sqlParams...); err != nil {
+			return count, fmt.Errorf("%s row %d: %v", entity.TableName(), count+1, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// 从目录加载测试环境中各实体的测试数据
+// 各实体从"<表名>.yaml", "<表名>.yml"或"<表名>.json"加载(文件存在时)
+func (this *Harness) LoadFixtures(ctx orm.OrmContext, dir string) error {
+	for table, entity := range this.entities {
+		for _, ext := range fixtureExtensions {
+			path := filepath.Join(dir, table+ext)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			if _, err := LoadFixture(ctx, entity, path); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// 从目录加载测试数据(失败时终止测试)
+func (this *Harness) MustLoadFixtures(t testing.TB, ctx orm.OrmContext, dir string) {
+	t.Helper()
+	if err := this.LoadFixtures(ctx, dir); err != nil {
+		t.Fatalf("ormtest: load fixtures: %v", err)
+	}
+}
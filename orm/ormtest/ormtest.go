@@ -0,0 +1,169 @@
+// orm测试支持: 内嵌SQLite数据库, 根据实体Metadata建表, 按实体加载测试数据,
+// 各测试在结束时回滚的事务中执行; 另提供记录SQL文并按预期返回结果的伪数据库驱动
+package ormtest
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/umeframework/gear/orm"
+	_ "modernc.org/sqlite"
+)
+
+// SQLite驱动名
+const DriverName = "sqlite"
+
+var databaseSeq int64
+
+// 内嵌数据库测试环境
+type Harness struct {
+	db       *sql.DB
+	ctx      orm.OrmContext
+	entities map[string]orm.Entity
+}
+
+// 创建内存数据库及实体对应的表
+func NewHarness(entities ...orm.Entity) (*Harness, error) {
+	name := fmt.Sprintf("file:ormtest%d?mode=memory&cache=shared", atomic.AddInt64(&databaseSeq, 1))
+	db, err := sql.Open(DriverName, name)
+	if err != nil {
+		return nil, err
+	}
+	// 使用单一连接保持内存数据库并串行化访问
+	db.SetMaxOpenConns(1)
+
+	harness := &Harness{
+		db:       db,
+		ctx:      orm.NewOrmContext(DriverName, db),
+		entities: make(map[string]orm.Entity),
+	}
+	if err = harness.CreateTables(entities...); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return harness, nil
+}
+
+// 创建测试环境(失败时终止测试, 测试结束时关闭数据库)
+func New(t testing.TB, entities ...orm.Entity) *Harness {
+	t.Helper()
+	harness, err := NewHarness(entities...)
+	if err != nil {
+		t.Fatalf("ormtest: %v", err)
+	}
+	t.Cleanup(harness.Close)
+	return harness
+}
+
+// 关闭数据库
+func (this *Harness) Close() {
+	this.db.Close()
+}
+
+// 获取数据库实例
+func (this *Harness) DB() *sql.DB {
+	return this.db
+}
+
+// 获取上下文(非事务)
+func (this *Harness) Context() orm.OrmContext {
+	return this.ctx
+}
+
+// 创建实体对应的表
+func (this *Harness) CreateTables(entities ...orm.Entity) error {
+	for _, entity := range entities {
+		if _, err := this.db.Exec(CreateTableSql(entity)); err != nil {
+			return fmt.Errorf("create table %s: %v", entity.TableName(), err)
+		}
+		this.entities[entity.TableName()] = entity
+	}
+	return nil
+}
+
+// 开始事务(测试结束时回滚)
+func (this *Harness) Begin(t testing.TB) orm.OrmContext {
+	t.Helper()
+	ctx, err := this.ctx.Begin()
+	if err != nil {
+		t.Fatalf("ormtest: begin transaction: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx.Rollback()
+	})
+	return ctx
+}
+
+// 在回滚的事务中执行子测试
+func (this *Harness) Run(t *testing.T, name string, fn func(t *testing.T, ctx orm.OrmContext)) bool {
+	return t.Run(name, func(t *testing.T) {
+		fn(t, this.Begin(t))
+	})
+}
+
+// 根据实体Metadata构建CREATE TABLE SQL文
+func CreateTableSql(entity orm.Entity) string {
+	entMetadata := orm.GetEntityMetadata(entity)
+	var sql bytes.Buffer
+	sql.WriteString("CREATE TABLE ")
+	sql.WriteString(entMetadata.Table)
+	sql.WriteString("(")
+	var keys []string
+	for i, colMetadata := range entMetadata.OrderedColumns() {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(colMetadata.Column)
+		sql.WriteString(" ")
+		sql.WriteString(sqliteColumnType(colMetadata.ColumnType))
+		if colMetadata.NotNull {
+			sql.WriteString(" NOT NULL")
+		}
+		if colMetadata.Key {
+			keys = append(keys, colMetadata.Column)
+		}
+	}
+	// 共享表模式中实体未定义的租户列
+	if tenantColumn := entMetadata.Tenant.Column; entMetadata.Tenant.Mode == orm.TenantSharedTable && !hasColumn(entMetadata, tenantColumn) {
+		sql.WriteString(", ")
+		sql.WriteString(tenantColumn)
+		sql.WriteString(" TEXT NOT NULL")
+	}
+	if len(keys) > 0 {
+		sql.WriteString(", PRIMARY KEY(")
+		sql.WriteString(strings.Join(keys, ","))
+		sql.WriteString(")")
+	}
+	sql.WriteString(")")
+	return sql.String()
+}
+
+func hasColumn(entMetadata orm.EntityMetadata, column string) bool {
+	for _, colMetadata := range entMetadata.Columns {
+		if colMetadata.Column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// 列类型变换为SQLite类型
+func sqliteColumnType(columnType string) string {
+	baseType := strings.ToUpper(strings.TrimSpace(columnType))
+	if i := strings.IndexByte(baseType, '('); i >= 0 {
+		baseType = baseType[:i]
+	}
+	switch baseType {
+	case "INT", "INTEGER", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT", "BOOL", "BOOLEAN", "BIT":
+		return "INTEGER"
+	case "DECIMAL", "NUMERIC", "FLOAT", "DOUBLE", "REAL":
+		return "REAL"
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY":
+		return "BLOB"
+	}
+	return "TEXT"
+}
@@ -0,0 +1,103 @@
+package orm
+
+import (
+	"reflect"
+)
+
+// 实体变更跟踪
+// 嵌入实体结构体后, 经由'OrmRows'读取的实体保存读取时的快照,
+// 'BuildSqlUpdate'只更新与快照相比有变更的字段
+type Tracker struct {
+	snapshot map[string]interface{}
+}
+
+// 字段变更内容
+type FieldChange struct {
+	Field    string
+	Column   string
+	Original interface{}
+	Current  interface{}
+}
+
+// 可跟踪变更的实体(嵌入'Tracker'时满足)
+type trackable interface {
+	ormTracker() *Tracker
+}
+
+func (this *Tracker) ormTracker() *Tracker {
+	return this
+}
+
+// 是否处于变更跟踪中
+func (this *Tracker) Tracked() bool {
+	return this.snapshot != nil
+}
+
+// 以实体当前值作为快照开始跟踪(实体未嵌入'Tracker'时返回false)
+func Track(entity Entity) bool {
+	tracked, ok := entity.(trackable)
+	if !ok {
+		return false
+	}
+	entMetadata := GetEntityMetadata(entity)
+	_, rftValue := entityTypeValue(entity)
+	// 总是创建新的map, 避免与实体副本共享快照
+	snapshot := make(map[string]interface{}, len(entMetadata.Columns))
+	for name, colMetadata := range entMetadata.Columns {
+		snapshot[name] = rftValue.Field(colMetadata.FieldIndex).Interface()
+	}
+	tracked.ormTracker().snapshot = snapshot
+	return true
+}
+
+// 停止跟踪
+func Untrack(entity Entity) {
+	if tracked, ok := entity.(trackable); ok {
+		tracked.ormTracker().snapshot = nil
+	}
+}
+
+// 返回变更字段名列表(按字段定义顺序, 未跟踪时返回nil)
+func ChangedFields(entity Entity) []string {
+	var fields []string
+	for _, change := range Changes(entity) {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
+// 返回变更内容列表(按字段定义顺序, 未跟踪时返回nil)
+func Changes(entity Entity) []FieldChange {
+	snapshot := trackedSnapshot(entity)
+	if snapshot == nil {
+		return nil
+	}
+	_, rftValue := entityTypeValue(entity)
+	changes := make([]FieldChange, 0)
+	for _, colMetadata := range GetEntityMetadata(entity).OrderedColumns() {
+		original := snapshot[colMetadata.FieldId]
+		current := rftValue.Field(colMetadata.FieldIndex).Interface()
+		if !reflect.DeepEqual(original, current) {
+			changes = append(changes, FieldChange{colMetadata.FieldId, colMetadata.Column, original, current})
+		}
+	}
+	return changes
+}
+
+// 获取实体快照(未跟踪时返回nil)
+func trackedSnapshot(entity interface{}) map[string]interface{} {
+	if tracked, ok := entity.(trackable); ok {
+		return tracked.ormTracker().snapshot
+	}
+	return nil
+}
+
+// 更新实体(只更新变更字段), 成功后以当前值更新快照
+func (this *Orm) UpdateEntity(ctx OrmContext, entity Entity) int64 {
+	sqlText, sqlParams := this.BuildSqlUpdate(entity)
+	affected := this.Update(ctx, sqlText, sqlParams[:]...)
+	if trackedSnapshot(entity) != nil {
+		Track(entity)
+	}
+	return affected
+}
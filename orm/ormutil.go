@@ -24,6 +24,9 @@ func (this *Orm) BuildSqlSelect(entity Entity, orderByList []OrderByCondition) (
 	for i := 0; i < rftType.NumField(); i++ {
 		field := rftType.Field(i)
 		name := field.Name
+		if _, exist := entMetadata.Columns[name]; !exist || entMetadata.isTenantColumn(name) {
+			continue
+		}
 		typeName := field.Type.String()
 		column := entMetadata.Columns[name].Column
 		value := rftValue.Field(i).Interface()
@@ -31,12 +34,13 @@ func (this *Orm) BuildSqlSelect(entity Entity, orderByList []OrderByCondition) (
 		if this.isNotNull(typeName, value)  {
 			sqlCondition.WriteString(column)
 			sqlCondition.WriteString("=? AND ")
-			sqlParamList = append(sqlParamList, value)
+			sqlParamList = append(sqlParamList, entMetadata.conditionValue(name, value))
 		}
 	}
 
 	var sql bytes.Buffer
 	sql.WriteString(entMetadata.SQLSelectDefault)
+	sqlParamList = entMetadata.writeTenantCondition(&sqlCondition, sqlParamList)
 	if sqlCondition.Len() > 0 {
 		sql.WriteString(" WHERE ")
 		sql.WriteString(strings.TrimRight(sqlCondition.String(), " AND "))
@@ -53,6 +57,7 @@ func (this *Orm) BuildSqlSelect(entity Entity, orderByList []OrderByCondition) (
 			}
 		}
 	}
+	registerCacheableSql(sql.String(), entity, entMetadata)
 	return  sql.String(), sqlParamList
 }
 
@@ -74,6 +79,9 @@ func (this *Orm) BuildSqlCount(entity Entity) (string, []interface{}) {
 	for i := 0; i < rftType.NumField(); i++ {
 		field := rftType.Field(i)
 		name := field.Name
+		if _, exist := entMetadata.Columns[name]; !exist || entMetadata.isTenantColumn(name) {
+			continue
+		}
 		typeName := field.Type.String()
 		column := entMetadata.Columns[name].Column
 		value := rftValue.Field(i).Interface()
@@ -81,10 +89,11 @@ func (this *Orm) BuildSqlCount(entity Entity) (string, []interface{}) {
 		if this.isNotNull(typeName, value)  {
 			sqlCondition.WriteString(column)
 			sqlCondition.WriteString("=? AND ")
-			sqlParamList = append(sqlParamList, value)
+			sqlParamList = append(sqlParamList, entMetadata.conditionValue(name, value))
 		}
 	}
 	sql := entMetadata.SQLSelectCountDefault
+	sqlParamList = entMetadata.writeTenantCondition(&sqlCondition, sqlParamList)
 	if sqlCondition.Len() > 0 {
 		sql += " WHERE " + strings.TrimRight(sqlCondition.String(), " AND ")
 	}
@@ -108,6 +117,9 @@ func (this *Orm) BuildSqlSelectOne(entity Entity) (string, []interface{}) {
 	for i := 0; i < rftType.NumField(); i++ {
 		field := rftType.Field(i)
 		name := field.Name
+		if _, exist := entMetadata.Columns[name]; !exist || entMetadata.isTenantColumn(name) {
+			continue
+		}
 		typeName := field.Type.String()
 		column := entMetadata.Columns[name].Column
 		key := entMetadata.Columns[name].Key
@@ -117,20 +129,22 @@ func (this *Orm) BuildSqlSelectOne(entity Entity) (string, []interface{}) {
 			if this.isNotNull(typeName, value) {
 				sqlCondition.WriteString(column)
 				sqlCondition.WriteString("=? AND ")
-				sqlParamList = append(sqlParamList, value)
+				sqlParamList = append(sqlParamList, entMetadata.conditionValue(name, value))
 			} else {
 				panic("Primary key parameter can not be empty.")
 			}
 		}
 	}
 	sql := entMetadata.SQLSelectDefault
+	sqlParamList = entMetadata.writeTenantCondition(&sqlCondition, sqlParamList)
 	if sqlCondition.Len() > 0 {
 		sql += " WHERE " + strings.TrimRight(sqlCondition.String(), " AND ")
 	}
+	registerCacheableSql(sql, entity, entMetadata)
 	return  sql, sqlParamList
 }
 
-// 构建UPDATE SQL文
+// 构建UPDATE SQL文(变更跟踪中的实体只更新变更字段, 无变更时返回空SQL文)
 func (this *Orm) BuildSqlUpdate(entity Entity) (string, []interface{}) {
 	entMetadata := GetEntityMetadata(entity)
 	var rftType reflect.Type
@@ -146,13 +160,21 @@ func (this *Orm) BuildSqlUpdate(entity Entity) (string, []interface{}) {
 	var sqlItem bytes.Buffer
 	var sqlValue bytes.Buffer
 	sqlItem.WriteString("UPDATE ")
-	sqlItem.WriteString(entMetadata.Table)
+	sqlItem.WriteString(entMetadata.tableRef())
 	sqlItem.WriteString(" SET ")
 	var sqlItemParamList []interface{}
 	var sqlValueParamList []interface{}
+	if err := entMetadata.validate(entity, false); err != nil {
+		panic(err)
+	}
+	snapshot := trackedSnapshot(entity)
+	changed := false
 	for i := 0; i < rftType.NumField(); i++ {
 		field := rftType.Field(i)
 		name := field.Name
+		if _, exist := entMetadata.Columns[name]; !exist || entMetadata.isTenantColumn(name) {
+			continue
+		}
 		colMetadata := entMetadata.Columns[name]
 		typeName := field.Type.String()
 		column := colMetadata.Column
@@ -160,16 +182,35 @@ func (this *Orm) BuildSqlUpdate(entity Entity) (string, []interface{}) {
 		version := colMetadata.VersionCheck
 		value := rftValue.Field(i).Interface()
 
+		if snapshot != nil {
+			// 变更跟踪中: 只更新变更字段, 主键及版本条件使用读取时的值
+			original := snapshot[name]
+			if !reflect.DeepEqual(original, value) {
+				sqlItem.WriteString(column)
+				sqlItem.WriteString("=?,")
+				sqlItemParamList = append(sqlItemParamList, entMetadata.paramValue(name, value))
+				changed = true
+			}
+			if (key || version) && this.isNotNull(typeName, original) {
+				sqlValue.WriteString(column)
+				sqlValue.WriteString("=? AND ")
+				sqlValueParamList = append(sqlValueParamList, entMetadata.conditionValue(name, original))
+			} else if key {
+				panic("Primary key parameter can not be empty.")
+			}
+			continue
+		}
+
 		if this.isNotNull(typeName, value) {
 			sqlItem.WriteString(column)
 			sqlItem.WriteString("=?,")
-			sqlItemParamList = append(sqlItemParamList, value)
+			sqlItemParamList = append(sqlItemParamList, entMetadata.paramValue(name, value))
 		}
 		if key {
 			if this.isNotNull(typeName, value) {
 				sqlValue.WriteString(column)
 				sqlValue.WriteString("=? AND ")
-				sqlValueParamList = append(sqlValueParamList, value)
+				sqlValueParamList = append(sqlValueParamList, entMetadata.conditionValue(name, value))
 			} else {
 				panic("Primary key parameter can not be empty.")
 			}
@@ -177,10 +218,15 @@ func (this *Orm) BuildSqlUpdate(entity Entity) (string, []interface{}) {
 			if this.isNotNull(typeName, value) {
 				sqlValue.WriteString(column)
 				sqlValue.WriteString("=? AND ")
-				sqlValueParamList = append(sqlValueParamList, value)
+				sqlValueParamList = append(sqlValueParamList, entMetadata.conditionValue(name, value))
 			}
 		}
 	}
+	if snapshot != nil && !changed {
+		// 无变更字段时不需要更新
+		return "", nil
+	}
+	sqlValueParamList = entMetadata.writeTenantCondition(&sqlValue, sqlValueParamList)
 	sql := strings.TrimRight(sqlItem.String(), ",")
 	if sqlValue.Len() > 0 {
 		sql += " WHERE " + strings.TrimRight(sqlValue.String(), " AND ")
@@ -207,12 +253,15 @@ func (this *Orm) BuildSqlDelete(entity Entity) (string, []interface{}) {
 
 	var sqlCondition bytes.Buffer
 	sqlCondition.WriteString("DELETE FROM ")
-	sqlCondition.WriteString(entMetadata.Table)
+	sqlCondition.WriteString(entMetadata.tableRef())
 	sqlCondition.WriteString(" WHERE ")
 	var sqlParamList []interface{}
 	for i := 0; i < rftType.NumField(); i++ {
 		field := rftType.Field(i)
 		name := field.Name
+		if _, exist := entMetadata.Columns[name]; !exist || entMetadata.isTenantColumn(name) {
+			continue
+		}
 		typeName := field.Type.String()
 		column := entMetadata.Columns[name].Column
 		key := entMetadata.Columns[name].Key
@@ -222,16 +271,17 @@ func (this *Orm) BuildSqlDelete(entity Entity) (string, []interface{}) {
 			if this.isNotNull(typeName, value) {
 				sqlCondition.WriteString(column)
 				sqlCondition.WriteString("=? AND ")
-				sqlParamList = append(sqlParamList, value)
+				sqlParamList = append(sqlParamList, entMetadata.conditionValue(name, value))
 			} else {
 				panic("Primary key parameter can not be empty.")
 			}
 		}
 	}
+	sqlParamList = entMetadata.writeTenantCondition(&sqlCondition, sqlParamList)
 	return  strings.TrimRight(sqlCondition.String(), " AND "), sqlParamList
 }
 
-// 构建INSERT SQL文
+// 构建INSERT SQL文(不生成主键, 需要生成主键时使用'InsertEntity')
 func (this *Orm) BuildSqlInsert(entity Entity) (string, []interface{}) {
 	entMetadata := GetEntityMetadata(entity)
 	var rftType reflect.Type
@@ -244,16 +294,23 @@ func (this *Orm) BuildSqlInsert(entity Entity) (string, []interface{}) {
 		rftValue = reflect.ValueOf(entity)
 	}
 
+	if err := entMetadata.validate(entity, true); err != nil {
+		panic(err)
+	}
+
 	var sqlItem bytes.Buffer
 	var sqlValue bytes.Buffer
 	sqlItem.WriteString("INSERT INTO ")
-	sqlItem.WriteString(entMetadata.Table)
+	sqlItem.WriteString(entMetadata.tableRef())
 	sqlItem.WriteString("(")
 	sqlValue.WriteString(") VALUES(")
 	var sqlParamList []interface{}
 	for i := 0; i < rftType.NumField(); i++ {
 		field := rftType.Field(i)
 		name := field.Name
+		if _, exist := entMetadata.Columns[name]; !exist || entMetadata.isTenantColumn(name) {
+			continue
+		}
 		typeName := field.Type.String()
 		column := entMetadata.Columns[name].Column
 		key := entMetadata.Columns[name].Key
@@ -263,13 +320,19 @@ func (this *Orm) BuildSqlInsert(entity Entity) (string, []interface{}) {
 			sqlItem.WriteString(column)
 			sqlItem.WriteString(",")
 			sqlValue.WriteString("?,")
-			sqlParamList = append(sqlParamList, value)
+			sqlParamList = append(sqlParamList, entMetadata.paramValue(name, value))
 		} else {
-			if key {
+			// 自增主键由数据库生成
+			if key && entMetadata.Columns[name].Generate != KeyAuto {
 				panic("Primary key value can not be empty.")
 			}
 		}
 	}
+	if entMetadata.Tenant.Mode == TenantSharedTable {
+		sqlItem.WriteString(entMetadata.Tenant.Column)
+		sqlValue.WriteString("?")
+		sqlParamList = append(sqlParamList, tenantParam{})
+	}
 	return  strings.TrimRight(sqlItem.String(),",") + strings.TrimRight(sqlValue.String(),",") + ")", append(sqlParamList)
 }
 
@@ -0,0 +1,268 @@
+package orm
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 检查规则名
+const (
+	RuleRequired = "required"
+	RuleLength   = "length"
+	RuleMin      = "min"
+	RuleMax      = "max"
+	RulePattern  = "pattern"
+	RuleType     = "type"
+)
+
+// 字段检查错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Column  string `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// 实体检查错误(BuildSqlInsert, BuildSqlUpdate以此panic)
+type ValidationError struct {
+	Table  string       `json:"table"`
+	Fields []FieldError `json:"fields"`
+}
+
+func (this *ValidationError) Error() string {
+	messages := make([]string, len(this.Fields))
+	for i, fieldError := range this.Fields {
+		messages[i] = fieldError.Field + " " + fieldError.Message
+	}
+	return fmt.Sprintf("validation failed: %s: %s", this.Table, strings.Join(messages, "; "))
+}
+
+// 按字段名获取检查错误
+func (this *ValidationError) Field(field string) (FieldError, bool) {
+	for _, fieldError := range this.Fields {
+		if fieldError.Field == field {
+			return fieldError, true
+		}
+	}
+	return FieldError{}, false
+}
+
+// 检查实体(插入时的检查), 无错误时返回nil
+func ValidateEntity(entity Entity) error {
+	if err := GetEntityMetadata(entity).validate(entity, true); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 检查实体: 插入时检查所有列, 更新时只检查更新的列(变更跟踪中为变更列, 否则为非NULL列)
+func (this EntityMetadata) validate(entity Entity, insert bool) *ValidationError {
+	_, rftValue := entityTypeValue(entity)
+	snapshot := trackedSnapshot(entity)
+	var fieldErrors []FieldError
+	for _, colMetadata := range this.OrderedColumns() {
+		if this.isTenantColumn(colMetadata.FieldId) {
+			continue
+		}
+		field := rftValue.Field(colMetadata.FieldIndex)
+		if !insert && snapshot != nil && reflect.DeepEqual(snapshot[colMetadata.FieldId], field.Interface()) {
+			continue
+		}
+		value, valid := fieldDriverValue(field)
+		if !valid {
+			// 自增主键由数据库生成, 序列主键在插入前取得, 非跟踪的更新不更新NULL字段
+			generated := colMetadata.Key && (colMetadata.Generate == KeyAuto || colMetadata.Generate == KeySequence)
+			required := colMetadata.NotNull && !generated
+			if required && (insert || snapshot != nil) {
+				fieldErrors = append(fieldErrors, colMetadata.fieldError(RuleRequired, "is required"))
+			}
+			continue
+		}
+		if rule, message := colMetadata.check(value); rule != "" {
+			fieldErrors = append(fieldErrors, colMetadata.fieldError(rule, message))
+		}
+	}
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	return &ValidationError{Table: this.Table, Fields: fieldErrors}
+}
+
+func (this ColumnMetadata) fieldError(rule string, message string) FieldError {
+	return FieldError{Field: this.FieldId, Column: this.Column, Rule: rule, Message: message}
+}
+
+// 按列类型及检查标签检查值, 返回违反的规则及消息
+func (this ColumnMetadata) check(value interface{}) (string, string) {
+	text, isText := value.(string)
+	if bytesValue, ok := value.([]byte); ok {
+		text, isText = string(bytesValue), true
+	}
+	number, isNumber := numberValue(value)
+
+	// 加密列的类型长度为密文长度, 只检查标签规则
+	if !this.Encrypted {
+		if rule, message := this.checkType(value, text, isText); rule != "" {
+			return rule, message
+		}
+	}
+	if this.Length > 0 && isText && utf8.RuneCountInString(text) > this.Length {
+		return RuleLength, fmt.Sprintf("exceeds maximum length %d", this.Length)
+	}
+	if this.Min != nil && isNumber && number < *this.Min {
+		return RuleMin, "must be at least " + strconv.FormatFloat(*this.Min, 'f', -1, 64)
+	}
+	if this.Max != nil && isNumber && number > *this.Max {
+		return RuleMax, "must be at most " + strconv.FormatFloat(*this.Max, 'f', -1, 64)
+	}
+	if this.Pattern != nil && isText && !this.Pattern.MatchString(text) {
+		return RulePattern, "does not match pattern " + this.Pattern.String()
+	}
+	return "", ""
+}
+
+// 整数类型的范围
+var integerTypeRanges = map[string][2]int64{
+	"TINYINT":   {math.MinInt8, math.MaxInt8},
+	"SMALLINT":  {math.MinInt16, math.MaxInt16},
+	"MEDIUMINT": {-1 << 23, 1<<23 - 1},
+	"INT":       {math.MinInt32, math.MaxInt32},
+	"INTEGER":   {math.MinInt32, math.MaxInt32},
+}
+
+// 日期时间类型可接受的文本格式
+var dateLayouts = map[string][]string{
+	"DATE":      {"2006-01-02"},
+	"DATETIME":  {"2006-01-02 15:04:05", "2006-01-02T15:04:05Z07:00", "2006-01-02"},
+	"TIMESTAMP": {"2006-01-02 15:04:05", "2006-01-02T15:04:05Z07:00", "2006-01-02"},
+	"TIME":      {"15:04:05", "15:04"},
+}
+
+// 按声明的列类型检查(文本长度, 整数范围, 定点数位数, 日期格式)
+func (this ColumnMetadata) checkType(value interface{}, text string, isText bool) (string, string) {
+	baseType, args := parseColumnType(this.ColumnType)
+	switch baseType {
+	case "CHAR", "VARCHAR", "NCHAR", "NVARCHAR":
+		if len(args) > 0 && isText && utf8.RuneCountInString(text) > args[0] {
+			return RuleLength, fmt.Sprintf("exceeds maximum length %d of %s", args[0], this.ColumnType)
+		}
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER":
+		if i, ok := integerValue(value); ok {
+			bounds := integerTypeRanges[baseType]
+			if i < bounds[0] || i > bounds[1] {
+				return RuleType, "is out of range for " + baseType
+			}
+		}
+	case "DECIMAL", "NUMERIC":
+		if number, ok := numberValue(value); ok && len(args) > 0 {
+			scale := 0
+			if len(args) > 1 {
+				scale = args[1]
+			}
+			if math.Abs(number) >= math.Pow10(args[0]-scale) {
+				return RuleType, "is out of range for " + this.ColumnType
+			}
+		}
+	case "DATE", "DATETIME", "TIMESTAMP", "TIME":
+		if isText && !parsesAsDate(text, dateLayouts[baseType]) {
+			return RuleType, "is not a valid " + baseType
+		}
+	}
+	return "", ""
+}
+
+// 解析列类型(如'VARCHAR(50)'返回'VARCHAR'及[50])
+func parseColumnType(columnType string) (string, []int) {
+	baseType := strings.ToUpper(strings.TrimSpace(columnType))
+	var args []int
+	if i := strings.IndexByte(baseType, '('); i >= 0 && strings.HasSuffix(baseType, ")") {
+		for _, arg := range strings.Split(baseType[i+1:len(baseType)-1], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(arg)); err == nil {
+				args = append(args, n)
+			}
+		}
+		baseType = strings.TrimSpace(baseType[:i])
+	}
+	return baseType, args
+}
+
+func parsesAsDate(text string, layouts []string) bool {
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, text); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// 数值
+func numberValue(value interface{}) (float64, bool) {
+	if i, ok := integerValue(value); ok {
+		return float64(i), true
+	}
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// 解析检查标签('length', 'min', 'max', 'pattern')
+func parseValidationTag(table string, colMetadata *ColumnMetadata, name string, value string) {
+	invalid := func(err error) {
+		panic(fmt.Sprintf("invalid %s tag %q: %s.%s: %v", name, value, table, colMetadata.Column, err))
+	}
+	switch name {
+	case RuleLength:
+		length, err := strconv.Atoi(value)
+		if err != nil {
+			invalid(err)
+		}
+		colMetadata.Length = length
+	case RuleMin, RuleMax:
+		bound, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			invalid(err)
+		}
+		if name == RuleMin {
+			colMetadata.Min = &bound
+		} else {
+			colMetadata.Max = &bound
+		}
+	case RulePattern:
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			invalid(err)
+		}
+		colMetadata.Pattern = pattern
+	}
+}
+
+// 分割结构体标签(忽略引号中的',')
+func splitTag(tag string) []string {
+	var elements []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(tag); i++ {
+		switch c := tag[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			elements = append(elements, tag[start:i])
+			start = i + 1
+		}
+	}
+	return append(elements, tag[start:])
+}
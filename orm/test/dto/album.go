@@ -31,6 +31,8 @@ type AlbumDto struct {
 
 // '唱片基本信息表'表实体结构(SQL类型描述)
 type AlbumEntity struct {
+    // 变更跟踪
+    Tracker
     // 编号 
     Id sql.NullInt64 `name:"ID", type:"INT", comment:"编号", key:true, notnull:true`
     // 标题 
@@ -60,106 +62,21 @@ func (owner *AlbumEntity) TableName() string {
 
 // 从'map'创建
 func (owner *AlbumEntity) FromMap(src map[string]interface{}) *AlbumEntity {
-    var value interface{}
-    var exist bool
-    value,exist = src["Id"]
-    if exist {
-        owner.Id = sql.NullInt64{Int64:value.(int64), Valid:true}
-    }
-    value,exist = src["Title"]
-    if exist {
-        owner.Title = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["Artist"]
-    if exist {
-        owner.Artist = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["IssueDate"]
-    if exist {
-        if value != "" {
-            owner.IssueDate = sql.NullString{String:value.(string), Valid:true}
-        }
-    }
-    value,exist = src["Genre"]
-    if exist {
-        owner.Genre = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["CoverPhoto"]
-    if exist {
-        owner.CoverPhoto = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["CreateAuthor"]
-    if exist {
-        owner.CreateAuthor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["CreateDatetime"]
-    if exist {
-        owner.CreateDatetime = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["UpdateAuthor"]
-    if exist {
-        owner.UpdateAuthor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["UpdateDatetime"]
-    if exist {
-        owner.UpdateDatetime = sql.NullString{String:value.(string), Valid:true}
+    if err := MapToEntity(src, owner); err != nil {
+        panic(err)
     }
     return owner
 }
 
 // 变换为'map'
 func (owner *AlbumEntity) ToMap() map[string]interface{} {
-    tar := make(map[string]interface{})
-    if owner.Id.Valid {
-        tar["Id"] = owner.Id.Int64
-    }
-    if owner.Title.Valid {
-        tar["Title"] = owner.Title.String
-    }
-    if owner.Artist.Valid {
-        tar["Artist"] = owner.Artist.String
-    }
-    if owner.IssueDate.Valid {
-        tar["IssueDate"] = owner.IssueDate.String
-    }
-    if owner.Genre.Valid {
-        tar["Genre"] = owner.Genre.String
-    }
-    if owner.CoverPhoto.Valid {
-        tar["CoverPhoto"] = owner.CoverPhoto.String
-    }
-    if owner.CreateAuthor.Valid {
-        tar["CreateAuthor"] = owner.CreateAuthor.String
-    }
-    if owner.CreateDatetime.Valid {
-        tar["CreateDatetime"] = owner.CreateDatetime.String
-    }
-    if owner.UpdateAuthor.Valid {
-        tar["UpdateAuthor"] = owner.UpdateAuthor.String
-    }
-    if owner.UpdateDatetime.Valid {
-        tar["UpdateDatetime"] = owner.UpdateDatetime.String
-    }
-    return tar
+    return EntityToMap(owner)
 }
 
 // 从'AlbumDto'创建
 func (owner *AlbumEntity) FromDto(src AlbumDto) *AlbumEntity {
-    owner.Id = sql.NullInt64{Int64:src.Id, Valid:true}
-    owner.Title = sql.NullString{String:src.Title, Valid:true}
-    owner.Artist = sql.NullString{String:src.Artist, Valid:true}
-    if src.IssueDate != "" {
-        owner.IssueDate = sql.NullString{String:src.IssueDate, Valid:true}
-    }
-    owner.Genre = sql.NullString{String:src.Genre, Valid:true}
-    owner.CoverPhoto = sql.NullString{String:src.CoverPhoto, Valid:true}
-    owner.CreateAuthor = sql.NullString{String:src.CreateAuthor, Valid:true}
-    if src.CreateDatetime != "" {
-        owner.CreateDatetime = sql.NullString{String:src.CreateDatetime, Valid:true}
-    }
-    owner.UpdateAuthor = sql.NullString{String:src.UpdateAuthor, Valid:true}
-    if src.CreateDatetime != "" {
-        owner.UpdateDatetime = sql.NullString{String:src.UpdateDatetime, Valid:true}
+    if err := DtoToEntity(src, owner); err != nil {
+        panic(err)
     }
     return owner
 }
@@ -167,16 +84,9 @@ func (owner *AlbumEntity) FromDto(src AlbumDto) *AlbumEntity {
 // 变换为'AlbumDto'
 func (owner *AlbumEntity) ToDto() AlbumDto {
     var tar AlbumDto
-    tar.Id = owner.Id.Int64
-    tar.Title = owner.Title.String
-    tar.Artist = owner.Artist.String
-    tar.IssueDate = owner.IssueDate.String
-    tar.Genre = owner.Genre.String
-    tar.CoverPhoto = owner.CoverPhoto.String
-    tar.CreateAuthor = owner.CreateAuthor.String
-    tar.CreateDatetime = owner.CreateDatetime.String
-    tar.UpdateAuthor = owner.UpdateAuthor.String
-    tar.UpdateDatetime = owner.UpdateDatetime.String
+    if err := EntityToDto(owner, &tar); err != nil {
+        panic(err)
+    }
     return tar
 }
 
@@ -194,6 +104,11 @@ func (owner *AlbumEntity) Retrieve(ctx OrmContext, orderBy ...OrderByCondition)
     return nl
 }
 
+// 主键查询(启用实体缓存时优先读取缓存)
+func (owner *AlbumEntity) Find(ctx OrmContext) bool {
+    return GetDao().Find(ctx, owner)
+}
+
 // 查询(使用map类型参数查询)
 func (owner *AlbumEntity) RetrieveByMap(ctx OrmContext, param map[string]interface{}, orderBy ...OrderByCondition) []AlbumEntity {
     return owner.FromMap(param).Retrieve(ctx,orderBy[:]...)
@@ -207,14 +122,12 @@ func (owner *AlbumEntity) Count(ctx OrmContext) int64 {
 
 // 登录
 func (owner *AlbumEntity) Insert(ctx OrmContext) int64 {
-    sqlText, sqlParams := GetDao().BuildSqlInsert(owner)
-    return GetDao().Insert(ctx, sqlText, sqlParams[:]...)
+    return GetDao().InsertEntity(ctx, owner)
 }
 
 // 更新
 func (owner *AlbumEntity) Update(ctx OrmContext) int64 {
-    sqlText, sqlParams := GetDao().BuildSqlUpdate(owner)
-    return GetDao().Update(ctx, sqlText, sqlParams[:]...)
+    return GetDao().UpdateEntity(ctx, owner)
 }
 
 // 删除
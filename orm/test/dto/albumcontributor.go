@@ -27,6 +27,8 @@ type AlbumContributorDto struct {
 
 // '参加该唱片录音的艺术家信息管理表'表实体结构(SQL类型描述)
 type AlbumContributorEntity struct {
+    // 变更跟踪
+    Tracker
     // 唱片编号 
     AlbumId sql.NullInt64 `name:"ALBUM_ID", type:"INT", comment:"唱片编号", key:true, notnull:true`
     // 参与曲目 
@@ -52,86 +54,21 @@ func (owner *AlbumContributorEntity) TableName() string {
 
 // 从'map'创建
 func (owner *AlbumContributorEntity) FromMap(src map[string]interface{}) *AlbumContributorEntity {
-    var value interface{}
-    var exist bool
-    value,exist = src["AlbumId"]
-    if exist {
-        owner.AlbumId = sql.NullInt64{Int64:value.(int64), Valid:true}
-    }
-    value,exist = src["TrackNo"]
-    if exist {
-        owner.TrackNo = sql.NullInt64{Int64:value.(int64), Valid:true}
-    }
-    value,exist = src["Contributor"]
-    if exist {
-        owner.Contributor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["Comment"]
-    if exist {
-        owner.Comment = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["CreateAuthor"]
-    if exist {
-        owner.CreateAuthor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["CreateDatetime"]
-    if exist {
-        owner.CreateDatetime = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["UpdateAuthor"]
-    if exist {
-        owner.UpdateAuthor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["UpdateDatetime"]
-    if exist {
-        owner.UpdateDatetime = sql.NullString{String:value.(string), Valid:true}
+    if err := MapToEntity(src, owner); err != nil {
+        panic(err)
     }
     return owner
 }
 
 // 变换为'map'
 func (owner *AlbumContributorEntity) ToMap() map[string]interface{} {
-    tar := make(map[string]interface{})
-    if owner.AlbumId.Valid {
-        tar["AlbumId"] = owner.AlbumId.Int64
-    }
-    if owner.TrackNo.Valid {
-        tar["TrackNo"] = owner.TrackNo.Int64
-    }
-    if owner.Contributor.Valid {
-        tar["Contributor"] = owner.Contributor.String
-    }
-    if owner.Comment.Valid {
-        tar["Comment"] = owner.Comment.String
-    }
-    if owner.CreateAuthor.Valid {
-        tar["CreateAuthor"] = owner.CreateAuthor.String
-    }
-    if owner.CreateDatetime.Valid {
-        tar["CreateDatetime"] = owner.CreateDatetime.String
-    }
-    if owner.UpdateAuthor.Valid {
-        tar["UpdateAuthor"] = owner.UpdateAuthor.String
-    }
-    if owner.UpdateDatetime.Valid {
-        tar["UpdateDatetime"] = owner.UpdateDatetime.String
-    }
-    return tar
+    return EntityToMap(owner)
 }
 
 // 从'AlbumContributorDto'创建
 func (owner *AlbumContributorEntity) FromDto(src AlbumContributorDto) *AlbumContributorEntity {
-    owner.AlbumId = sql.NullInt64{Int64:src.AlbumId, Valid:true}
-    owner.TrackNo = sql.NullInt64{Int64:src.TrackNo, Valid:true}
-    owner.Contributor = sql.NullString{String:src.Contributor, Valid:true}
-    owner.Comment = sql.NullString{String:src.Comment, Valid:true}
-    owner.CreateAuthor = sql.NullString{String:src.CreateAuthor, Valid:true}
-    if src.CreateDatetime != "" {
-        owner.CreateDatetime = sql.NullString{String:src.CreateDatetime, Valid:true}
-    }
-    owner.UpdateAuthor = sql.NullString{String:src.UpdateAuthor, Valid:true}
-    if src.CreateDatetime != "" {
-        owner.UpdateDatetime = sql.NullString{String:src.UpdateDatetime, Valid:true}
+    if err := DtoToEntity(src, owner); err != nil {
+        panic(err)
     }
     return owner
 }
@@ -139,14 +76,9 @@ func (owner *AlbumContributorEntity) FromDto(src AlbumContributorDto) *AlbumCont
 // 变换为'AlbumContributorDto'
 func (owner *AlbumContributorEntity) ToDto() AlbumContributorDto {
     var tar AlbumContributorDto
-    tar.AlbumId = owner.AlbumId.Int64
-    tar.TrackNo = owner.TrackNo.Int64
-    tar.Contributor = owner.Contributor.String
-    tar.Comment = owner.Comment.String
-    tar.CreateAuthor = owner.CreateAuthor.String
-    tar.CreateDatetime = owner.CreateDatetime.String
-    tar.UpdateAuthor = owner.UpdateAuthor.String
-    tar.UpdateDatetime = owner.UpdateDatetime.String
+    if err := EntityToDto(owner, &tar); err != nil {
+        panic(err)
+    }
     return tar
 }
 
@@ -164,6 +96,11 @@ func (owner *AlbumContributorEntity) Retrieve(ctx OrmContext, orderBy ...OrderBy
     return nl
 }
 
+// 主键查询(启用实体缓存时优先读取缓存)
+func (owner *AlbumContributorEntity) Find(ctx OrmContext) bool {
+    return GetDao().Find(ctx, owner)
+}
+
 // 查询(使用map类型参数查询)
 func (owner *AlbumContributorEntity) RetrieveByMap(ctx OrmContext, param map[string]interface{}, orderBy ...OrderByCondition) []AlbumContributorEntity {
     return owner.FromMap(param).Retrieve(ctx,orderBy[:]...)
@@ -177,14 +114,12 @@ func (owner *AlbumContributorEntity) Count(ctx OrmContext) int64 {
 
 // 登录
 func (owner *AlbumContributorEntity) Insert(ctx OrmContext) int64 {
-    sqlText, sqlParams := GetDao().BuildSqlInsert(owner)
-    return GetDao().Insert(ctx, sqlText, sqlParams[:]...)
+    return GetDao().InsertEntity(ctx, owner)
 }
 
 // 更新
 func (owner *AlbumContributorEntity) Update(ctx OrmContext) int64 {
-    sqlText, sqlParams := GetDao().BuildSqlUpdate(owner)
-    return GetDao().Update(ctx, sqlText, sqlParams[:]...)
+    return GetDao().UpdateEntity(ctx, owner)
 }
 
 // 删除
@@ -25,6 +25,8 @@ type AlbumGenreDto struct {
 
 // '唱片风格分类描述表'表实体结构(SQL类型描述)
 type AlbumGenreEntity struct {
+    // 变更跟踪
+    Tracker
     // 风格编码 
     GenreId sql.NullString `name:"GENRE_ID", type:"CHAR", comment:"风格编码", key:true, notnull:true`
     // 风格名称 
@@ -48,78 +50,21 @@ func (owner *AlbumGenreEntity) TableName() string {
 
 // 从'map'创建
 func (owner *AlbumGenreEntity) FromMap(src map[string]interface{}) *AlbumGenreEntity {
-    var value interface{}
-    var exist bool
-    value,exist = src["GenreId"]
-    if exist {
-        owner.GenreId = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["GenreName"]
-    if exist {
-        owner.GenreName = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["Comment"]
-    if exist {
-        owner.Comment = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["CreateAuthor"]
-    if exist {
-        owner.CreateAuthor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["CreateDatetime"]
-    if exist {
-        owner.CreateDatetime = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["UpdateAuthor"]
-    if exist {
-        owner.UpdateAuthor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["UpdateDatetime"]
-    if exist {
-        owner.UpdateDatetime = sql.NullString{String:value.(string), Valid:true}
+    if err := MapToEntity(src, owner); err != nil {
+        panic(err)
     }
     return owner
 }
 
 // 变换为'map'
 func (owner *AlbumGenreEntity) ToMap() map[string]interface{} {
-    tar := make(map[string]interface{})
-    if owner.GenreId.Valid {
-        tar["GenreId"] = owner.GenreId.String
-    }
-    if owner.GenreName.Valid {
-        tar["GenreName"] = owner.GenreName.String
-    }
-    if owner.Comment.Valid {
-        tar["Comment"] = owner.Comment.String
-    }
-    if owner.CreateAuthor.Valid {
-        tar["CreateAuthor"] = owner.CreateAuthor.String
-    }
-    if owner.CreateDatetime.Valid {
-        tar["CreateDatetime"] = owner.CreateDatetime.String
-    }
-    if owner.UpdateAuthor.Valid {
-        tar["UpdateAuthor"] = owner.UpdateAuthor.String
-    }
-    if owner.UpdateDatetime.Valid {
-        tar["UpdateDatetime"] = owner.UpdateDatetime.String
-    }
-    return tar
+    return EntityToMap(owner)
 }
 
 // 从'AlbumGenreDto'创建
 func (owner *AlbumGenreEntity) FromDto(src AlbumGenreDto) *AlbumGenreEntity {
-    owner.GenreId = sql.NullString{String:src.GenreId, Valid:true}
-    owner.GenreName = sql.NullString{String:src.GenreName, Valid:true}
-    owner.Comment = sql.NullString{String:src.Comment, Valid:true}
-    owner.CreateAuthor = sql.NullString{String:src.CreateAuthor, Valid:true}
-    if src.CreateDatetime != "" {
-        owner.CreateDatetime = sql.NullString{String:src.CreateDatetime, Valid:true}
-    }
-    owner.UpdateAuthor = sql.NullString{String:src.UpdateAuthor, Valid:true}
-    if src.CreateDatetime != "" {
-        owner.UpdateDatetime = sql.NullString{String:src.UpdateDatetime, Valid:true}
+    if err := DtoToEntity(src, owner); err != nil {
+        panic(err)
     }
     return owner
 }
@@ -127,13 +72,9 @@ func (owner *AlbumGenreEntity) FromDto(src AlbumGenreDto) *AlbumGenreEntity {
 // 变换为'AlbumGenreDto'
 func (owner *AlbumGenreEntity) ToDto() AlbumGenreDto {
     var tar AlbumGenreDto
-    tar.GenreId = owner.GenreId.String
-    tar.GenreName = owner.GenreName.String
-    tar.Comment = owner.Comment.String
-    tar.CreateAuthor = owner.CreateAuthor.String
-    tar.CreateDatetime = owner.CreateDatetime.String
-    tar.UpdateAuthor = owner.UpdateAuthor.String
-    tar.UpdateDatetime = owner.UpdateDatetime.String
+    if err := EntityToDto(owner, &tar); err != nil {
+        panic(err)
+    }
     return tar
 }
 
@@ -151,6 +92,11 @@ func (owner *AlbumGenreEntity) Retrieve(ctx OrmContext, orderBy ...OrderByCondit
     return nl
 }
 
+// 主键查询(启用实体缓存时优先读取缓存)
+func (owner *AlbumGenreEntity) Find(ctx OrmContext) bool {
+    return GetDao().Find(ctx, owner)
+}
+
 // 查询(使用map类型参数查询)
 func (owner *AlbumGenreEntity) RetrieveByMap(ctx OrmContext, param map[string]interface{}, orderBy ...OrderByCondition) []AlbumGenreEntity {
     return owner.FromMap(param).Retrieve(ctx,orderBy[:]...)
@@ -164,14 +110,12 @@ func (owner *AlbumGenreEntity) Count(ctx OrmContext) int64 {
 
 // 登录
 func (owner *AlbumGenreEntity) Insert(ctx OrmContext) int64 {
-    sqlText, sqlParams := GetDao().BuildSqlInsert(owner)
-    return GetDao().Insert(ctx, sqlText, sqlParams[:]...)
+    return GetDao().InsertEntity(ctx, owner)
 }
 
 // 更新
 func (owner *AlbumGenreEntity) Update(ctx OrmContext) int64 {
-    sqlText, sqlParams := GetDao().BuildSqlUpdate(owner)
-    return GetDao().Update(ctx, sqlText, sqlParams[:]...)
+    return GetDao().UpdateEntity(ctx, owner)
 }
 
 // 删除
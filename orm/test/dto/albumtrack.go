@@ -27,6 +27,8 @@ type AlbumTrackDto struct {
 
 // '唱片曲目信息表'表实体结构(SQL类型描述)
 type AlbumTrackEntity struct {
+    // 变更跟踪
+    Tracker
     // 所属唱片 
     AlbumId sql.NullInt64 `name:"ALBUM_ID", type:"INT", comment:"所属唱片", key:true, notnull:true`
     // 曲目编号 
@@ -52,86 +54,21 @@ func (owner *AlbumTrackEntity) TableName() string {
 
 // 从'map'创建
 func (owner *AlbumTrackEntity) FromMap(src map[string]interface{}) *AlbumTrackEntity {
-    var value interface{}
-    var exist bool
-    value,exist = src["AlbumId"]
-    if exist {
-        owner.AlbumId = sql.NullInt64{Int64:value.(int64), Valid:true}
-    }
-    value,exist = src["TrackNo"]
-    if exist {
-        owner.TrackNo = sql.NullInt64{Int64:value.(int64), Valid:true}
-    }
-    value,exist = src["TrackName"]
-    if exist {
-        owner.TrackName = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["PlayTime"]
-    if exist {
-        owner.PlayTime = sql.NullFloat64{Float64:value.(float64), Valid:true}
-    }
-    value,exist = src["CreateAuthor"]
-    if exist {
-        owner.CreateAuthor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["CreateDatetime"]
-    if exist {
-        owner.CreateDatetime = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["UpdateAuthor"]
-    if exist {
-        owner.UpdateAuthor = sql.NullString{String:value.(string), Valid:true}
-    }
-    value,exist = src["UpdateDatetime"]
-    if exist {
-        owner.UpdateDatetime = sql.NullString{String:value.(string), Valid:true}
+    if err := MapToEntity(src, owner); err != nil {
+        panic(err)
     }
     return owner
 }
 
 // 变换为'map'
 func (owner *AlbumTrackEntity) ToMap() map[string]interface{} {
-    tar := make(map[string]interface{})
-    if owner.AlbumId.Valid {
-        tar["AlbumId"] = owner.AlbumId.Int64
-    }
-    if owner.TrackNo.Valid {
-        tar["TrackNo"] = owner.TrackNo.Int64
-    }
-    if owner.TrackName.Valid {
-        tar["TrackName"] = owner.TrackName.String
-    }
-    if owner.PlayTime.Valid {
-        tar["PlayTime"] = owner.PlayTime.Float64
-    }
-    if owner.CreateAuthor.Valid {
-        tar["CreateAuthor"] = owner.CreateAuthor.String
-    }
-    if owner.CreateDatetime.Valid {
-        tar["CreateDatetime"] = owner.CreateDatetime.String
-    }
-    if owner.UpdateAuthor.Valid {
-        tar["UpdateAuthor"] = owner.UpdateAuthor.String
-    }
-    if owner.UpdateDatetime.Valid {
-        tar["UpdateDatetime"] = owner.UpdateDatetime.String
-    }
-    return tar
+    return EntityToMap(owner)
 }
 
 // 从'AlbumTrackDto'创建
 func (owner *AlbumTrackEntity) FromDto(src AlbumTrackDto) *AlbumTrackEntity {
-    owner.AlbumId = sql.NullInt64{Int64:src.AlbumId, Valid:true}
-    owner.TrackNo = sql.NullInt64{Int64:src.TrackNo, Valid:true}
-    owner.TrackName = sql.NullString{String:src.TrackName, Valid:true}
-    owner.PlayTime = sql.NullFloat64{Float64:src.PlayTime, Valid:true}
-    owner.CreateAuthor = sql.NullString{String:src.CreateAuthor, Valid:true}
-    if src.CreateDatetime != "" {
-        owner.CreateDatetime = sql.NullString{String:src.CreateDatetime, Valid:true}
-    }
-    owner.UpdateAuthor = sql.NullString{String:src.UpdateAuthor, Valid:true}
-    if src.CreateDatetime != "" {
-        owner.UpdateDatetime = sql.NullString{String:src.UpdateDatetime, Valid:true}
+    if err := DtoToEntity(src, owner); err != nil {
+        panic(err)
     }
     return owner
 }
@@ -139,14 +76,9 @@ func (owner *AlbumTrackEntity) FromDto(src AlbumTrackDto) *AlbumTrackEntity {
 // 变换为'AlbumTrackDto'
 func (owner *AlbumTrackEntity) ToDto() AlbumTrackDto {
     var tar AlbumTrackDto
-    tar.AlbumId = owner.AlbumId.Int64
-    tar.TrackNo = owner.TrackNo.Int64
-    tar.TrackName = owner.TrackName.String
-    tar.PlayTime = owner.PlayTime.Float64
-    tar.CreateAuthor = owner.CreateAuthor.String
-    tar.CreateDatetime = owner.CreateDatetime.String
-    tar.UpdateAuthor = owner.UpdateAuthor.String
-    tar.UpdateDatetime = owner.UpdateDatetime.String
+    if err := EntityToDto(owner, &tar); err != nil {
+        panic(err)
+    }
     return tar
 }
 
@@ -164,6 +96,11 @@ func (owner *AlbumTrackEntity) Retrieve(ctx OrmContext, orderBy ...OrderByCondit
     return nl
 }
 
+// 主键查询(启用实体缓存时优先读取缓存)
+func (owner *AlbumTrackEntity) Find(ctx OrmContext) bool {
+    return GetDao().Find(ctx, owner)
+}
+
 // 查询(使用map类型参数查询)
 func (owner *AlbumTrackEntity) RetrieveByMap(ctx OrmContext, param map[string]interface{}, orderBy ...OrderByCondition) []AlbumTrackEntity {
     return owner.FromMap(param).Retrieve(ctx,orderBy[:]...)
@@ -177,14 +114,12 @@ func (owner *AlbumTrackEntity) Count(ctx OrmContext) int64 {
 
 // 登录
 func (owner *AlbumTrackEntity) Insert(ctx OrmContext) int64 {
-    sqlText, sqlParams := GetDao().BuildSqlInsert(owner)
-    return GetDao().Insert(ctx, sqlText, sqlParams[:]...)
+    return GetDao().InsertEntity(ctx, owner)
 }
 
 // 更新
 func (owner *AlbumTrackEntity) Update(ctx OrmContext) int64 {
-    sqlText, sqlParams := GetDao().BuildSqlUpdate(owner)
-    return GetDao().Update(ctx, sqlText, sqlParams[:]...)
+    return GetDao().UpdateEntity(ctx, owner)
 }
 
 // 删除
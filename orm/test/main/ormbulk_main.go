@@ -0,0 +1,26 @@
+package main
+
+// 测试实体的批量导入导出命令(参照'ormbulk'包)
+//
+//	ormbulk export -table ALBUM -format csv -header comment -out album.csv
+//	ormbulk import -table ALBUM -format ndjson -in album.ndjson -upsert -dry-run
+import (
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/umeframework/gear/orm/ormbulk"
+	"github.com/umeframework/gear/orm/test/dto"
+)
+
+func main() {
+	command := ormbulk.NewCommand(
+		&dto.AlbumEntity{},
+		&dto.AlbumContributorEntity{},
+		&dto.AlbumGenreEntity{},
+		&dto.AlbumTrackEntity{},
+	)
+	if err := command.Run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
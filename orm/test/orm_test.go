@@ -93,5 +93,3 @@ func testUpdate(ctx orm.OrmContext) {
         fmt.Println(e)
     }
 }
-
-
@@ -0,0 +1,178 @@
+package test
+
+import (
+    "bytes"
+    "database/sql"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormbulk"
+    "github.com/umeframework/gear/orm/ormtest"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+func TestBulkExportImport(t *testing.T) {
+    h := ormtest.New(t, &AlbumEntity{}, &AlbumTrackEntity{})
+    h.MustLoadFixtures(t, h.Context(), "fixtures")
+    dao := &orm.Orm{}
+
+    // 导出CSV(列注释作为标题)
+    var out bytes.Buffer
+    count, err := dao.Export(h.Context(), &AlbumEntity{}, &out, orm.ExportOption{
+        Format: orm.FormatCSV,
+        Header: orm.HeaderComment,
+        Fields: []string{"Id", "Title", "Genre"},
+    }, orm.OrderByCondition{Name: "ID"})
+    if err != nil || count != 3 {
+        t.Fatalf("export: count = %d, err = %v", count, err)
+    }
+    lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+    if lines[0] != "编号,标题,风格" || lines[1] != "1,Ten Summoner's Tales,1" {
+        t.Errorf("unexpected csv: %q", out.String())
+    }
+
+    // 导出NDJSON
+    out.Reset()
+    if _, err = dao.Export(h.Context(), &AlbumTrackEntity{AlbumId: sql.NullInt64{Int64: 2, Valid: true}}, &out, orm.ExportOption{
+        Format: orm.FormatNDJSON,
+        Fields: []string{"AlbumId", "TrackNo"},
+    }); err != nil {
+        t.Fatal(err)
+    }
+    if strings.TrimSpace(out.String()) != `{"ALBUM_ID":2,"TRACK_NO":1}` {
+        t.Errorf("unexpected ndjson: %q", out.String())
+    }
+
+    // 导入CSV: 第3行缺少必须列, 第4行格式错误
+    csvText := "ID,TITLE,ARTIST\n" +
+        "10,Soul Cages,Sting\n" +
+        "11,,\n" +
+        "12,Mercury Falling\n" +
+        "13,Sacred Love,Sting\n"
+    h.Run(t, "csv", func(t *testing.T, ctx orm.OrmContext) {
+        report, err := dao.Import(ctx, &AlbumEntity{}, strings.NewReader(csvText), orm.ImportOption{
+            Format:   orm.FormatCSV,
+            NullText: "",
+            Policy:   &orm.ConvertPolicy{Default: orm.EmptyStringAsNull},
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+        if report.Total != 4 || report.Succeeded != 2 || report.Failed != 2 {
+            t.Fatalf("unexpected report: %+v", report)
+        }
+        if report.Errors[0].Line != 3 || report.Errors[1].Line != 4 {
+            t.Errorf("unexpected error lines: %+v", report.Errors)
+        }
+        ormtest.AssertRowCount(t, ctx, &AlbumEntity{}, 5)
+    })
+
+    // 导入NDJSON: 主键重复的行出错, upsert时更新
+    ndjson := `{"Id":1,"Title":"Ten Summoner's Tales (Remastered)","Artist":"Sting"}` + "\n" +
+        `{"Id":20,"Title":"57th & 9th","Artist":"Sting"}` + "\n"
+    h.Run(t, "duplicate", func(t *testing.T, ctx orm.OrmContext) {
+        report, err := dao.Import(ctx, &AlbumEntity{}, strings.NewReader(ndjson), orm.ImportOption{Format: orm.FormatNDJSON})
+        if err != nil {
+            t.Fatal(err)
+        }
+        if report.Succeeded != 1 || report.Failed != 1 || report.Errors[0].Line != 1 {
+            t.Fatalf("unexpected report: %+v", report)
+        }
+    })
+    h.Run(t, "upsert", func(t *testing.T, ctx orm.OrmContext) {
+        report, err := dao.Import(ctx, &AlbumEntity{}, strings.NewReader(ndjson), orm.ImportOption{Format: orm.FormatNDJSON, Upsert: true})
+        if err != nil || report.Succeeded != 2 {
+            t.Fatalf("report = %+v, err = %v", report, err)
+        }
+        ormtest.AssertEntityExists(t, ctx, &AlbumEntity{
+            Id:    sql.NullInt64{Int64: 1, Valid: true},
+            Title: sql.NullString{String: "Ten Summoner's Tales (Remastered)", Valid: true},
+        })
+        ormtest.AssertRowCount(t, ctx, &AlbumEntity{}, 4)
+    })
+
+    // dry-run不写入数据库
+    report, err := dao.Import(h.Context(), &AlbumEntity{}, strings.NewReader(ndjson), orm.ImportOption{Format: orm.FormatNDJSON, DryRun: true})
+    if err != nil || report.Succeeded != 2 {
+        t.Fatalf("report = %+v, err = %v", report, err)
+    }
+    ormtest.AssertRowCount(t, h.Context(), &AlbumEntity{}, 3)
+}
+
+func TestBulkErrors(t *testing.T) {
+    dao := &orm.Orm{}
+
+    // 查询失败作为错误返回
+    h := ormtest.New(t, &AlbumEntity{})
+    var out bytes.Buffer
+    if _, err := dao.Export(h.Context(), &AlbumGenreEntity{}, &out, orm.ExportOption{}); err == nil {
+        t.Errorf("export of missing table should return error")
+    }
+
+    // 事务中批量插入失败时回滚至保存点后逐行插入
+    fake := ormtest.NewFake(t, "postgres")
+    dupErr := errors.New("duplicate key")
+    fake.ExpectBegin()
+    fake.ExpectExec("SAVEPOINT ORM_BULK_IMPORT")
+    fake.ExpectExec("").WillReturnError(dupErr)
+    fake.ExpectExec("ROLLBACK TO SAVEPOINT ORM_BULK_IMPORT")
+    fake.ExpectExec("SAVEPOINT ORM_BULK_IMPORT")
+    fake.ExpectExec("").WillReturnError(dupErr)
+    fake.ExpectExec("ROLLBACK TO SAVEPOINT ORM_BULK_IMPORT")
+    fake.ExpectExec("SAVEPOINT ORM_BULK_IMPORT")
+    fake.ExpectExec("").WillReturnResult(0, 1)
+    fake.ExpectExec("RELEASE SAVEPOINT ORM_BULK_IMPORT")
+    fake.ExpectRollback()
+    ctx := fake.Context()
+    txCtx, err := ctx.Begin()
+    if err != nil {
+        t.Fatal(err)
+    }
+    ndjson := `{"Id":1,"Title":"Ten Summoner's Tales","Artist":"Sting"}` + "\n" +
+        `{"Id":20,"Title":"57th & 9th","Artist":"Sting"}` + "\n"
+    report, err := dao.Import(txCtx, &AlbumEntity{}, strings.NewReader(ndjson), orm.ImportOption{Format: orm.FormatNDJSON})
+    txCtx.Rollback()
+    if err != nil || report.Succeeded != 1 || report.Failed != 1 || report.Errors[0].Line != 1 {
+        t.Fatalf("report = %+v, err = %v", report, err)
+    }
+    if err = fake.ExpectationsWereMet(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestBulkCommand(t *testing.T) {
+    h := ormtest.New(t, &AlbumEntity{})
+    h.MustLoadFixtures(t, h.Context(), "fixtures")
+    var stdout, stderr bytes.Buffer
+    command := ormbulk.NewCommand(&AlbumEntity{}, &AlbumTrackEntity{})
+    command.Open = func(config string) (orm.OrmContext, error) {
+        return h.Context(), nil
+    }
+    command.Stdout = &stdout
+    command.Stderr = &stderr
+
+    if err := command.Run([]string{"export", "-table", "album", "-format", "ndjson", "-fields", "Id,Title"}); err != nil {
+        t.Fatal(err)
+    }
+    if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 3 {
+        t.Errorf("unexpected export: %q", stdout.String())
+    }
+
+    command.Stdin = strings.NewReader("ID,TITLE,ARTIST\n30,Brand New Day,Sting\n")
+    if err := command.Run([]string{"import", "-table", "ALBUM"}); err != nil {
+        t.Fatal(err)
+    }
+    ormtest.AssertRowCount(t, h.Context(), &AlbumEntity{}, 4)
+    if !strings.Contains(stderr.String(), "total 1, succeeded 1, failed 0") {
+        t.Errorf("unexpected report: %q", stderr.String())
+    }
+
+    if err := command.Run([]string{"export", "-table", "ALBUM_GENRE"}); err == nil || err.Error() != "unknown table: ALBUM_GENRE" {
+        t.Errorf("err = %v, expected unknown table", err)
+    }
+    if err := command.Run(nil); err == nil || err.Error() != ormbulk.Usage {
+        t.Errorf("err = %v, expected usage", err)
+    }
+}
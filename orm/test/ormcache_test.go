@@ -0,0 +1,236 @@
+package test
+
+import (
+    "database/sql"
+    "testing"
+    "time"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+func TestLruCache(t *testing.T) {
+    cache := orm.NewLruCache(2, 0)
+    cache.Set("ALBUM:key:1", 1, 0)
+    cache.Set("ALBUM:key:2", 2, 0)
+    // 读取后成为最近使用
+    if value, found := cache.Get("ALBUM:key:1"); !found || value != 1 {
+        t.Errorf("get = %v %v, expected 1", value, found)
+    }
+    cache.Set("ALBUM:key:3", 3, 0)
+    if _, found := cache.Get("ALBUM:key:2"); found {
+        t.Errorf("least recently used entry should be evicted")
+    }
+    if _, found := cache.Get("ALBUM:key:1"); !found {
+        t.Errorf("recently used entry should be kept")
+    }
+    if cache.Len() != 2 {
+        t.Errorf("len = %d, expected 2", cache.Len())
+    }
+
+    // 有效期
+    cache.Set("ALBUM:key:4", 4, 10*time.Millisecond)
+    if _, found := cache.Get("ALBUM:key:4"); !found {
+        t.Errorf("entry should not expire yet")
+    }
+    time.Sleep(20 * time.Millisecond)
+    if _, found := cache.Get("ALBUM:key:4"); found {
+        t.Errorf("entry should expire")
+    }
+    defaultTTL := orm.NewLruCache(0, 10*time.Millisecond)
+    defaultTTL.Set("ALBUM:key:1", 1, 0)
+    time.Sleep(20 * time.Millisecond)
+    if _, found := defaultTTL.Get("ALBUM:key:1"); found {
+        t.Errorf("entry should expire with default TTL")
+    }
+
+    cache.Set("ALBUM_GENRE:key:1", 1, 0)
+    cache.DeletePrefix("ALBUM:")
+    if _, found := cache.Get("ALBUM:key:1"); found || cache.Len() != 1 {
+        t.Errorf("entries of ALBUM should be deleted, len = %d", cache.Len())
+    }
+}
+
+func TestEntityCache(t *testing.T) {
+    h := ormtest.New(t, &AlbumGenreEntity{})
+    h.MustLoadFixtures(t, h.Context(), "fixtures")
+    ctx := h.Context()
+    dao := &orm.Orm{}
+
+    orm.SetCacheBackend(orm.NewLruCache(100, 0))
+    defer orm.SetCacheBackend(nil)
+    orm.SetEntityCache(&AlbumGenreEntity{}, orm.EntityCacheOption{Enabled: true, CacheQuery: true})
+    defer orm.SetEntityCache(&AlbumGenreEntity{}, orm.EntityCacheOption{})
+    orm.ClearCache()
+
+    assertStats := func(hits int64, misses int64, puts int64) {
+        t.Helper()
+        stats := orm.GetCacheStats(&AlbumGenreEntity{})
+        if stats.Hits != hits || stats.Misses != misses || stats.Puts != puts {
+            t.Errorf("stats = %+v, expected hits %d, misses %d, puts %d", stats, hits, misses, puts)
+        }
+    }
+    rock := func() *AlbumGenreEntity {
+        return &AlbumGenreEntity{GenreId: sql.NullString{String: "1", Valid: true}}
+    }
+
+    // 主键查询
+    for i := 0; i < 3; i++ {
+        e := rock()
+        if !e.Find(ctx) || e.GenreName.String != "Rock" {
+            t.Fatalf("unexpected entity: %+v", e)
+        }
+    }
+    assertStats(2, 1, 1)
+    // 'BuildSqlSelectOne'与'Retrieve'
+    e := rock()
+    sqlText, sqlParams := dao.BuildSqlSelectOne(e)
+    rows := dao.Retrieve(ctx, sqlText, sqlParams...)
+    if err := rows.DefaultMapping(e); err != nil || e.GenreName.String != "Rock" {
+        t.Fatalf("unexpected entity: %v %+v", err, e)
+    }
+    rows.Close()
+    assertStats(3, 1, 1)
+
+    // 查询结果集, 修改结果不影响缓存
+    list := (&AlbumGenreEntity{}).Retrieve(ctx)
+    list[0].GenreName.String = "Modified"
+    list = (&AlbumGenreEntity{}).Retrieve(ctx)
+    if len(list) != 2 || list[0].GenreName.String == "Modified" {
+        t.Errorf("unexpected list: %v", list)
+    }
+    assertStats(4, 2, 2)
+
+    // 更新后失效
+    e = rock()
+    e.Find(ctx)
+    e.GenreName = sql.NullString{String: "Rock'n'Roll", Valid: true}
+    e.Update(ctx)
+    if e = rock(); !e.Find(ctx) || e.GenreName.String != "Rock'n'Roll" {
+        t.Errorf("stale entity: %+v", e)
+    }
+    assertStats(5, 3, 3)
+    if stats := orm.GetCacheStats(e); stats.Invalidations != 1 {
+        t.Errorf("invalidations = %d, expected 1", stats.Invalidations)
+    }
+
+    // 事务中不使用缓存
+    h.Run(t, "transaction", func(t *testing.T, tx orm.OrmContext) {
+        if e := rock(); !e.Find(tx) {
+            t.Errorf("entity not found")
+        }
+        assertStats(5, 3, 3)
+    })
+
+    // 查询期间失效时不写入缓存
+    orm.ClearCache()
+    other := ormtest.New(t, &AlbumGenreEntity{})
+    invalidated := false
+    mapper := orm.NewSimpleCallbackMapper(func(entity interface{}) []interface{} {
+        if !invalidated {
+            invalidated = true
+            if _, err := ormtest.InsertRows(other.Context(), &AlbumGenreEntity{},
+                []map[string]interface{}{{"GenreId": "3", "GenreName": "Pop"}}); err != nil {
+                t.Fatal(err)
+            }
+        }
+        return (&AlbumGenreEntity{}).Mapper(entity)
+    })
+    e = rock()
+    sqlText, sqlParams = dao.BuildSqlSelectOne(e)
+    rows = dao.Retrieve(ctx, sqlText, sqlParams...)
+    if err := rows.MappingWith(e, mapper); err != nil {
+        t.Fatal(err)
+    }
+    rows.Close()
+    assertStats(0, 1, 0)
+    e = rock()
+    e.Find(ctx)
+    assertStats(0, 2, 1)
+}
+
+func TestEntityCacheParams(t *testing.T) {
+    h := ormtest.New(t, &AlbumGenreEntity{})
+    h.MustLoadFixtures(t, h.Context(), "fixtures")
+    ctx := h.Context()
+    dao := &orm.Orm{}
+
+    orm.SetCacheBackend(orm.NewLruCache(100, 0))
+    defer orm.SetCacheBackend(nil)
+    orm.SetEntityCache(&AlbumGenreEntity{}, orm.EntityCacheOption{Enabled: true})
+    defer orm.SetEntityCache(&AlbumGenreEntity{}, orm.EntityCacheOption{})
+    orm.ClearCache()
+
+    sqlText, _ := dao.BuildSqlSelectOne(&AlbumGenreEntity{GenreId: sql.NullString{String: "1", Valid: true}})
+    find := func(param interface{}) {
+        t.Helper()
+        e := &AlbumGenreEntity{}
+        rows := dao.Retrieve(ctx, sqlText, param)
+        defer rows.Close()
+        if err := rows.DefaultMapping(e); err != nil || e.GenreName.String != "Rock" {
+            t.Errorf("%T: unexpected entity: %v %+v", param, err, e)
+        }
+    }
+
+    // 参数以驱动值作为Key, 指针按指向的值
+    for i := 0; i < 2; i++ {
+        id := "1"
+        find(&id)
+    }
+    find(sql.NullString{String: "1", Valid: true})
+    // 值的文字相同但类型不同时不共用缓存
+    find(1)
+    stats := orm.GetCacheStats(&AlbumGenreEntity{})
+    if stats.Hits != 2 || stats.Misses != 2 {
+        t.Errorf("stats = %+v, expected hits 2, misses 2", stats)
+    }
+}
+
+// 含二进制字段的测试实体
+type cachedCover struct {
+    Id    sql.NullInt64 `name:"ID", type:"INT", comment:"编号", key:true, notnull:true`
+    Photo []byte        `name:"PHOTO", type:"BLOB", comment:"封面", key:false, notnull:false`
+}
+
+func (owner *cachedCover) TableName() string {
+    return "CACHED_COVER"
+}
+
+func TestEntityCacheBytes(t *testing.T) {
+    fake := ormtest.NewFake(t, "mysql")
+    ctx := fake.Context()
+    dao := &orm.Orm{}
+
+    orm.SetCacheBackend(orm.NewLruCache(100, 0))
+    defer orm.SetCacheBackend(nil)
+    orm.SetEntityCache(&cachedCover{}, orm.EntityCacheOption{Enabled: true})
+    defer orm.SetEntityCache(&cachedCover{}, orm.EntityCacheOption{})
+
+    find := func() *cachedCover {
+        t.Helper()
+        e := &cachedCover{Id: sql.NullInt64{Int64: 1, Valid: true}}
+        sqlText, sqlParams := dao.BuildSqlSelectOne(e)
+        rows := dao.Retrieve(ctx, sqlText, sqlParams...)
+        defer rows.Close()
+        if err := rows.DefaultMapping(e); err != nil {
+            t.Fatal(err)
+        }
+        return e
+    }
+
+    // 修改读取结果的'[]byte'不影响缓存
+    fake.ExpectQuery("").WithArgs(1).WillReturnRows([]string{"Id", "Photo"}, []interface{}{1, []byte("jpeg")})
+    find().Photo[0] = 'J'
+    cached := find()
+    if string(cached.Photo) != "jpeg" {
+        t.Errorf("photo = %s, expected jpeg", cached.Photo)
+    }
+    cached.Photo[0] = 'J'
+    if photo := find().Photo; string(photo) != "jpeg" {
+        t.Errorf("photo = %s, expected jpeg", photo)
+    }
+    if statements := fake.Statements(); len(statements) != 1 {
+        t.Errorf("statements = %v, expected one query", statements)
+    }
+}
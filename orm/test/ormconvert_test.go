@@ -0,0 +1,50 @@
+package test
+
+import (
+    "encoding/json"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+func TestConvert(t *testing.T) {
+    // JSON解码的数值为float64
+    var src map[string]interface{}
+    json.Unmarshal([]byte(`{"Id": 999, "Title": "Nothing Like The Sun", "IssueDate": ""}`), &src)
+    e := new(AlbumEntity)
+    if err := orm.MapToEntity(src, e); err != nil {
+        t.Fatal(err)
+    }
+    if !e.Id.Valid || e.Id.Int64 != 999 || e.Title.String != "Nothing Like The Sun" {
+        t.Errorf("unexpected entity: %+v", e)
+    }
+    // 日期类型的空字符串作为NULL
+    if e.IssueDate.Valid {
+        t.Errorf("IssueDate should be NULL")
+    }
+    if err := orm.MapToEntity(map[string]interface{}{"Id": 1.5}, e); err == nil {
+        t.Errorf("non-integer Id should be rejected")
+    }
+
+    d := AlbumDto{Id: 1, Title: "Ten Summoner's Tales", UpdateDatetime: "2018-01-01 00:00:00"}
+    e = new(AlbumEntity).FromDto(d)
+    if e.CreateDatetime.Valid || !e.UpdateDatetime.Valid {
+        t.Errorf("unexpected datetime: %v, %v", e.CreateDatetime, e.UpdateDatetime)
+    }
+    if e.ToDto() != d {
+        t.Errorf("dto round trip failed: %+v", e.ToDto())
+    }
+
+    policy := orm.ConvertPolicy{Default: orm.EmptyAsNull}
+    track := new(AlbumTrackEntity)
+    if err := orm.DtoToEntity(AlbumTrackDto{AlbumId: 1, TrackNo: 2}, track, policy); err != nil {
+        t.Fatal(err)
+    }
+    if track.TrackName.Valid || track.PlayTime.Valid || track.TrackNo.Int64 != 2 {
+        t.Errorf("unexpected track: %+v", track)
+    }
+    if m := track.ToMap(); len(m) != 2 || m["AlbumId"] != int64(1) {
+        t.Errorf("unexpected map: %v", m)
+    }
+}
@@ -0,0 +1,144 @@
+package test
+
+import (
+    "database/sql"
+    "encoding/base64"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+)
+
+// 含个人信息的测试实体
+type secretContributor struct {
+    orm.Tracker
+    Id    sql.NullInt64  `name:"ID", type:"INT", comment:"编号", key:true, notnull:true`
+    Name  sql.NullString `name:"NAME", type:"VARCHAR", comment:"姓名", key:false, notnull:false, mask:"name"`
+    Email sql.NullString `name:"EMAIL", type:"VARCHAR", comment:"邮件地址", key:false, notnull:false, encrypt:true, mask:"email"`
+}
+
+func (owner *secretContributor) TableName() string {
+    return "SECRET_CONTRIBUTOR"
+}
+
+type secretContributorDto struct {
+    Id    int64
+    Name  string
+    Email string
+}
+
+// 测试用配置
+type keyConfig map[string]string
+
+func (this keyConfig) Get(name string) string {
+    return this[name]
+}
+
+func (this keyConfig) KeySet() []string {
+    var keys []string
+    for key := range this {
+        keys = append(keys, key)
+    }
+    return keys
+}
+
+func TestEncryption(t *testing.T) {
+    key1 := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+    key2 := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+    if err := orm.ConfigureKeyring(keyConfig{orm.KeyringConfigPrefix + "key.k1": key1}); err != nil {
+        t.Fatal(err)
+    }
+    defer orm.SetKeyring(nil)
+    if current := orm.GetKeyring().Current(); current != "k1" {
+        t.Errorf("current = %s, expected k1", current)
+    }
+
+    h := ormtest.New(t, &secretContributor{})
+    ctx := h.Context()
+    dao := &orm.Orm{}
+    e := &secretContributor{
+        Id:    sql.NullInt64{Int64: 1, Valid: true},
+        Name:  sql.NullString{String: "Sting", Valid: true},
+        Email: sql.NullString{String: "sting@example.com", Valid: true},
+    }
+    sqlText, sqlParams := dao.BuildSqlInsert(e)
+    dao.Insert(ctx, sqlText, sqlParams...)
+    if stored := storedEmail(t, h, 1); !strings.HasPrefix(stored, "ENC:k1:") || strings.Contains(stored, "sting") {
+        t.Errorf("email should be encrypted: %s", stored)
+    }
+
+    // 读取时解密, 变换为DTO时默认输出原值, 指定Mask策略时掩码
+    found := &secretContributor{Id: e.Id}
+    if !dao.Find(ctx, found) || found.Email.String != "sting@example.com" {
+        t.Fatalf("unexpected entity: %+v", found)
+    }
+    var dto secretContributorDto
+    if err := orm.EntityToDto(found, &dto); err != nil {
+        t.Fatal(err)
+    }
+    if dto.Name != "Sting" || dto.Email != "sting@example.com" {
+        t.Errorf("dto should not be masked by default: %+v", dto)
+    }
+    policy := orm.GetDefaultConvertPolicy()
+    policy.Mask = true
+    if err := orm.EntityToDto(found, &dto, policy); err != nil {
+        t.Fatal(err)
+    }
+    if dto.Name != "S****" || dto.Email != "s****@example.com" {
+        t.Errorf("unexpected masked dto: %+v", dto)
+    }
+    masked := orm.MaskEntity([]*secretContributor{found}).([]*secretContributor)
+    if masked[0].Name.String != "S****" || found.Name.String != "Sting" {
+        t.Errorf("masking should not modify the original entity")
+    }
+
+    // 输出掩码默认停用, 由配置启用
+    if orm.MaskingEnabled() {
+        t.Errorf("output masking should be disabled by default")
+    }
+    orm.ConfigureMasking(keyConfig{orm.MaskingConfigKey: "true"})
+    if !orm.MaskingEnabled() {
+        t.Errorf("output masking should be enabled by configuration")
+    }
+    orm.SetMaskingEnabled(false)
+
+    // 加密列不能作为条件
+    func() {
+        defer func() {
+            if recover() == nil {
+                t.Errorf("encrypted condition should panic")
+            }
+        }()
+        dao.BuildSqlCount(&secretContributor{Email: e.Email})
+    }()
+
+    // 轮换密钥: 旧密钥的数据以新密钥重新加密
+    keyring, err := orm.LoadKeyring(keyConfig{
+        orm.KeyringConfigPrefix + "key.k1":  key1,
+        orm.KeyringConfigPrefix + "key.k2":  key2,
+        orm.KeyringConfigPrefix + "current": "k2",
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    orm.SetKeyring(keyring)
+    if updated, err := dao.RotateEncryption(ctx, &secretContributor{}); err != nil || updated != 1 {
+        t.Fatalf("rotate: updated = %d, err = %v", updated, err)
+    }
+    if stored := storedEmail(t, h, 1); !strings.HasPrefix(stored, "ENC:k2:") {
+        t.Errorf("email should be encrypted with k2: %s", stored)
+    }
+    found = &secretContributor{Id: e.Id}
+    if !dao.Find(ctx, found) || found.Email.String != "sting@example.com" {
+        t.Errorf("unexpected entity after rotation: %+v", found)
+    }
+}
+
+func storedEmail(t *testing.T, h *ormtest.Harness, id int64) string {
+    var stored string
+    if err := h.DB().QueryRow("SELECT EMAIL FROM SECRET_CONTRIBUTOR WHERE ID=?", id).Scan(&stored); err != nil {
+        t.Fatal(err)
+    }
+    return stored
+}
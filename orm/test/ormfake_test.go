@@ -0,0 +1,66 @@
+package test
+
+import (
+    "database/sql"
+    "errors"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+func TestFakeDriver(t *testing.T) {
+    fake := ormtest.NewFake(t, "mysql")
+    ctx := fake.Context()
+
+    // 未跟踪的实体更新所有非NULL字段
+    fake.ExpectExec("UPDATE ALBUM SET ID=?,TITLE=? WHERE ID=?").WithArgs(1, "Brand New Day", 1).WillReturnResult(0, 1)
+    e := &AlbumEntity{
+        Id:    sql.NullInt64{Int64: 1, Valid: true},
+        Title: sql.NullString{String: "Brand New Day", Valid: true},
+    }
+    if affected := e.Update(ctx); affected != 1 {
+        t.Errorf("affected = %d, expected 1", affected)
+    }
+
+    // 读取后的实体只更新变更字段
+    fake.ExpectQuery("").WithArgs(2).WillReturnRows(
+        []string{"Id", "Title", "Artist"},
+        []interface{}{2, "Nothing Like The Sun", "Sting"})
+    fake.ExpectExec("UPDATE ALBUM SET TITLE=? WHERE ID=?").WithArgs("Ten Summoner's Tales", 2).WillReturnResult(0, 1)
+    e = &AlbumEntity{Id: sql.NullInt64{Int64: 2, Valid: true}}
+    if !e.Find(ctx) || e.Artist.String != "Sting" {
+        t.Fatalf("unexpected entity: %+v", e)
+    }
+    e.Title = sql.NullString{String: "Ten Summoner's Tales", Valid: true}
+    e.Update(ctx)
+
+    // 事务中的错误及回滚
+    execErr := errors.New("deadlock")
+    fake.ExpectBegin()
+    fake.ExpectExec("DELETE FROM ALBUM WHERE ID=?").WithArgs(ormtest.AnyArg).WillReturnError(execErr)
+    fake.ExpectRollback()
+    txCtx, err := ctx.Begin()
+    if err != nil {
+        t.Fatal(err)
+    }
+    dao := &orm.Orm{}
+    sqlText, sqlParams := dao.BuildSqlDelete(e)
+    if _, err = dao.Exec(txCtx, sqlText, sqlParams...); err != execErr {
+        t.Errorf("err = %v, expected %v", err, execErr)
+    }
+    txCtx.Rollback()
+    statements := fake.Statements()
+    if last := statements[len(statements)-2]; last.Kind != ormtest.KindExec || !last.InTx {
+        t.Errorf("delete should be executed in transaction: %v", last)
+    }
+
+    // 按顺序匹配预期
+    fake.ExpectExec("UPDATE ALBUM SET GENRE=? WHERE ID=?")
+    fake.ExpectExec("DELETE FROM ALBUM WHERE ID=?")
+    if _, err = dao.Exec(ctx, sqlText, sqlParams...); err == nil {
+        t.Errorf("out of order statement should be rejected")
+    }
+    fake.Reset()
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+    "database/sql"
+    "regexp"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+)
+
+// 自增主键实体
+type autoKeyEntity struct {
+    Id   sql.NullInt64  `name:"ID", type:"INTEGER", comment:"编号", key:true, notnull:true, generate:"auto"`
+    Name sql.NullString `name:"NAME", type:"VARCHAR", comment:"名称", key:false, notnull:false`
+}
+
+func (owner *autoKeyEntity) TableName() string {
+    return "AUTO_KEY"
+}
+
+// UUID主键实体
+type uuidKeyEntity struct {
+    Id   string         `name:"ID", type:"VARCHAR", comment:"编号", key:true, notnull:true, generate:"uuid"`
+    Name sql.NullString `name:"NAME", type:"VARCHAR", comment:"名称", key:false, notnull:false`
+}
+
+func (owner *uuidKeyEntity) TableName() string {
+    return "UUID_KEY"
+}
+
+// Snowflake主键实体
+type snowflakeKeyEntity struct {
+    Id   int64          `name:"ID", type:"BIGINT", comment:"编号", key:true, notnull:true, generate:"snowflake"`
+    Name sql.NullString `name:"NAME", type:"VARCHAR", comment:"名称", key:false, notnull:false`
+}
+
+func (owner *snowflakeKeyEntity) TableName() string {
+    return "SNOWFLAKE_KEY"
+}
+
+// 序列主键实体
+type sequenceKeyEntity struct {
+    Id   sql.NullInt64  `name:"ID", type:"BIGINT", comment:"编号", key:true, notnull:true, generate:"sequence:SEQ_ORDER"`
+    Name sql.NullString `name:"NAME", type:"VARCHAR", comment:"名称", key:false, notnull:false`
+}
+
+func (owner *sequenceKeyEntity) TableName() string {
+    return "SEQUENCE_KEY"
+}
+
+func TestKeyGeneration(t *testing.T) {
+    h := ormtest.New(t, &autoKeyEntity{}, &uuidKeyEntity{}, &snowflakeKeyEntity{})
+    ctx := h.Context()
+    dao := &orm.Orm{}
+
+    // 自增主键(SQLite以RETURNING取得)
+    for i := int64(1); i <= 2; i++ {
+        e := &autoKeyEntity{Name: sql.NullString{String: "auto", Valid: true}}
+        if id := dao.InsertEntity(ctx, e); id != i || e.Id.Int64 != i {
+            t.Errorf("id = %d, entity id = %d, expected %d", id, e.Id.Int64, i)
+        }
+    }
+
+    // UUIDv7主键
+    uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+    first := &uuidKeyEntity{}
+    dao.InsertEntity(ctx, first)
+    second := &uuidKeyEntity{}
+    dao.InsertEntity(ctx, second)
+    if !uuidPattern.MatchString(first.Id) || first.Id >= second.Id {
+        t.Errorf("unexpected uuid: %s, %s", first.Id, second.Id)
+    }
+    var count int
+    if err := h.DB().QueryRow("SELECT COUNT(*) FROM UUID_KEY").Scan(&count); err != nil || count != 2 {
+        t.Errorf("count = %d, err = %v", count, err)
+    }
+
+    // Snowflake主键包含节点ID, 且单调递增
+    if err := orm.SetSnowflakeNode(1024); err != orm.ErrorInvalidSnowflakeNode {
+        t.Errorf("err = %v, expected %v", err, orm.ErrorInvalidSnowflakeNode)
+    }
+    orm.SetSnowflakeNode(7)
+    defer orm.SetSnowflakeNode(0)
+    var last int64
+    for i := 0; i < 3; i++ {
+        e := &snowflakeKeyEntity{}
+        if id := dao.InsertEntity(ctx, e); id != e.Id || id <= last || (id>>12)&0x3ff != 7 {
+            t.Errorf("unexpected snowflake id: %d (last %d)", id, last)
+        }
+        last = e.Id
+    }
+
+    // 构建SQL文时不生成主键, 不修改实体
+    empty := &snowflakeKeyEntity{}
+    if _, sqlParams := dao.BuildSqlInsert(empty); empty.Id != 0 || sqlParams[0] != int64(0) {
+        t.Errorf("BuildSqlInsert should not generate keys: %d, %v", empty.Id, sqlParams)
+    }
+
+    // 指定的主键不会被替换
+    e := &snowflakeKeyEntity{Id: 42}
+    if id := dao.InsertEntity(ctx, e); id != 42 {
+        t.Errorf("id = %d, expected 42", id)
+    }
+
+    // MySQL: 使用LastInsertId
+    fake := ormtest.NewFake(t, "mysql")
+    fake.ExpectExec("INSERT INTO AUTO_KEY(NAME) VALUES(?)").WithArgs("auto").WillReturnResult(15, 1)
+    auto := &autoKeyEntity{Name: sql.NullString{String: "auto", Valid: true}}
+    if id := dao.InsertEntity(fake.Context(), auto); id != 15 || auto.Id.Int64 != 15 {
+        t.Errorf("id = %d, entity id = %d, expected 15", id, auto.Id.Int64)
+    }
+
+    // PostgreSQL: 插入前取得序列值
+    fake = ormtest.NewFake(t, "postgres")
+    fake.ExpectQuery("SELECT nextval('SEQ_ORDER')").WillReturnRows([]string{"nextval"}, []interface{}{100})
+    fake.ExpectExec("INSERT INTO SEQUENCE_KEY(ID) VALUES($1)").WithArgs(100).WillReturnResult(0, 1)
+    seq := &sequenceKeyEntity{}
+    if id := dao.InsertEntity(fake.Context(), seq); id != 100 || seq.Id.Int64 != 100 {
+        t.Errorf("id = %d, entity id = %d, expected 100", id, seq.Id.Int64)
+    }
+
+    // 批量导入: 序列主键不作为必须项检查, 插入前取得序列值
+    fake.ExpectQuery("SELECT nextval('SEQ_ORDER')").WillReturnRows([]string{"nextval"}, []interface{}{101})
+    fake.ExpectExec("INSERT INTO SEQUENCE_KEY(ID,NAME) VALUES($1,$2)").WithArgs(101, "bulk").WillReturnResult(0, 1)
+    report, err := dao.Import(fake.Context(), &sequenceKeyEntity{}, strings.NewReader(`{"Name":"bulk"}`+"\n"), orm.ImportOption{Format: orm.FormatNDJSON})
+    if err != nil || report.Succeeded != 1 {
+        t.Errorf("report = %+v, err = %v", report, err)
+    }
+}
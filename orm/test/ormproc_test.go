@@ -0,0 +1,62 @@
+package test
+
+import (
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+// 报表存储过程的汇总行
+type albumSummary struct {
+    Artist     string
+    AlbumCount int64
+}
+
+func TestProcedure(t *testing.T) {
+    dao := &orm.Orm{}
+
+    // MySQL: OUT参数通过会话变量取得, 各结果集映射至不同类型
+    fake := ormtest.NewFake(t, "mysql")
+    fake.ExpectExec("SET @_p3=?").WithArgs(10)
+    fake.ExpectQuery("CALL ALBUM_REPORT(?,@_p2,@_p3)").WithArgs("Sting").
+        WillReturnRows([]string{"ID", "TITLE"}, []interface{}{1, "Ten Summoner's Tales"}, []interface{}{3, "Brand New Day"}).
+        WillReturnResultSet([]string{"Artist", "AlbumCount"}, []interface{}{"Sting", 2})
+    fake.ExpectQuery("SELECT @_p2,@_p3").WillReturnRows([]string{"@_p2", "@_p3"}, []interface{}{[]byte("2"), []byte("12")})
+    var albums []AlbumEntity
+    var summary albumSummary
+    var total int64
+    var limit int
+    outs, err := dao.CallProcedure(fake.Context(), "ALBUM_REPORT",
+        []orm.ProcParam{orm.ProcIn("Sting"), orm.ProcOut("total", &total), orm.ProcInOut("limit", 10, &limit)},
+        &albums, &summary)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(albums) != 2 || albums[1].Title.String != "Brand New Day" {
+        t.Errorf("unexpected albums: %+v", albums)
+    }
+    if summary.Artist != "Sting" || summary.AlbumCount != 2 {
+        t.Errorf("unexpected summary: %+v", summary)
+    }
+    if total != 2 || limit != 12 || outs["total"] != "2" {
+        t.Errorf("unexpected OUT values: total = %d, limit = %d, outs = %v", total, limit, outs)
+    }
+
+    // PostgreSQL: OUT参数值作为最后的结果集返回
+    fake = ormtest.NewFake(t, "postgres")
+    fake.ExpectQuery("CALL ALBUM_COUNT($1,$2)").WithArgs("Sting", nil).
+        WillReturnRows([]string{"total"}, []interface{}{2})
+    if outs, err = dao.CallProcedure(fake.Context(), "ALBUM_COUNT", []orm.ProcParam{orm.ProcIn("Sting"), orm.ProcOut("total", nil)}); err != nil {
+        t.Fatal(err)
+    }
+    if outs["total"] != int64(2) {
+        t.Errorf("unexpected OUT values: %v", outs)
+    }
+
+    // SQLite不支持存储过程
+    if _, err = dao.CallProcedure(ormtest.NewFake(t, "sqlite").Context(), "ALBUM_COUNT", nil); err != orm.ErrorProcedureNotSupported {
+        t.Errorf("err = %v, expected %v", err, orm.ErrorProcedureNotSupported)
+    }
+}
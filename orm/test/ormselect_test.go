@@ -0,0 +1,169 @@
+package test
+
+import (
+    "database/sql"
+    "reflect"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+func TestAggregate(t *testing.T) {
+    h := ormtest.New(t, &AlbumTrackEntity{})
+    h.MustLoadFixtures(t, h.Context(), "fixtures")
+    ctx := h.Context()
+    dao := &orm.Orm{}
+    e := &AlbumTrackEntity{}
+
+    // 列选择
+    type trackName struct {
+        TrackNo   int64
+        TrackName string
+    }
+    var names []trackName
+    sqlText, sqlParams := dao.BuildSqlSelectColumns(&AlbumTrackEntity{AlbumId: sql.NullInt64{Int64: 1, Valid: true}},
+        []string{"TrackNo", "TrackName"}, []orm.OrderByCondition{{Name: "TRACK_NO", DESC: true}})
+    if err := dao.Retrieve(ctx, sqlText, sqlParams...).DefaultMapping(&names); err != nil {
+        t.Fatal(err)
+    }
+    expectedNames := []trackName{{3, "Fields Of Gold"}, {2, "Love Is Stronger Than Justice"}, {1, "If I Ever Lose My Faith In You"}}
+    if !reflect.DeepEqual(names, expectedNames) {
+        t.Errorf("names = %v, expected %v", names, expectedNames)
+    }
+
+    // 聚合函数
+    sqlText, sqlParams = dao.BuildSqlSum(e, "PlayTime")
+    if sum := dao.Sum(ctx, sqlText, sqlParams...); !sum.Valid || !nearlyEqual(sum.Float64, 17.45) {
+        t.Errorf("sum = %v, expected 17.45", sum)
+    }
+    sqlText, sqlParams = dao.BuildSqlAvg(&AlbumTrackEntity{AlbumId: sql.NullInt64{Int64: 1, Valid: true}}, "PlayTime")
+    if avg := dao.Avg(ctx, sqlText, sqlParams...); !avg.Valid || !nearlyEqual(avg.Float64, 13.11/3) {
+        t.Errorf("avg = %v, expected %v", avg, 13.11/3)
+    }
+    sqlText, sqlParams = dao.BuildSqlMin(e, "PlayTime")
+    if min := dao.Min(ctx, sqlText, sqlParams...); !min.Valid || !nearlyEqual(min.Float64, 3.42) {
+        t.Errorf("min = %v, expected 3.42", min)
+    }
+    sqlText, sqlParams = dao.BuildSqlMax(e, "TrackNo")
+    if max := dao.Max(ctx, sqlText, sqlParams...); !max.Valid || max.Float64 != 3 {
+        t.Errorf("max = %v, expected 3", max)
+    }
+    sqlText, sqlParams = dao.BuildSqlMax(e, "TrackName")
+    if max := dao.MaxString(ctx, sqlText, sqlParams...); max.String != "The Lazarus Heart" {
+        t.Errorf("max = %v, expected The Lazarus Heart", max)
+    }
+    // 无记录时为NULL
+    sqlText, sqlParams = dao.BuildSqlSum(&AlbumTrackEntity{AlbumId: sql.NullInt64{Int64: 9, Valid: true}}, "PlayTime")
+    if sum := dao.Sum(ctx, sqlText, sqlParams...); sum.Valid {
+        t.Errorf("sum = %v, expected NULL", sum)
+    }
+
+    // 分组统计
+    type albumStats struct {
+        AlbumId  int64
+        Tracks   int64
+        PlayTime float64
+    }
+    var stats []albumStats
+    sqlText, sqlParams = dao.BuildSqlGroupBy(e, []string{"AlbumId"},
+        []orm.AggregateColumn{{Func: orm.AggregateCount, Alias: "Tracks"}, {Func: orm.AggregateSum, Name: "PlayTime", Alias: "PlayTime"}},
+        &orm.HavingCondition{Condition: "COUNT(*) > ?", Params: []interface{}{1}}, []orm.OrderByCondition{{Name: "AlbumId"}})
+    if err := dao.Retrieve(ctx, sqlText, sqlParams...).DefaultMapping(&stats); err != nil {
+        t.Fatal(err)
+    }
+    if len(stats) != 1 || stats[0].AlbumId != 1 || stats[0].Tracks != 3 || !nearlyEqual(stats[0].PlayTime, 13.11) {
+        t.Errorf("stats = %v, expected [{1 3 13.11}]", stats)
+    }
+}
+
+func TestJoin(t *testing.T) {
+    h := ormtest.New(t, &AlbumEntity{}, &AlbumGenreEntity{})
+    h.MustLoadFixtures(t, h.Context(), "fixtures")
+    dao := &orm.Orm{}
+
+    type albumWithGenre struct {
+        AlbumEntity
+        AlbumGenreEntity
+    }
+    query := orm.NewJoinQuery(&AlbumEntity{}, "").LeftJoin(&AlbumGenreEntity{}, "", "Genre")
+    sqlText, sqlParams := dao.BuildSqlJoin(query, []orm.OrderByCondition{{Name: "Id"}})
+    var list []albumWithGenre
+    if err := dao.Retrieve(h.Context(), sqlText, sqlParams...).DefaultMapping(&list); err != nil {
+        t.Fatal(err)
+    }
+    if len(list) != 3 {
+        t.Fatalf("%d rows, expected 3", len(list))
+    }
+    for i, expected := range []sql.NullString{{String: "Rock", Valid: true}, {String: "Rock", Valid: true}, {}} {
+        if list[i].Id.Int64 != int64(i+1) || list[i].GenreName != expected {
+            t.Errorf("row %d = %d %v, expected %d %v", i, list[i].Id.Int64, list[i].GenreName, i+1, expected)
+        }
+    }
+
+    // 内关联及主实体条件
+    query = orm.NewJoinQuery(&AlbumEntity{Artist: sql.NullString{String: "Sting", Valid: true}}, "").
+        InnerJoin(&AlbumGenreEntity{}, "", "Genre")
+    sqlText, sqlParams = dao.BuildSqlJoin(query, nil)
+    list = nil
+    if err := dao.Retrieve(h.Context(), sqlText, sqlParams...).DefaultMapping(&list); err != nil {
+        t.Fatal(err)
+    }
+    if len(list) != 2 {
+        t.Errorf("%d rows, expected 2", len(list))
+    }
+}
+
+func TestLock(t *testing.T) {
+    dao := &orm.Orm{}
+    e := &AlbumEntity{Id: sql.NullInt64{Int64: 1, Valid: true}}
+    sqlText, sqlParams := dao.BuildSqlSelectOne(e)
+
+    for _, c := range []struct {
+        dialect string
+        lock    orm.LockOption
+        clause  string
+    }{
+        {"mysql", orm.LockOption{Mode: orm.LockForUpdate}, "FOR UPDATE"},
+        {"mysql", orm.LockOption{Mode: orm.LockForShare}, "LOCK IN SHARE MODE"},
+        {"mysql", orm.LockOption{Mode: orm.LockForUpdate, Wait: orm.LockNoWait}, "FOR UPDATE NOWAIT"},
+        {"postgres", orm.LockOption{Mode: orm.LockForShare, Wait: orm.LockSkipLocked}, "FOR SHARE SKIP LOCKED"},
+    } {
+        fake := ormtest.NewFake(t, c.dialect)
+        fake.ExpectBegin()
+        fake.ExpectQuery(orm.GetDialect(c.dialect).Rebind(sqlText + " " + c.clause)).WithArgs(1).
+            WillReturnRows([]string{"Id", "Title"}, []interface{}{1, "Ten Summoner's Tales"})
+        fake.ExpectRollback()
+
+        ctx := fake.Context()
+        if _, err := dao.RetrieveForLock(ctx, c.lock, sqlText, sqlParams...); err != orm.ErrorNotInTransaction {
+            t.Errorf("%s: err = %v, expected %v", c.dialect, err, orm.ErrorNotInTransaction)
+        }
+        tx, err := ctx.Begin()
+        if err != nil {
+            t.Fatal(err)
+        }
+        rows, err := dao.RetrieveForLock(tx, c.lock, sqlText, sqlParams...)
+        if err != nil {
+            t.Fatalf("%s %s: %v", c.dialect, c.clause, err)
+        }
+        var locked AlbumEntity
+        if err = rows.DefaultMapping(&locked); err != nil || locked.Title.String != "Ten Summoner's Tales" {
+            t.Errorf("%s %s: %v %v", c.dialect, c.clause, err, locked)
+        }
+        rows.Close()
+        tx.Rollback()
+    }
+
+    // SQLite不支持行锁
+    h := ormtest.New(t, &AlbumEntity{})
+    ctx := h.Begin(t)
+    if _, err := dao.RetrieveForLock(ctx, orm.LockOption{Mode: orm.LockForUpdate}, sqlText, sqlParams...); err != orm.ErrorLockNotSupported {
+        t.Errorf("err = %v, expected %v", err, orm.ErrorLockNotSupported)
+    }
+}
+
+func nearlyEqual(a float64, b float64) bool {
+    return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+    "database/sql"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+)
+
+// 分片测试实体
+type shardedTrack struct {
+    AlbumId   sql.NullInt64   `name:"ALBUM_ID", type:"INT", comment:"所属唱片", key:true, notnull:true`
+    TrackNo   sql.NullInt64   `name:"TRACK_NO", type:"INT", comment:"曲目编号", key:true, notnull:true`
+    TrackName sql.NullString  `name:"TRACK_NAME", type:"VARCHAR", comment:"曲目名称", key:false, notnull:true`
+    PlayTime  sql.NullFloat64 `name:"PLAY_TIME", type:"DECIMAL", comment:"播放时间", key:false, notnull:false`
+}
+
+func (owner *shardedTrack) TableName() string {
+    return "SHARDED_TRACK"
+}
+
+// 范围分片测试实体
+type rangeTrack struct {
+    AlbumId   sql.NullInt64  `name:"ALBUM_ID", type:"INT", comment:"所属唱片", key:true, notnull:true`
+    TrackNo   sql.NullInt64  `name:"TRACK_NO", type:"INT", comment:"曲目编号", key:true, notnull:true`
+    TrackName sql.NullString `name:"TRACK_NAME", type:"VARCHAR", comment:"曲目名称", key:false, notnull:true`
+}
+
+func (owner *rangeTrack) TableName() string {
+    return "RANGE_TRACK"
+}
+
+func newShardedTrack(albumId int64, trackNo int64, name string, playTime float64) *shardedTrack {
+    return &shardedTrack{
+        AlbumId:   sql.NullInt64{Int64: albumId, Valid: true},
+        TrackNo:   sql.NullInt64{Int64: trackNo, Valid: true},
+        TrackName: sql.NullString{String: name, Valid: true},
+        PlayTime:  sql.NullFloat64{Float64: playTime, Valid: true},
+    }
+}
+
+func TestSharding(t *testing.T) {
+    h0 := ormtest.New(t, &shardedTrack{})
+    h1 := ormtest.New(t, &shardedTrack{})
+    orm.RegisterDataSource("track0", h0.Context())
+    orm.RegisterDataSource("track1", h1.Context())
+    orm.SetShardRule(&shardedTrack{}, orm.ShardRule{
+        Strategy: orm.ShardHash,
+        Field:    "AlbumId",
+        Shards:   []orm.Shard{{DataSource: "track0"}, {DataSource: "track1"}},
+    })
+    defer orm.SetShardRule(&shardedTrack{}, orm.ShardRule{})
+    ctx := h0.Context()
+    dao := &orm.Orm{}
+
+    // 插入按唱片编号路由至各数据源
+    tracks := []*shardedTrack{
+        newShardedTrack(1, 1, "If I Ever Lose My Faith in You", 4.5),
+        newShardedTrack(1, 2, "Love Is Stronger Than Justice", 5.2),
+        newShardedTrack(2, 1, "The Lazarus Heart", 4.6),
+        newShardedTrack(3, 1, "A Thousand Years", 6.0),
+        newShardedTrack(4, 1, "Lithium Sunset", 3.9),
+    }
+    for _, track := range tracks {
+        dao.InsertEntity(ctx, track)
+    }
+    if count := countTable(t, h0, "SHARDED_TRACK"); count != 2 {
+        t.Errorf("shard 0 count = %d, expected 2", count)
+    }
+    if count := countTable(t, h1, "SHARDED_TRACK"); count != 3 {
+        t.Errorf("shard 1 count = %d, expected 3", count)
+    }
+
+    // 主键查询及更新路由至分片
+    found := &shardedTrack{AlbumId: sql.NullInt64{Int64: 3, Valid: true}, TrackNo: sql.NullInt64{Int64: 1, Valid: true}}
+    if !dao.Find(ctx, found) || found.TrackName.String != "A Thousand Years" {
+        t.Fatalf("unexpected track: %+v", found)
+    }
+    found.PlayTime = sql.NullFloat64{Float64: 6.1, Valid: true}
+    if affected := dao.UpdateEntity(ctx, found); affected != 1 {
+        t.Errorf("affected = %d, expected 1", affected)
+    }
+    var playTime float64
+    h1.DB().QueryRow("SELECT PLAY_TIME FROM SHARDED_TRACK WHERE ALBUM_ID=3").Scan(&playTime)
+    if playTime != 6.1 {
+        t.Errorf("play time = %v, expected 6.1", playTime)
+    }
+
+    // 无分片键的查询在所有分片执行, 件数合计
+    sqlText, sqlParams := dao.BuildSqlSelect(&shardedTrack{}, nil)
+    var all []shardedTrack
+    if err := dao.Retrieve(ctx, sqlText, sqlParams...).DefaultMapping(&all); err != nil || len(all) != 5 {
+        t.Errorf("scattered retrieve: %d tracks, err = %v", len(all), err)
+    }
+    sqlText, sqlParams = dao.BuildSqlCount(&shardedTrack{})
+    if count := dao.Count(ctx, sqlText, sqlParams...); count != 5 {
+        t.Errorf("scattered count = %d, expected 5", count)
+    }
+    sqlText, sqlParams = dao.BuildSqlCount(&shardedTrack{TrackNo: sql.NullInt64{Int64: 1, Valid: true}})
+    if count := dao.Count(ctx, sqlText, sqlParams...); count != 4 {
+        t.Errorf("scattered count = %d, expected 4", count)
+    }
+
+    // 排序等须使用跨分片查询
+    func() {
+        defer func() {
+            if recover() != orm.ErrorCrossShardQuery {
+                t.Errorf("ordered query without shard key should panic")
+            }
+        }()
+        sqlText, sqlParams := dao.BuildSqlSelect(&shardedTrack{}, []orm.OrderByCondition{{Name: "PLAY_TIME"}})
+        dao.Retrieve(ctx, sqlText, sqlParams...)
+    }()
+    var merged []shardedTrack
+    if err := dao.SelectSharded(ctx, &shardedTrack{}, &merged, orm.ShardQuery{
+        OrderBy: []orm.OrderByCondition{{Name: "PLAY_TIME", DESC: true}},
+        Offset:  1,
+        Limit:   3,
+    }); err != nil {
+        t.Fatal(err)
+    }
+    var names []string
+    for _, track := range merged {
+        names = append(names, track.TrackName.String)
+    }
+    if strings.Join(names, ",") != "Love Is Stronger Than Justice,The Lazarus Heart,If I Ever Lose My Faith in You" {
+        t.Errorf("unexpected merged tracks: %v", names)
+    }
+    if count := dao.CountSharded(ctx, &shardedTrack{}); count != 5 {
+        t.Errorf("count = %d, expected 5", count)
+    }
+    if count := dao.CountSharded(ctx, &shardedTrack{AlbumId: sql.NullInt64{Int64: 1, Valid: true}}); count != 2 {
+        t.Errorf("count = %d, expected 2", count)
+    }
+
+    // 事务不能跨数据源
+    txCtx := h0.Begin(t)
+    sqlText, sqlParams = dao.BuildSqlInsert(newShardedTrack(5, 1, "Shape of My Heart", 4.6))
+    if _, err := dao.Exec(txCtx, sqlText, sqlParams...); err != orm.ErrorCrossShardTransaction {
+        t.Errorf("err = %v, expected %v", err, orm.ErrorCrossShardTransaction)
+    }
+    txCtx.Rollback()
+
+    // 按范围分片至同一数据库的后缀表
+    for _, suffix := range []string{"_0", "_1"} {
+        if _, err := h0.DB().Exec(strings.Replace(ormtest.CreateTableSql(&rangeTrack{}), "RANGE_TRACK", "RANGE_TRACK"+suffix, 1)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    orm.SetShardRule(&rangeTrack{}, orm.ShardRule{
+        Strategy: orm.ShardRange,
+        Field:    "AlbumId",
+        Shards:   []orm.Shard{{Suffix: "_0", Upper: 100}, {Suffix: "_1"}},
+    })
+    defer orm.SetShardRule(&rangeTrack{}, orm.ShardRule{})
+    for _, track := range []*shardedTrack{
+        newShardedTrack(50, 1, "Desert Rose", 4.8),
+        newShardedTrack(150, 1, "Fields of Gold", 3.6),
+        newShardedTrack(150, 2, "Fragile", 3.9),
+    } {
+        dao.InsertEntity(ctx, &rangeTrack{AlbumId: track.AlbumId, TrackNo: track.TrackNo, TrackName: track.TrackName})
+    }
+    if count0, count1 := countTable(t, h0, "RANGE_TRACK_0"), countTable(t, h0, "RANGE_TRACK_1"); count0 != 1 || count1 != 2 {
+        t.Errorf("range shard count = %d, %d, expected 1, 2", count0, count1)
+    }
+}
+
+func countTable(t *testing.T, h *ormtest.Harness, table string) int {
+    var count int
+    if err := h.DB().QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+        t.Fatal(err)
+    }
+    return count
+}
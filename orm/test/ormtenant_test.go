@@ -0,0 +1,84 @@
+package test
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+func TestTenant(t *testing.T) {
+    fake := ormtest.NewFake(t, "mysql")
+    dao := &orm.Orm{}
+
+    // 表名前缀模式
+    orm.SetTenantPolicy(&AlbumEntity{}, orm.TenantPolicy{Mode: orm.TenantTablePrefix})
+    defer orm.SetTenantPolicy(&AlbumEntity{}, orm.TenantPolicy{})
+    e := &AlbumEntity{Id: sql.NullInt64{Int64: 1, Valid: true}}
+    sqlText, sqlParams := dao.BuildSqlDelete(e)
+    fake.ExpectExec("DELETE FROM acme_ALBUM WHERE ID=?").WithArgs(1).WillReturnResult(0, 1)
+    if _, err := dao.Exec(fake.Context().WithTenant("acme"), sqlText, sqlParams...); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := dao.Exec(fake.Context(), sqlText, sqlParams...); err != orm.ErrorTenantRequired {
+        t.Errorf("err = %v, expected %v", err, orm.ErrorTenantRequired)
+    }
+    if _, err := dao.Exec(fake.Context().WithTenant("acme;--"), sqlText, sqlParams...); err != orm.ErrorInvalidTenant {
+        t.Errorf("err = %v, expected %v", err, orm.ErrorInvalidTenant)
+    }
+
+    // 只改写实体Metadata构建的表名, 字符串及注释中的表名不改写
+    fake.ExpectQuery("SELECT ID FROM ALBUM WHERE TITLE='FROM ALBUM' /* UPDATE ALBUM */").WillReturnRows([]string{"ID"})
+    dao.Retrieve(fake.Context().WithTenant("acme"), "SELECT ID FROM ALBUM WHERE TITLE='FROM ALBUM' /* UPDATE ALBUM */").Close()
+    fake.ExpectQuery("SELECT ID FROM acme_ALBUM WHERE TITLE='FROM ALBUM'").WillReturnRows([]string{"ID"})
+    dao.Retrieve(fake.Context().WithTenant("acme"), "SELECT ID FROM {{ALBUM}} WHERE TITLE='FROM ALBUM'").Close()
+
+    // 模式区分
+    orm.SetTenantPolicy(&AlbumEntity{}, orm.TenantPolicy{Mode: orm.TenantSchema})
+    fake.ExpectQuery("SELECT COUNT(*) AS `count` FROM acme.ALBUM").WillReturnRows([]string{"count"}, []interface{}{3})
+    if count := (&AlbumEntity{}).Count(fake.Context().WithTenant("acme")); count != 3 {
+        t.Errorf("count = %d, expected 3", count)
+    }
+    orm.SetTenantPolicy(&AlbumEntity{}, orm.TenantPolicy{Mode: orm.TenantTablePrefix})
+
+    // 共享表模式: 租户列追加至WHERE条件及INSERT
+    orm.SetTenantPolicy(&AlbumTrackEntity{}, orm.TenantPolicy{Mode: orm.TenantSharedTable, Column: "TENANT_ID"})
+    defer orm.SetTenantPolicy(&AlbumTrackEntity{}, orm.TenantPolicy{})
+    ctx := fake.Context().WithContext(orm.ContextWithTenant(context.Background(), "acme"))
+    track := &AlbumTrackEntity{
+        AlbumId:   sql.NullInt64{Int64: 1, Valid: true},
+        TrackNo:   sql.NullInt64{Int64: 2, Valid: true},
+        TrackName: sql.NullString{String: "Fields Of Gold", Valid: true},
+    }
+    fake.ExpectExec("INSERT INTO ALBUM_TRACK(ALBUM_ID,TRACK_NO,TRACK_NAME,TENANT_ID) VALUES(?,?,?,?)").
+        WithArgs(1, 2, "Fields Of Gold", "acme")
+    track.Insert(ctx)
+    fake.ExpectQuery("SELECT COUNT(*) AS `count` FROM ALBUM_TRACK WHERE ALBUM_ID=? AND TENANT_ID=?").
+        WithArgs(1, "acme").WillReturnRows([]string{"count"}, []interface{}{1})
+    if count := (&AlbumTrackEntity{AlbumId: track.AlbumId}).Count(ctx); count != 1 {
+        t.Errorf("count = %d, expected 1", count)
+    }
+
+    // 关联表的租户条件位于ON子句
+    query := orm.NewJoinQuery(&AlbumEntity{}, "Album").Join(orm.JoinLeft, &AlbumTrackEntity{}, "Track", orm.JoinCondition{Field: "Id", JoinField: "AlbumId"})
+    sqlText, sqlParams = dao.BuildSqlJoin(query, nil)
+    fake.ExpectQuery("").WithArgs("acme").WillReturnRows([]string{"Album.Id"})
+    dao.Retrieve(ctx, sqlText, sqlParams...).Close()
+    statements := fake.Statements()
+    if last := statements[len(statements)-1].Sql; !containsAll(last, "FROM acme_ALBUM T0", "LEFT JOIN ALBUM_TRACK T1 ON T1.ALBUM_ID=T0.ID AND T1.TENANT_ID=?") {
+        t.Errorf("unexpected join sql: %s", last)
+    }
+}
+
+func containsAll(text string, parts ...string) bool {
+    for _, part := range parts {
+        if !strings.Contains(text, part) {
+            return false
+        }
+    }
+    return true
+}
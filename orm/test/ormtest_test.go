@@ -0,0 +1,53 @@
+package test
+
+import (
+    "database/sql"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+func TestOrmHarness(t *testing.T) {
+    h := ormtest.New(t, &AlbumEntity{}, &AlbumTrackEntity{})
+    h.MustLoadFixtures(t, h.Context(), "fixtures")
+
+    ormtest.AssertRowCount(t, h.Context(), &AlbumEntity{}, 3)
+    ormtest.AssertRowCount(t, h.Context(), &AlbumTrackEntity{AlbumId: sql.NullInt64{Int64: 1, Valid: true}}, 3)
+    ormtest.AssertEntityExists(t, h.Context(), &AlbumEntity{
+        Id:    sql.NullInt64{Int64: 3, Valid: true},
+        Title: sql.NullString{String: "Brand New Day", Valid: true},
+    })
+
+    h.Run(t, "update", func(t *testing.T, ctx orm.OrmContext) {
+        e := &AlbumEntity{Id: sql.NullInt64{Int64: 1, Valid: true}}
+        if !e.Find(ctx) {
+            t.Fatal("album 1 not found")
+        }
+        e.Genre = sql.NullString{String: "2", Valid: true}
+        if affected := e.Update(ctx); affected != 1 {
+            t.Errorf("affected = %d, expected 1", affected)
+        }
+        ormtest.AssertEntityExists(t, ctx, &AlbumEntity{
+            Id:    sql.NullInt64{Int64: 1, Valid: true},
+            Genre: sql.NullString{String: "2", Valid: true},
+        })
+    })
+
+    h.Run(t, "delete", func(t *testing.T, ctx orm.OrmContext) {
+        track := &AlbumTrackEntity{AlbumId: sql.NullInt64{Int64: 1, Valid: true}, TrackNo: sql.NullInt64{Int64: 1, Valid: true}}
+        if affected := track.Delete(ctx); affected != 1 {
+            t.Errorf("affected = %d, expected 1", affected)
+        }
+        ormtest.AssertRowCount(t, ctx, &AlbumTrackEntity{}, 3)
+        ormtest.AssertEntityNotExists(t, ctx, track)
+    })
+
+    // 子测试的变更已回滚
+    ormtest.AssertRowCount(t, h.Context(), &AlbumTrackEntity{}, 4)
+    ormtest.AssertEntityNotExists(t, h.Context(), &AlbumEntity{
+        Id:    sql.NullInt64{Int64: 1, Valid: true},
+        Genre: sql.NullString{String: "2", Valid: true},
+    })
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+    "database/sql"
+    "reflect"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+    . "github.com/umeframework/gear/orm/test/dto"
+)
+
+func TestTracking(t *testing.T) {
+    fake := ormtest.NewFake(t, "mysql")
+    ctx := fake.Context()
+
+    fake.ExpectQuery("").WithArgs(1).WillReturnRows(
+        []string{"Id", "Title", "Artist", "Genre"},
+        []interface{}{1, "Ten Summoner's Tales", "Sting", "1"})
+    e := &AlbumEntity{Id: sql.NullInt64{Int64: 1, Valid: true}}
+    if !e.Find(ctx) || !e.Tracked() {
+        t.Fatalf("entity should be tracked after loading: %+v", e)
+    }
+
+    // 无变更时不执行更新
+    if changes := orm.Changes(e); len(changes) != 0 {
+        t.Errorf("changes = %v, expected none", changes)
+    }
+    if affected := e.Update(ctx); affected != 0 {
+        t.Errorf("affected = %d, expected 0", affected)
+    }
+    if statements := fake.Statements(); len(statements) != 1 {
+        t.Errorf("statements = %v, expected only the query", statements)
+    }
+
+    // 只更新变更字段
+    e.Title = sql.NullString{String: "Brand New Day", Valid: true}
+    e.Genre = sql.NullString{}
+    expected := []orm.FieldChange{
+        {Field: "Title", Column: "TITLE", Original: sql.NullString{String: "Ten Summoner's Tales", Valid: true},
+            Current: sql.NullString{String: "Brand New Day", Valid: true}},
+        {Field: "Genre", Column: "GENRE", Original: sql.NullString{String: "1", Valid: true}, Current: sql.NullString{}},
+    }
+    if changes := orm.Changes(e); !reflect.DeepEqual(changes, expected) {
+        t.Errorf("changes = %+v, expected %+v", changes, expected)
+    }
+    if fields := orm.ChangedFields(e); !reflect.DeepEqual(fields, []string{"Title", "Genre"}) {
+        t.Errorf("changed fields = %v", fields)
+    }
+    fake.ExpectExec("UPDATE ALBUM SET TITLE=?,GENRE=? WHERE ID=?").WithArgs("Brand New Day", nil, 1).WillReturnResult(0, 1)
+    if affected := e.Update(ctx); affected != 1 {
+        t.Errorf("affected = %d, expected 1", affected)
+    }
+
+    // 更新后以当前值作为快照
+    if changes := orm.Changes(e); len(changes) != 0 {
+        t.Errorf("changes after update = %v, expected none", changes)
+    }
+    e.Update(ctx)
+
+    // 停止跟踪后更新所有非NULL字段
+    orm.Untrack(e)
+    if orm.Changes(e) != nil {
+        t.Errorf("untracked entity should report no changes")
+    }
+    fake.ExpectExec("UPDATE ALBUM SET ID=?,TITLE=?,ARTIST=? WHERE ID=?").WithArgs(1, "Brand New Day", "Sting", 1).WillReturnResult(0, 1)
+    e.Update(ctx)
+}
+
+// 主键加密的测试实体
+type secretLicense struct {
+    orm.Tracker
+    Serial sql.NullString `name:"SERIAL", type:"VARCHAR", comment:"序列号", key:true, notnull:true, encrypt:true`
+    Holder sql.NullString `name:"HOLDER", type:"VARCHAR", comment:"持有人", key:false, notnull:false`
+}
+
+func (owner *secretLicense) TableName() string {
+    return "SECRET_LICENSE"
+}
+
+func TestTrackingEncryptedKey(t *testing.T) {
+    fake := ormtest.NewFake(t, "mysql")
+    ctx := fake.Context()
+    e := &secretLicense{Serial: sql.NullString{String: "S-1", Valid: true}}
+    e.Holder = sql.NullString{String: "Sting", Valid: true}
+
+    // 加密列不能作为变更跟踪的主键条件, 不执行任何SQL
+    func() {
+        defer func() {
+            if err, _ := recover().(string); !strings.HasPrefix(err, "Key or version column can not be encrypted") {
+                t.Errorf("unexpected panic: %v", err)
+            }
+        }()
+        orm.Track(e)
+        (&orm.Orm{}).UpdateEntity(ctx, e)
+    }()
+    if statements := fake.Statements(); len(statements) != 0 {
+        t.Errorf("statements = %v, expected none", statements)
+    }
+}
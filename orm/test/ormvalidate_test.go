@@ -0,0 +1,136 @@
+package test
+
+import (
+    "database/sql"
+    "strings"
+    "testing"
+
+    "github.com/umeframework/gear/orm"
+    "github.com/umeframework/gear/orm/ormtest"
+)
+
+// 检查测试实体
+type validatedArtist struct {
+    orm.Tracker
+    Id      sql.NullInt64   `name:"ID", type:"INT", comment:"编号", key:true, notnull:true`
+    Name    sql.NullString  `name:"NAME", type:"VARCHAR(10)", comment:"名称", key:false, notnull:true`
+    Country sql.NullString  `name:"COUNTRY", type:"CHAR(2)", comment:"国家", key:false, notnull:false, pattern:"^[A-Z]{1,2}$"`
+    Rating  sql.NullFloat64 `name:"RATING", type:"DECIMAL(3,1)", comment:"评分", key:false, notnull:false, min:"0", max:"10"`
+    Debut   sql.NullString  `name:"DEBUT", type:"DATE", comment:"出道日", key:false, notnull:false`
+    Memo    sql.NullString  `name:"MEMO", type:"TEXT", comment:"备注", key:false, notnull:false, length:"5"`
+}
+
+func (owner *validatedArtist) TableName() string {
+    return "VALIDATED_ARTIST"
+}
+
+func newValidatedArtist(id int64, name string) *validatedArtist {
+    return &validatedArtist{
+        Id:   sql.NullInt64{Int64: id, Valid: true},
+        Name: sql.NullString{String: name, Valid: true},
+    }
+}
+
+func TestValidation(t *testing.T) {
+    h := ormtest.New(t, &validatedArtist{})
+    ctx := h.Context()
+    dao := &orm.Orm{}
+
+    // 各规则的检查
+    invalid := &validatedArtist{
+        Id:      sql.NullInt64{Int64: 1 << 40, Valid: true},
+        Country: sql.NullString{String: "jp", Valid: true},
+        Rating:  sql.NullFloat64{Float64: 12, Valid: true},
+        Debut:   sql.NullString{String: "1977-13-01", Valid: true},
+        Memo:    sql.NullString{String: "抒情的摇滚乐", Valid: true},
+    }
+    err, ok := orm.ValidateEntity(invalid).(*orm.ValidationError)
+    if !ok {
+        t.Fatalf("expected validation error")
+    }
+    expected := map[string]string{
+        "Id":      orm.RuleType,
+        "Name":    orm.RuleRequired,
+        "Country": orm.RulePattern,
+        "Rating":  orm.RuleMax,
+        "Debut":   orm.RuleType,
+        "Memo":    orm.RuleLength,
+    }
+    if len(err.Fields) != len(expected) {
+        t.Errorf("unexpected field errors: %v", err)
+    }
+    for field, rule := range expected {
+        if fieldError, found := err.Field(field); !found || fieldError.Rule != rule {
+            t.Errorf("%s: %+v, expected rule %s", field, fieldError, rule)
+        }
+    }
+    if err.Table != "VALIDATED_ARTIST" || !strings.Contains(err.Error(), "Name is required") {
+        t.Errorf("unexpected error: %v", err)
+    }
+
+    // 标签规则
+    artist := newValidatedArtist(1, "Sting")
+    artist.Rating = sql.NullFloat64{Float64: -1, Valid: true}
+    if fieldError, _ := orm.ValidateEntity(artist).(*orm.ValidationError).Field("Rating"); fieldError.Rule != orm.RuleMin {
+        t.Errorf("unexpected rating error: %+v", fieldError)
+    }
+    artist.Rating = sql.NullFloat64{Float64: 9.5, Valid: true}
+    artist.Country = sql.NullString{String: "GB", Valid: true}
+    artist.Debut = sql.NullString{String: "1977-10-02", Valid: true}
+    if err := orm.ValidateEntity(artist); err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+
+    // 插入前检查
+    func() {
+        defer func() {
+            err, ok := recover().(*orm.ValidationError)
+            if !ok {
+                t.Fatalf("insert should panic with validation error")
+            }
+            if fieldError, _ := err.Field("Name"); fieldError.Rule != orm.RuleLength {
+                t.Errorf("unexpected error: %v", err)
+            }
+        }()
+        dao.InsertEntity(ctx, newValidatedArtist(2, "The Police Band"))
+    }()
+    dao.InsertEntity(ctx, artist)
+    ormtest.AssertRowCount(t, ctx, &validatedArtist{}, 1)
+
+    // 更新时只检查更新的列
+    found := newValidatedArtist(1, "")
+    found.Name = sql.NullString{}
+    if !dao.Find(ctx, found) {
+        t.Fatalf("artist not found")
+    }
+    orm.Track(found)
+    found.Memo = sql.NullString{String: "bass", Valid: true}
+    if affected := dao.UpdateEntity(ctx, found); affected != 1 {
+        t.Errorf("affected = %d, expected 1", affected)
+    }
+    orm.Track(found)
+    found.Name = sql.NullString{}
+    func() {
+        defer func() {
+            if _, ok := recover().(*orm.ValidationError); !ok {
+                t.Errorf("update setting NOT NULL column to NULL should panic")
+            }
+        }()
+        dao.UpdateEntity(ctx, found)
+    }()
+
+    // 导入时检查错误按行报告
+    csvText := "ID,NAME,COUNTRY\n" +
+        "3,Sting,GB\n" +
+        "4,Sting,Britain\n"
+    report, err2 := dao.Import(ctx, &validatedArtist{}, strings.NewReader(csvText), orm.ImportOption{Format: orm.FormatCSV})
+    if err2 != nil {
+        t.Fatal(err2)
+    }
+    if report.Succeeded != 1 || report.Failed != 1 || report.Errors[0].Line != 3 {
+        t.Fatalf("unexpected report: %+v", report)
+    }
+    if _, ok := report.Errors[0].Err.(*orm.ValidationError); !ok {
+        t.Errorf("unexpected import error: %v", report.Errors[0].Err)
+    }
+}